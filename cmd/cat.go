@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// catCmd represents the cat command
+//
+// Prints file contents without mounting the fs
+var catCmd = &cobra.Command{
+	Use:   "cat PATH...",
+	Short: "Print file contents",
+	Long:  "Prints the contents of files, straight from the SQL db.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, p := range args {
+			reader, err := f.Open(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if _, err = io.Copy(os.Stdout, reader); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(catCmd)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+var copyFrom string
+var copyTo string
+var copyNoVerify bool
+var copyQuiet bool
+
+// copyCmd represents the copy command
+//
+// Copies the whole fs from one db to another
+var copyCmd = &cobra.Command{
+	Use:   "copy --from URI --to URI",
+	Short: "Copy the fs to another db",
+	Long: `Copies every inode, directory entry and file content from the db at
+--from to the db at --to, which may use a different backend. The target is
+initialized if needed. Inode numbers are preserved, so the target must be
+freshly initialized or the target of an interrupted copy, which is resumed by
+running the same command again.
+
+Afterwards the number of entries, their metadata and the sha256 checksum of
+every file are compared on both sides, unless --no-verify is given.
+
+--table-prefix and --schema apply to both dbs. File contents are copied in
+parts, so files don't have to fit in memory.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fromBackend, fromDSN := backendFromURI(copyFrom)
+		fromDB, err := fromBackend.OpenDB(fromDSN)
+		if err != nil {
+			log.Fatalf("Couldn't open DB: %v", err)
+		}
+		if err = fromBackend.VerifyDB(fromDB); err != nil {
+			log.Fatalf("SQL DB Verification failed: %v", err)
+		}
+
+		toBackend, toDSN := backendFromURI(copyTo)
+		toDB, err := toBackend.OpenDB(toDSN)
+		if err != nil {
+			log.Fatalf("Couldn't open DB: %v", err)
+		}
+		if err = toBackend.CreateDBTables(toDB); err != nil {
+			log.Fatalf("Couldn't create DB tables: %v", err)
+		}
+		if err = toBackend.InitializeDBRows(toDB); err != nil {
+			log.Fatalf("Couldn't insert initial rows: %v", err)
+		}
+
+		from := &fsops.FS{Backend: fromBackend, DB: fromDB}
+		to := &fsops.FS{Backend: toBackend, DB: toDB}
+
+		var opts fsops.ImportOptions
+		if !copyQuiet {
+			opts.Progress = func(progress fsops.ImportProgress) {
+				fmt.Fprintf(os.Stderr, "\r%d dirs, %d files, %d bytes copied, %d skipped",
+					progress.Dirs, progress.Files, progress.Bytes, progress.Skipped)
+			}
+		}
+
+		err = fsops.CopyTree(from, to, opts)
+		if !copyQuiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if copyNoVerify {
+			return
+		}
+
+		counts, err := fsops.VerifyCopy(from, to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !copyQuiet {
+			fmt.Fprintf(os.Stderr, "Verified %d dirs, %d files, %d bytes\n", counts.Dirs, counts.Files, counts.Bytes)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+
+	copyCmd.Flags().StringVar(&copyFrom, "from", "", "SQL URI to copy from [backend://dsn]")
+	copyCmd.Flags().StringVar(&copyTo, "to", "", "SQL URI to copy to [backend://dsn]")
+	copyCmd.Flags().BoolVar(&copyNoVerify, "no-verify", false, "Don't compare the dbs after copying")
+	copyCmd.Flags().BoolVarP(&copyQuiet, "quiet", "q", false, "Don't print progress")
+	copyCmd.MarkFlagRequired("from")
+	copyCmd.MarkFlagRequired("to")
+}
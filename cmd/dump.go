@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var dumpFile string
+var dumpCompress bool
+
+// dumpCmd represents the dump command
+//
+// Writes the whole fs as a portable dump
+var dumpCmd = &cobra.Command{
+	Use:   "dump [flags]",
+	Short: "Write the whole fs as a portable dump",
+	Long: `Writes the whole fs, with its metadata, tree and contents, to stdout or
+the file given with -f. The dump doesn't depend on the backend and can be
+restored into any of them with sqlfs restore. File contents are split into
+chunks, and the dump can be compressed with gzip using -z.
+
+The format is versioned and documented in the pkg/dump package.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		var w io.Writer = os.Stdout
+		var file *os.File
+		if dumpFile != "-" {
+			var err error
+			if file, err = os.Create(dumpFile); err != nil {
+				log.Fatal(err)
+			}
+			w = file
+		}
+
+		if err := f.Dump(w, dumpCompress); err != nil {
+			log.Fatal(err)
+		}
+
+		if file != nil {
+			if err := file.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dumpCmd)
+
+	dumpCmd.Flags().StringVarP(&dumpFile, "file", "f", "-", "File to write the dump to, - for stdout")
+	dumpCmd.Flags().BoolVarP(&dumpCompress, "gzip", "z", false, "Compress the dump with gzip")
+}
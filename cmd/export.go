@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+var exportQuiet bool
+
+// exportCmd represents the export command
+//
+// Copies a tree from the fs to local disk
+var exportCmd = &cobra.Command{
+	Use:   "export [flags] [SRC] DEST",
+	Short: "Export a tree from the fs to local disk",
+	Long: `Exports SRC, which defaults to the root of the fs, to the local path
+DEST. The contents of a directory are copied into DEST, which is created if
+needed, and existing files are overwritten.
+
+Modes and mtimes are preserved, and so is ownership when running as root.
+File contents are streamed from the db in chunks, so large files aren't loaded
+into memory. sqlfs doesn't store symlinks or extended attributes, so there are
+none to export.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		src, dest := "/", args[0]
+		if len(args) > 1 {
+			src, dest = args[0], args[1]
+		}
+
+		var progress func(fsops.ExportProgress)
+		if !exportQuiet {
+			progress = func(progress fsops.ExportProgress) {
+				fmt.Fprintf(os.Stderr, "\r%d files, %d bytes exported", progress.Files, progress.Bytes)
+			}
+		}
+
+		err := f.Export(src, dest, progress)
+		if !exportQuiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().BoolVarP(&exportQuiet, "quiet", "q", false, "Don't print progress")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/fuse"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// openFS opens and verifies the db for commands which work without a mount
+func openFS() *fsops.FS {
+	db, err := fuse.Backend.OpenDB(sqlDSN)
+	if err != nil {
+		log.Fatalf("Couldn't open DB: %v", err)
+	}
+
+	if err := fuse.Backend.VerifyDB(db); err != nil {
+		log.Fatalf("SQL DB Verification failed: %v", err)
+	}
+
+	return &fsops.FS{Backend: fuse.Backend, DB: db}
+}
+
+// destPath returns dest, or dest/name if dest is an existing directory
+func destPath(f *fsops.FS, dest, name string) string {
+	metadata, err := f.Stat(dest)
+	if err == nil && fsops.IsDir(metadata) {
+		return path.Join(fsops.Clean(dest), name)
+	}
+
+	return dest
+}
+
+// printLong prints metadata in the format of ls -l
+func printLong(metadata sqlutils.Metadata) {
+	fmt.Printf("%s %6d %6d %10d %s %s\n",
+		fsops.FileMode(metadata), metadata.Uid, metadata.Gid, metadata.Size,
+		fsops.Time(metadata.Mtime).Format("Jan _2 15:04 2006"), metadata.Name)
+}
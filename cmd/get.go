@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+// getCmd represents the get command
+//
+// Copies a file from the fs to local disk without mounting it
+var getCmd = &cobra.Command{
+	Use:   "get SRC [LOCAL]",
+	Short: "Copy a file from the fs to local disk",
+	Long: `Copies a file from the fs, straight from the SQL db, to local disk.
+
+LOCAL defaults to the name of SRC in the current directory, and can be - to
+write to stdout. If LOCAL is a directory, the file is put inside it.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		src := args[0]
+		local := path.Base(fsops.Clean(src))
+		if len(args) > 1 {
+			local = args[1]
+		}
+
+		metadata, err := f.Stat(src)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		reader, err := f.Open(src)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if local == "-" {
+			_, err = io.Copy(os.Stdout, reader)
+		} else {
+			if fileinfo, statErr := os.Stat(local); statErr == nil && fileinfo.IsDir() {
+				local = local + "/" + metadata.Name
+			}
+
+			var file *os.File
+			if file, err = os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fsops.FileMode(metadata).Perm()); err == nil {
+				if _, err = io.Copy(file, reader); err == nil {
+					err = file.Close()
+				} else {
+					file.Close()
+				}
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+}
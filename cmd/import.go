@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+var importBatchSize int
+var importBatchBytes int64
+var importQuiet bool
+
+// importCmd represents the import command
+//
+// Bulk loads a local directory tree into the fs
+var importCmd = &cobra.Command{
+	Use:   "import [flags] SRC [DEST]",
+	Short: "Import a local directory tree into the fs",
+	Long: `Imports everything under the local directory SRC into DEST, which
+defaults to the root of the fs and is created if needed.
+
+Modes, ownership and timestamps are preserved. Entries are inserted in large
+transactions (using COPY on postgres and multi-row inserts on mysql), which is
+much faster than copying through a mount.
+
+An interrupted import can be resumed by running it again: files which exist
+with the same size and mtime are skipped. Only regular files and directories
+are imported.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		dest := "/"
+		if len(args) > 1 {
+			dest = args[1]
+		}
+
+		opts := fsops.ImportOptions{
+			BatchEntries: importBatchSize,
+			BatchBytes:   importBatchBytes,
+		}
+		if !importQuiet {
+			opts.Progress = func(progress fsops.ImportProgress) {
+				fmt.Fprintf(os.Stderr, "\r%d dirs, %d files, %d bytes imported, %d skipped",
+					progress.Dirs, progress.Files, progress.Bytes, progress.Skipped)
+			}
+		}
+
+		err := f.Import(args[0], dest, opts)
+		if !importQuiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().IntVar(&importBatchSize, "batch-size", 1000, "Files and directories inserted per transaction")
+	importCmd.Flags().Int64Var(&importBatchBytes, "batch-bytes", 64<<20, "Bytes of file contents inserted per transaction")
+	importCmd.Flags().BoolVarP(&importQuiet, "quiet", "q", false, "Don't print progress")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// infoCmd represents the info command
+//
+// Shows how much space the fs takes up
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show how much space the fs takes up",
+	Long: `Shows the number of files and directories, the total size of file contents,
+the space the fs tables take up in the database (where the backend can tell),
+and how much deduplication of identical file contents and compression save.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		usage, err := f.Backend.GetUsage(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		dedupEnabled, err := sqlutils.GetDedup(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dedupState := "off"
+		if dedupEnabled {
+			dedupState = "on"
+		}
+
+		dedup, err := sqlutils.GetDedupStats(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		c, err := sqlutils.GetCompression(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if c == sqlutils.CompressionNone {
+			c = "none"
+		}
+
+		compression, err := sqlutils.GetCompressionStats(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		dbSize := "unknown"
+		if usage.DBSize > 0 {
+			dbSize = formatSize(usage.DBSize)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "Inodes:\t%d\n", usage.Inodes)
+		fmt.Fprintf(w, "File contents:\t%s\n", formatSize(usage.Bytes))
+		fmt.Fprintf(w, "Database size:\t%s\n", dbSize)
+		fmt.Fprintf(w, "Deduplicated:\t%s, %d files, %s in %d chunks of %s\n", dedupState,
+			dedup.Files, formatSize(dedup.Bytes), dedup.Chunks, formatSize(dedup.ChunkBytes))
+		fmt.Fprintf(w, "Dedup ratio:\t%.2fx\n", dedup.Ratio())
+		fmt.Fprintf(w, "Compression:\t%s, %s stored as %s\n", c,
+			formatSize(compression.Bytes), formatSize(compression.StoredBytes))
+		fmt.Fprintf(w, "Compression ratio:\t%.2fx\n", compression.Ratio())
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+}
@@ -2,12 +2,21 @@ package cmd
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/yoogottamk/sqlfs/pkg/fuse"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
 )
 
+var keepVersions int64
+var versionMaxAge time.Duration
+var trashEnabled bool
+var trashRetention time.Duration
+var compression string
+var dedup bool
+
 // initCmd represents the init command
 //
 // Initializes sql db (creates necessary tables and rows)
@@ -16,14 +25,91 @@ var initCmd = &cobra.Command{
 	Short: "Initialize the SQL db",
 	Long: `Initializes the SQL db
 
-Creates necessary tables and adds the rootdir inode entry`,
+Creates necessary tables and adds the rootdir inode entry. Running it again on
+an existing db adds the tables newer versions of sqlfs need, and changes the
+settings passed to it.
+
+Previous versions of files are kept if --keep-versions or --version-max-age is
+set, see sqlfs versions. Removed files and directories are moved to the trash
+if --trash is set, see sqlfs trash.
+
+File contents are compressed with --compression, if that makes them at least
+10% smaller. Identical file contents of 4KiB or more are stored once if
+--dedup is set. Changing either only affects contents written afterwards.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := fuse.InitializeDB(sqlDSN); err != nil {
 			log.Fatal(err)
 		}
+
+		changed := cmd.Flags().Changed
+		versions := changed("keep-versions") || changed("version-max-age")
+		trash := changed("trash") || changed("trash-retention")
+		if !versions && !trash && !changed("compression") && !changed("dedup") {
+			return
+		}
+
+		f := openFS()
+
+		if changed("compression") {
+			c, err := sqlutils.ParseCompression(compression)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := sqlutils.SetCompression(f.DB, c); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if changed("dedup") {
+			if err := sqlutils.SetDedup(f.DB, dedup); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if versions {
+			opts, err := sqlutils.GetVersionOptions(f.DB)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if changed("keep-versions") {
+				opts.Keep = keepVersions
+			}
+			if changed("version-max-age") {
+				opts.MaxAge = versionMaxAge
+			}
+
+			if err := sqlutils.SetVersionOptions(f.DB, opts); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if trash {
+			opts, err := sqlutils.GetTrashOptions(f.DB)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if changed("trash") {
+				opts.Enabled = trashEnabled
+			}
+			if changed("trash-retention") {
+				opts.Retention = trashRetention
+			}
+
+			if err := sqlutils.SetTrashOptions(f.DB, opts); err != nil {
+				log.Fatal(err)
+			}
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().Int64Var(&keepVersions, "keep-versions", 0, "Keep up to N previous versions of each file (0 for no limit if --version-max-age is set)")
+	initCmd.Flags().DurationVar(&versionMaxAge, "version-max-age", 0, "Keep previous versions of files this long, like 720h (0 for no limit if --keep-versions is set)")
+	initCmd.Flags().BoolVar(&trashEnabled, "trash", false, "Move removed files and directories to the trash (--trash=false to stop)")
+	initCmd.Flags().DurationVar(&trashRetention, "trash-retention", 0, "Purge the trash of what was removed longer than this ago, like 720h (0 to keep it until purged)")
+	initCmd.Flags().StringVar(&compression, "compression", "none", "Compression of file contents: none, gzip or zstd")
+	initCmd.Flags().BoolVar(&dedup, "dedup", false, "Store identical file contents of 4KiB or more once (--dedup=false to stop)")
 }
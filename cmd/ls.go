@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+var lsLong bool
+
+// lsCmd represents the ls command
+//
+// Lists directory contents without mounting the fs
+var lsCmd = &cobra.Command{
+	Use:   "ls [flags] [PATH...]",
+	Short: "List directory contents",
+	Long: `Lists directory contents, straight from the SQL db.
+
+PATH defaults to the root of the fs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		if len(args) == 0 {
+			args = []string{"/"}
+		}
+
+		for i, p := range args {
+			metadata, err := f.Stat(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			entries := []sqlutils.Metadata{metadata}
+			if fsops.IsDir(metadata) {
+				if entries, err = f.ReadDir(p); err != nil {
+					log.Fatal(err)
+				}
+
+				if len(args) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("%s:\n", p)
+				}
+			}
+
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].Name < entries[j].Name
+			})
+
+			for _, entry := range entries {
+				if lsLong {
+					printLong(entry)
+				} else {
+					fmt.Println(entry.Name)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+
+	lsCmd.Flags().BoolVarP(&lsLong, "long", "l", false, "Use a long listing format")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var mkdirParents bool
+
+// mkdirCmd represents the mkdir command
+//
+// Creates directories without mounting the fs
+var mkdirCmd = &cobra.Command{
+	Use:   "mkdir [flags] PATH...",
+	Short: "Create directories",
+	Long:  "Creates directories, straight in the SQL db.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, p := range args {
+			var err error
+			if mkdirParents {
+				err = f.MkdirAll(p)
+			} else {
+				err = f.Mkdir(p)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mkdirCmd)
+
+	mkdirCmd.Flags().BoolVarP(&mkdirParents, "parents", "p", false, "Create parent directories as needed, no error if existing")
+}
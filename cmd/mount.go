@@ -2,12 +2,26 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/yoogottamk/sqlfs/pkg/daemon"
 	"github.com/yoogottamk/sqlfs/pkg/fuse"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
 )
 
+var mountOptions fuse.MountOptions
+var mountDaemon bool
+var mountPidfile string
+var mountLogFile string
+var mountUid uint32
+var mountGid uint32
+var mountSnapshot string
+
 // mountCmd represents the mount command
 //
 // Mounts the fuse fs after verification
@@ -16,15 +30,105 @@ var mountCmd = &cobra.Command{
 	Short: "Mount the FUSE fs",
 	Long: `Mounts the FUSE fs.
 
-Verifies the DB tables/rows and mounts it.`,
+Verifies the DB tables/rows and mounts it. Runs until the fs is unmounted.
+
+On SIGINT (Ctrl-C) or SIGTERM, the fs is unmounted, the requests in flight are
+finished and the DB is closed. If the fs is still busy after --unmount-timeout,
+it's detached lazily.
+
+With --snapshot, a snapshot created with sqlfs snapshot create is mounted
+read-only instead of the live fs.
+
+With --daemon, sqlfs goes into the background once the fs is mounted, and
+exits with an error if mounting fails. The mount also reports readiness to
+systemd through sd_notify, so it can run in the foreground of a Type=notify
+unit.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := fuse.MountFS(sqlDSN, args[0]); err != nil {
+		if mountDaemon && !daemon.IsDaemon() {
+			pid, err := daemon.Start(os.Args[1:], mountLogFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Printf("Mounted %s, running in the background with pid %d\n", args[0], pid)
+			return
+		}
+
+		opts := mountOptions
+		if opts.FSName == "" {
+			opts.FSName = redactURI(sqlURI)
+		}
+		if mountSnapshot != "" {
+			fuse.Backend = sqlutils.NewSnapshotBackend(fuse.Backend, mountSnapshot)
+			opts.ReadOnly = true
+		}
+		if cmd.Flags().Changed("uid") {
+			opts.Uid = &mountUid
+		}
+		if cmd.Flags().Changed("gid") {
+			opts.Gid = &mountGid
+		}
+		opts.Ready = func() {
+			if mountPidfile != "" {
+				if err := daemon.WritePidfile(mountPidfile); err != nil {
+					log.Printf("Couldn't write pidfile: %v\n", err)
+				}
+			}
+
+			daemon.Ready(nil)
+		}
+
+		err := fuse.MountFS(sqlDSN, args[0], opts)
+		if mountPidfile != "" {
+			os.Remove(mountPidfile)
+		}
+		if err != nil {
+			daemon.Ready(err)
 			log.Fatal(err)
 		}
 	},
 }
 
+// userPassword matches the password in user:password@ at the start of a DSN
+var userPassword = regexp.MustCompile(`^([^:@/]*):[^@]*@`)
+
+// passwordParam matches password parameters of keyword/value or URL DSNs,
+// along with the separator after them
+var passwordParam = regexp.MustCompile(`(^|[\s?&])password=('(\\.|[^'])*'|[^\s&]*)[\s&]*`)
+
+// redactURI returns uri without any password in it
+func redactURI(uri string) string {
+	scheme, dsn, found := strings.Cut(uri, "://")
+	if !found {
+		return uri
+	}
+
+	dsn = userPassword.ReplaceAllString(dsn, "$1@")
+	dsn = passwordParam.ReplaceAllString(dsn, "$1")
+
+	// a password parameter at the end leaves its separator behind
+	return scheme + "://" + strings.TrimRight(strings.TrimSpace(dsn), "?&")
+}
+
 func init() {
 	rootCmd.AddCommand(mountCmd)
+
+	mountCmd.Flags().BoolVar(&mountOptions.ReadOnly, "read-only", false, "Mount the fs read-only")
+	mountCmd.Flags().StringVar(&mountSnapshot, "snapshot", "", "Mount this snapshot, read-only, instead of the live fs")
+	mountCmd.Flags().BoolVar(&mountOptions.AllowOther, "allow-other", false, "Allow other users to access the fs (needs user_allow_other in /etc/fuse.conf)")
+	mountCmd.Flags().BoolVar(&mountOptions.DefaultPermissions, "default-permissions", false, "Let the kernel check access using file modes and owners")
+	mountCmd.Flags().Uint32Var(&mountUid, "uid", 0, "Report every file as owned by this uid")
+	mountCmd.Flags().Uint32Var(&mountGid, "gid", 0, "Report every file as owned by this gid")
+	mountCmd.Flags().BoolVar(&mountOptions.NoAtime, "noatime", false, "Don't update access times on reads")
+	mountCmd.Flags().StringVar(&mountOptions.FSName, "fsname", "", "Source shown by mount and df (default the URI without its password)")
+	mountCmd.Flags().StringVar(&mountOptions.Subtype, "subtype", "sqlfs", "Type shown by mount and df, as fuse.SUBTYPE")
+	mountCmd.Flags().Uint32Var(&mountOptions.MaxReadahead, "max-readahead", 0, "Most bytes the kernel reads ahead (default the kernel's)")
+	mountCmd.Flags().BoolVar(&mountOptions.AsyncRead, "async-read", false, "Let the kernel send multiple reads of a file at once")
+	mountCmd.Flags().BoolVar(&mountOptions.WritebackCache, "writeback-cache", false, "Let the kernel buffer writes and send them in bigger chunks")
+	mountCmd.Flags().Var((*sizeValue)(&mountOptions.Capacity), "capacity", "Size of the fs reported to df, like 10G (default unlimited)")
+	mountCmd.Flags().BoolVarP(&mountDaemon, "daemon", "d", false, "Run in the background once the fs is mounted")
+	mountCmd.Flags().StringVar(&mountPidfile, "pidfile", "", "Write the pid of the mount process to this file")
+	mountCmd.Flags().StringVar(&mountLogFile, "log-file", "", "Append logs to this file when running with --daemon, instead of discarding them")
+	mountCmd.Flags().DurationVar(&mountOptions.UnmountTimeout, "unmount-timeout", 10*time.Second, "How long to wait for a busy fs to be unmounted on SIGINT/SIGTERM")
 }
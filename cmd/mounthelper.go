@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MountHelperName is the name mount(8) runs sqlfs by, for fstab entries of
+// type sqlfs
+const MountHelperName = "mount.sqlfs"
+
+// ignoredMountOptions are passed by mount(8) or used by systemd and have no
+// meaning for sqlfs
+var ignoredMountOptions = map[string]bool{
+	"defaults": true, "rw": true, "auto": true, "noauto": true,
+	"user": true, "nouser": true, "users": true, "owner": true, "group": true,
+	"_netdev": true, "nofail": true, "exec": true, "noexec": true,
+	"suid": true, "nosuid": true, "dev": true, "nodev": true,
+	"async": true, "atime": true, "relatime": true, "strictatime": true,
+}
+
+// mountFlagOptions map mount options to mount command flags
+var mountFlagOptions = map[string]string{
+	"ro":                  "--read-only",
+	"allow_other":         "--allow-other",
+	"default_permissions": "--default-permissions",
+	"noatime":             "--noatime",
+	"async_read":          "--async-read",
+	"writeback_cache":     "--writeback-cache",
+}
+
+// mountValueOptions map mount options with values to mount command flags
+var mountValueOptions = map[string]string{
+	"uid": "--uid",
+	"gid": "--gid",
+
+	"fsname":        "--fsname",
+	"subtype":       "--subtype",
+	"max_readahead": "--max-readahead",
+
+	// sqlfs options
+	"capacity":        "--capacity",
+	"table_prefix":    "--table-prefix",
+	"schema":          "--schema",
+	"snapshot":        "--snapshot",
+	"pidfile":         "--pidfile",
+	"log_file":        "--log-file",
+	"unmount_timeout": "--unmount-timeout",
+}
+
+// ExecuteMountHelper mounts the fs like mount(8) expects of mount.sqlfs:
+//
+//	mount.sqlfs URI MOUNTPOINT [-sfnv] [-o opt[=value],...]
+//
+// Options are translated into the flags of sqlfs mount, and the fs is
+// mounted in the background
+func ExecuteMountHelper(args []string) {
+	mountArgs, fake, err := parseMountHelperArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\nUsage: %s URI MOUNTPOINT [-sfnv] [-o opt[=value],...]\n", err, MountHelperName)
+		os.Exit(1)
+	}
+
+	if fake {
+		return
+	}
+
+	// the daemon reruns the executable, which is this one, with os.Args[1:],
+	// which has to be a sqlfs command line. main runs it as sqlfs, not as the
+	// mount helper
+	os.Args = append([]string{os.Args[0]}, mountArgs...)
+	rootCmd.SetArgs(mountArgs)
+
+	Execute()
+}
+
+// parseMountHelperArgs translates the arguments of mount.sqlfs into those of
+// sqlfs mount. It also reports whether -f (fake) was given
+func parseMountHelperArgs(args []string) ([]string, bool, error) {
+	var positional, options []string
+	var sloppy, fake bool
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "-o":
+			if i+1 == len(args) {
+				return nil, false, fmt.Errorf("-o needs options")
+			}
+			i++
+			options = append(options, strings.Split(args[i], ",")...)
+		case strings.HasPrefix(arg, "-o"):
+			options = append(options, strings.Split(arg[2:], ",")...)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for _, flag := range arg[1:] {
+				switch flag {
+				case 's':
+					sloppy = true
+				case 'f':
+					fake = true
+				case 'n', 'v':
+					// no mtab to skip, nothing more to say
+				default:
+					return nil, false, fmt.Errorf("unknown flag -%c", flag)
+				}
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) != 2 {
+		return nil, false, fmt.Errorf("expected URI and MOUNTPOINT")
+	}
+
+	mountArgs := []string{"mount", "--daemon", "--uri", positional[0]}
+	for _, option := range options {
+		name, value, hasValue := strings.Cut(option, "=")
+
+		flag, isFlag := mountFlagOptions[name]
+		valueFlag, takesValue := mountValueOptions[name]
+
+		switch {
+		case option == "" || ignoredMountOptions[name] || strings.HasPrefix(name, "x-") || name == "comment":
+		case isFlag && !hasValue:
+			mountArgs = append(mountArgs, flag)
+		case takesValue && hasValue:
+			mountArgs = append(mountArgs, valueFlag+"="+value)
+		case takesValue:
+			return nil, false, fmt.Errorf("option %s needs a value", name)
+		case !sloppy:
+			return nil, false, fmt.Errorf("unknown option %s", option)
+		}
+	}
+
+	return append(mountArgs, positional[1]), fake, nil
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMountHelperArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		fake     bool
+		err      bool
+	}{
+		{
+			name:     "no options",
+			args:     []string{"sqlite:///fs.sql", "/mnt"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "/mnt"},
+		},
+		{
+			name:     "flag options",
+			args:     []string{"sqlite:///fs.sql", "/mnt", "-o", "ro,allow_other"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "--read-only", "--allow-other", "/mnt"},
+		},
+		{
+			name:     "options joined to -o",
+			args:     []string{"-onoatime", "sqlite:///fs.sql", "/mnt"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "--noatime", "/mnt"},
+		},
+		{
+			name:     "value options",
+			args:     []string{"sqlite:///fs.sql", "/mnt", "-o", "uid=1000,capacity=1G", "-o", "table_prefix=fs_"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "--uid=1000", "--capacity=1G", "--table-prefix=fs_", "/mnt"},
+		},
+		{
+			name:     "ignored options",
+			args:     []string{"sqlite:///fs.sql", "/mnt", "-o", "defaults,_netdev,x-systemd.automount,comment=x,,rw"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "/mnt"},
+		},
+		{
+			name: "unknown option",
+			args: []string{"sqlite:///fs.sql", "/mnt", "-o", "nosuchoption"},
+			err:  true,
+		},
+		{
+			name:     "unknown option with -s",
+			args:     []string{"-s", "sqlite:///fs.sql", "/mnt", "-o", "nosuchoption,ro"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "--read-only", "/mnt"},
+		},
+		{
+			name: "flag option with a value",
+			args: []string{"sqlite:///fs.sql", "/mnt", "-o", "ro=1"},
+			err:  true,
+		},
+		{
+			name: "value option without a value",
+			args: []string{"sqlite:///fs.sql", "/mnt", "-o", "uid"},
+			err:  true,
+		},
+		{
+			name:     "fake",
+			args:     []string{"-fnv", "sqlite:///fs.sql", "/mnt"},
+			expected: []string{"mount", "--daemon", "--uri", "sqlite:///fs.sql", "/mnt"},
+			fake:     true,
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-x", "sqlite:///fs.sql", "/mnt"},
+			err:  true,
+		},
+		{
+			name: "-o without options",
+			args: []string{"sqlite:///fs.sql", "/mnt", "-o"},
+			err:  true,
+		},
+		{
+			name: "missing mountpoint",
+			args: []string{"sqlite:///fs.sql"},
+			err:  true,
+		},
+		{
+			name: "extra argument",
+			args: []string{"sqlite:///fs.sql", "/mnt", "/other"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mountArgs, fake, err := parseMountHelperArgs(test.args)
+			if test.err {
+				if err == nil {
+					t.Errorf("parseMountHelperArgs(%q) returned %q, expected an error", test.args, mountArgs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Couldn't parse %q: %v", test.args, err)
+			}
+			if !reflect.DeepEqual(mountArgs, test.expected) {
+				t.Errorf("parseMountHelperArgs(%q) = %q, expected %q", test.args, mountArgs, test.expected)
+			}
+			if fake != test.fake {
+				t.Errorf("parseMountHelperArgs(%q) returned fake %v, expected %v", test.args, fake, test.fake)
+			}
+		})
+	}
+}
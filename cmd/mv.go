@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"log"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+// mvCmd represents the mv command
+//
+// Moves or renames files and directories without mounting the fs
+var mvCmd = &cobra.Command{
+	Use:   "mv SRC DEST",
+	Short: "Move or rename a file or directory",
+	Long: `Moves or renames a file or directory, straight in the SQL db.
+
+If DEST is a directory, SRC is moved inside it. Otherwise DEST is replaced.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		src := args[0]
+		dest := destPath(f, args[1], path.Base(fsops.Clean(src)))
+
+		if err := f.Rename(src, dest); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mvCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+// putCmd represents the put command
+//
+// Copies a local file into the fs without mounting it
+var putCmd = &cobra.Command{
+	Use:   "put LOCAL [DEST]",
+	Short: "Copy a local file into the fs",
+	Long: `Copies a local file into the fs, straight into the SQL db.
+
+LOCAL can be - to read from stdin, in which case DEST must be the path of the
+file to write. Otherwise DEST defaults to the root of the fs, and if DEST is a
+directory, the file is put inside it. Existing files are overwritten.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		local := args[0]
+		dest := "/"
+		if len(args) > 1 {
+			dest = args[1]
+		}
+
+		var data []byte
+		var err error
+		perm := os.FileMode(0644)
+
+		if local == "-" {
+			// there's no name to give the file inside a directory
+			if metadata, err := f.Stat(dest); err == nil && fsops.IsDir(metadata) {
+				log.Fatalf("%s is a directory, pass the path of the file to write stdin to", dest)
+			}
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			var fileinfo os.FileInfo
+			if fileinfo, err = os.Stat(local); err == nil {
+				perm = fileinfo.Mode().Perm()
+				data, err = os.ReadFile(local)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err = f.WriteFile(destPath(f, dest, filepath.Base(local)), data, perm); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(putCmd)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+var quotaUser string
+var quotaGroup string
+var quotaProject string
+var quotaBytes int64
+var quotaInodes int64
+
+// quotaCmd represents the quota command
+//
+// Groups the quota set, get and report commands
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Short: "Manage quotas on bytes and inodes",
+	Long: `Limits the bytes and inodes used by the files of a user, a group, or under
+a directory (a project).
+
+Creating files or directories, or growing files, past a limit fails with
+EDQUOT ("Disk quota exceeded"). Files and directories are owned by the user
+and group which mounted the fs, unless changed with chown. Imports, copies,
+restores and renames aren't checked.`,
+}
+
+// quotaSetCmd represents the quota set command
+//
+// Sets the limits of a quota
+var quotaSetCmd = &cobra.Command{
+	Use:   "set (--user USER | --group GROUP | --project PATH) [--bytes SIZE] [--inodes N]",
+	Short: "Set the limits of a quota",
+	Long: `Sets the limits of the quota of a user, group or project. Limits not given
+are left as they were, and 0 means no limit. A quota with no limits is removed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("bytes") && !cmd.Flags().Changed("inodes") {
+			log.Fatal("Nothing to set, pass --bytes or --inodes")
+		}
+		if quotaInodes < 0 {
+			log.Fatal("--inodes can't be negative")
+		}
+
+		f := openFS()
+
+		kind, id, err := quotaTarget(f, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		usage, err := sqlutils.GetQuota(f.DB, kind, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		quota := usage.Quota
+		if cmd.Flags().Changed("bytes") {
+			quota.MaxBytes = quotaBytes
+		}
+		if cmd.Flags().Changed("inodes") {
+			quota.MaxInodes = quotaInodes
+		}
+
+		if err := sqlutils.SetQuota(f.DB, quota); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// quotaGetCmd represents the quota get command
+//
+// Shows the limits and usage of a quota
+var quotaGetCmd = &cobra.Command{
+	Use:   "get [--user USER | --group GROUP | --project PATH]",
+	Short: "Show the limits and usage of a quota",
+	Long: `Shows the limits and usage of the quota of a user, group or project,
+by default the current user.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		kind, id, err := quotaTarget(f, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		usage, err := sqlutils.GetQuota(f.DB, kind, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		printQuotas(f, []sqlutils.QuotaUsage{usage})
+	},
+}
+
+// quotaReportCmd represents the quota report command
+//
+// Shows the limits and usage of all quotas
+var quotaReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Show the limits and usage of all quotas",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		usages, err := sqlutils.GetQuotas(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		printQuotas(f, usages)
+	},
+}
+
+// quotaTarget returns the quota kind and id selected by --user, --group or
+// --project. Without any, it's the current user unless required is set
+func quotaTarget(f *fsops.FS, required bool) (sqlutils.QuotaKind, int64, error) {
+	var n int
+	for _, s := range []string{quotaUser, quotaGroup, quotaProject} {
+		if s != "" {
+			n++
+		}
+	}
+
+	switch {
+	case n > 1:
+		return "", 0, errors.New("Pass only one of --user, --group and --project")
+	case n == 0 && required:
+		return "", 0, errors.New("Pass one of --user, --group and --project")
+	case quotaUser != "":
+		id, err := lookupID(quotaUser, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		return sqlutils.QuotaUser, id, err
+	case quotaGroup != "":
+		id, err := lookupID(quotaGroup, func(name string) (string, error) {
+			group, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return group.Gid, nil
+		})
+		return sqlutils.QuotaGroup, id, err
+	case quotaProject != "":
+		metadata, err := f.Stat(quotaProject)
+		if err != nil {
+			return "", 0, err
+		}
+		if !fsops.IsDir(metadata) {
+			return "", 0, fmt.Errorf("%s: projects have to be directories", quotaProject)
+		}
+		return sqlutils.QuotaProject, metadata.Inode, nil
+	default:
+		return sqlutils.QuotaUser, int64(os.Getuid()), nil
+	}
+}
+
+// lookupID returns name as a number, or the id lookup finds for it
+func lookupID(name string, lookup func(name string) (string, error)) (int64, error) {
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(id, 10, 64)
+}
+
+// quotaName returns the name of the user, group or project of a quota
+func quotaName(f *fsops.FS, quota sqlutils.Quota) string {
+	id := strconv.FormatInt(quota.ID, 10)
+
+	switch quota.Kind {
+	case sqlutils.QuotaUser:
+		if u, err := user.LookupId(id); err == nil {
+			return u.Username
+		}
+	case sqlutils.QuotaGroup:
+		if group, err := user.LookupGroupId(id); err == nil {
+			return group.Name
+		}
+	case sqlutils.QuotaProject:
+		if p, err := sqlutils.GetPathForInode(f.DB, quota.ID); err == nil {
+			return p
+		}
+	}
+
+	return id
+}
+
+// printQuotas prints usages as a table, with - for no limit
+func printQuotas(f *fsops.FS, usages []sqlutils.QuotaUsage) {
+	limit := func(n int64, format func(int64) string) string {
+		if n == 0 {
+			return "-"
+		}
+		return format(n)
+	}
+	count := func(n int64) string {
+		return strconv.FormatInt(n, 10)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tBYTES\tLIMIT\tINODES\tLIMIT")
+	for _, usage := range usages {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			usage.Kind, quotaName(f, usage.Quota),
+			formatSize(usage.Bytes), limit(usage.MaxBytes, formatSize),
+			usage.Inodes, limit(usage.MaxInodes, count))
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+	quotaCmd.AddCommand(quotaSetCmd)
+	quotaCmd.AddCommand(quotaGetCmd)
+	quotaCmd.AddCommand(quotaReportCmd)
+
+	for _, cmd := range []*cobra.Command{quotaSetCmd, quotaGetCmd} {
+		cmd.Flags().StringVar(&quotaUser, "user", "", "User name or uid")
+		cmd.Flags().StringVar(&quotaGroup, "group", "", "Group name or gid")
+		cmd.Flags().StringVar(&quotaProject, "project", "", "Directory on the fs, limiting everything under it")
+	}
+	quotaSetCmd.Flags().Var((*sizeValue)(&quotaBytes), "bytes", "Most bytes of file contents, like 10G (0 for no limit)")
+	quotaSetCmd.Flags().Int64Var(&quotaInodes, "inodes", 0, "Most files and directories (0 for no limit)")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/fuse"
+)
+
+var restoreFile string
+var restoreQuiet bool
+
+// restoreCmd represents the restore command
+//
+// Restores a dump written by sqlfs dump
+var restoreCmd = &cobra.Command{
+	Use:   "restore [flags]",
+	Short: "Restore a dump into an empty fs",
+	Long: `Restores a dump written by sqlfs dump, read from stdin or the file given
+with -f. The db is initialized if needed and the fs must be empty. Inode
+numbers, metadata and contents are restored as they were dumped, and the
+checksum of the dump is verified.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := fuse.InitializeDB(sqlDSN); err != nil {
+			log.Fatal(err)
+		}
+		f := openFS()
+
+		var r io.Reader = os.Stdin
+		if restoreFile != "-" {
+			file, err := os.Open(restoreFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			r = file
+		}
+
+		var opts fsops.ImportOptions
+		if !restoreQuiet {
+			opts.Progress = func(progress fsops.ImportProgress) {
+				fmt.Fprintf(os.Stderr, "\r%d dirs, %d files, %d bytes restored",
+					progress.Dirs, progress.Files, progress.Bytes)
+			}
+		}
+
+		err := f.Restore(r, opts)
+		if !restoreQuiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringVarP(&restoreFile, "file", "f", "-", "File to read the dump from, - for stdin")
+	restoreCmd.Flags().BoolVarP(&restoreQuiet, "quiet", "q", false, "Don't print progress")
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+var rmRecursive bool
+
+// rmCmd represents the rm command
+//
+// Removes files and directories without mounting the fs
+var rmCmd = &cobra.Command{
+	Use:   "rm [flags] PATH...",
+	Short: "Remove files or directories",
+	Long: `Removes files or directories, straight from the SQL db.
+
+Directories must be empty unless -r is given.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, p := range args {
+			var err error
+			if rmRecursive {
+				err = f.RemoveAll(p)
+			} else {
+				err = f.Remove(p)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "Remove directories and their contents")
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"reflect"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -15,19 +14,26 @@ import (
 
 var sqlURI string
 var sqlDSN string
-
-var availableBackends = reflect.ValueOf(sqlutils.AvaialableBackends).MapKeys()
+var tablePrefix string
+var schema string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:              "sqlfs",
 	Short:            "FUSE fs built on sql",
 	PersistentPreRun: setFuseBackendFromFlag,
-	Long: fmt.Sprintf(`A FUSE filesystem that stores information on SQL databases.
+	Long: `A FUSE filesystem that stores information on SQL databases.
 
 Available backends: %s
 
-* DSN for sqlite: filepath
+* DSN for sqlite: filepath[?option=value&...]
+
+    Options: journal_mode (default wal), synchronous (default normal),
+    busy_timeout in ms (default 5000), cache_size, mmap_size.
+    foreign_keys is always on.
+
+    sqlite-purego uses a driver which doesn't need cgo. sqlite uses it too
+    when sqlfs is built with CGO_ENABLED=0 or the purego build tag.
 
 * DSN for mysql: [username[:password]@][protocol[(address)]]/dbname[?param1=value1&...&paramN=valueN]
 
@@ -38,32 +44,65 @@ Available backends: %s
 
     More information can be found here: https://github.com/go-sql-driver/mysql
 
-* DSN for postgres: username:password@address/dbname
+* DSN for postgres: a libpq connection URL without the scheme or a
+  keyword/value connection string, e.g.
+
+        username:password@address/dbname?sslmode=verify-full&sslrootcert=ca.pem
+        host=/var/run/postgresql dbname=sqlfs application_name=backup
+
+    Anything not in the DSN is taken from the PG* environment variables
+    (PGHOST, PGUSER, PGPASSFILE, PGSSLMODE, ...). sslmode defaults to disable.
+
+    More information can be found here: https://pkg.go.dev/github.com/lib/pq
+
+* DSN for cockroach: same as postgres
+
+Tables are named metadata, filedata and parent, plus quota, setting, version,
+trash, chunk and the snapshot tables. Use --table-prefix to avoid clashing with
+tables that already exist in the database, and --schema to place them in a
+separate postgres schema.
 `,
-		availableBackends),
 }
 
 // set fuse backend from flag
 func setFuseBackendFromFlag(cmd *cobra.Command, args []string) {
-	if !strings.Contains(sqlURI, "://") {
+	if err := sqlutils.SetTablePrefix(tablePrefix); err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlutils.SetSchema(schema); err != nil {
+		log.Fatal(err)
+	}
+
+	fuse.Backend, sqlDSN = backendFromURI(sqlURI)
+}
+
+// backendFromURI splits uri of the form backend://dsn and looks up the backend
+func backendFromURI(uri string) (sqlutils.SQLBackend, string) {
+	if !strings.Contains(uri, "://") {
 		log.Fatalf(`uri must be of the form backend://dsn`)
 	}
 
-	uriParts := strings.Split(sqlURI, "://")
+	uriParts := strings.SplitN(uri, "://", 2)
 	sqlBackend := uriParts[0]
-	sqlDSN = uriParts[1]
 
-	backend, ok := sqlutils.AvaialableBackends[sqlBackend]
+	backend, ok := sqlutils.GetBackend(sqlBackend)
 	if !ok {
-		log.Fatalf("Unknown backend `%s`. Available backends: %s", sqlURI, availableBackends)
+		log.Fatalf("Unknown backend `%s`. Available backends: %s", uri, sqlutils.Backends())
+	}
+
+	if schema != "" && !backend.Dialect().Schemas {
+		log.Fatalf("--schema is not supported by the %s backend", sqlBackend)
 	}
 
-	fuse.Backend = backend
+	return backend, uriParts[1]
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// backends may be registered by packages initialized after this one
+	rootCmd.Long = fmt.Sprintf(rootCmd.Long, sqlutils.Backends())
+
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -72,4 +111,6 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&sqlURI, "uri", "u", "sqlite://fs.sql", "SQL URI to connect to [backend://dsn]")
+	rootCmd.PersistentFlags().StringVar(&tablePrefix, "table-prefix", "", "Prefix for the names of tables used by sqlfs")
+	rootCmd.PersistentFlags().StringVar(&schema, "schema", "", "Schema to create and look for tables in (postgres only)")
 }
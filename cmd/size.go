@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeSuffixes are the multipliers of the units sizes can be given in
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40}, {"P", 1 << 50},
+}
+
+// sizeValue is a flag holding a number of bytes, which can be given with a
+// binary unit like 512M or 10GiB
+type sizeValue int64
+
+func (s *sizeValue) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeValue) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+
+	*s = sizeValue(size)
+	return nil
+}
+
+func (s *sizeValue) Type() string {
+	return "size"
+}
+
+// parseSize parses a number of bytes with an optional unit: K, M, G, T or P,
+// optionally followed by iB or B, all meaning powers of 1024
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSpace(value)
+	multiplier := int64(1)
+
+	upper := strings.ToUpper(number)
+	upper = strings.TrimSuffix(strings.TrimSuffix(upper, "IB"), "B")
+	for _, s := range sizeSuffixes {
+		if strings.HasSuffix(upper, s.suffix) {
+			upper = strings.TrimSuffix(upper, s.suffix)
+			multiplier = s.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || size < 0 || size > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid size `%s`", value)
+	}
+
+	return size * multiplier, nil
+}
+
+// formatSize returns size in the largest unit it's at least one of, like 1.5G
+func formatSize(size int64) string {
+	for i := len(sizeSuffixes) - 1; i >= 0; i-- {
+		s := sizeSuffixes[i]
+		if size >= s.multiplier {
+			return strconv.FormatFloat(float64(size)/float64(s.multiplier), 'f', 1, 64) + s.suffix
+		}
+	}
+
+	return strconv.FormatInt(size, 10)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// snapshotCmd represents the snapshot command
+//
+// Groups the snapshot create, list and delete commands
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage snapshots of the fs",
+	Long: `Snapshots capture the whole fs at a point in time. Only metadata is copied
+when a snapshot is created; file contents are shared with the live fs until
+they're changed or removed.
+
+Snapshots can be mounted read-only with sqlfs mount --snapshot NAME.`,
+}
+
+// snapshotCreateCmd represents the snapshot create command
+//
+// Captures the current tree as a snapshot
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a snapshot of the fs",
+	Long: `Creates a snapshot named NAME of the whole fs, in a single transaction, so
+it's consistent even while the fs is mounted and being written to.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		if err := sqlutils.CreateSnapshot(f.DB, args[0]); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// snapshotListCmd represents the snapshot list command
+//
+// Lists snapshots
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		snapshots, err := sqlutils.GetSnapshots(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tINODES\tBYTES")
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", snapshot.Name,
+				fsops.Time(snapshot.Ctime).Format("2006-01-02 15:04:05"),
+				snapshot.Inodes, formatSize(snapshot.Bytes))
+		}
+		w.Flush()
+	},
+}
+
+// snapshotDeleteCmd represents the snapshot delete command
+//
+// Deletes snapshots
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete NAME...",
+	Short: "Delete snapshots",
+	Long: `Deletes snapshots, along with file contents which only they were still
+using.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, name := range args {
+			if err := sqlutils.DeleteSnapshot(f.DB, name); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+}
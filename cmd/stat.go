@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+// statCmd represents the stat command
+//
+// Shows metadata of files and directories without mounting the fs
+var statCmd = &cobra.Command{
+	Use:   "stat PATH...",
+	Short: "Show file or directory metadata",
+	Long:  "Shows the metadata of files or directories, straight from the SQL db.",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, p := range args {
+			metadata, err := f.Stat(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Printf("  Path: %s\n", fsops.Clean(p))
+			fmt.Printf(" Inode: %d\n", metadata.Inode)
+			fmt.Printf("  Size: %d\n", metadata.Size)
+			fmt.Printf("  Mode: %s (%04o)\n", fsops.FileMode(metadata), fsops.FileMode(metadata).Perm())
+			fmt.Printf("   Uid: %d\n", metadata.Uid)
+			fmt.Printf("   Gid: %d\n", metadata.Gid)
+			fmt.Printf("Access: %s\n", fsops.Time(metadata.Atime))
+			fmt.Printf("Modify: %s\n", fsops.Time(metadata.Mtime))
+			fmt.Printf("Change: %s\n", fsops.Time(metadata.Ctime))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statCmd)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+)
+
+var tarFile string
+var tarNoSameOwner bool
+var tarQuiet bool
+
+// tarCmd represents the tar command
+//
+// Groups the tar create and extract commands
+var tarCmd = &cobra.Command{
+	Use:   "tar",
+	Short: "Create or extract tar archives",
+	Long: `Streams POSIX (PAX) tar archives to or from the SQL db, without mounting
+the fs. PAX headers carry nanosecond timestamps.`,
+}
+
+// tarCreateCmd represents the tar create command
+//
+// Writes a tree from the fs as a tar archive
+var tarCreateCmd = &cobra.Command{
+	Use:   "create [flags] [SRC]",
+	Short: "Write a tree from the fs as a tar archive",
+	Long: `Writes SRC, which defaults to the root of the fs, as a PAX tar archive
+to stdout or the file given with -f. Entries are named relative to SRC.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		src := "/"
+		if len(args) > 0 {
+			src = args[0]
+		}
+
+		var w io.Writer = os.Stdout
+		if tarFile != "-" {
+			file, err := os.Create(tarFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if err := f.WriteTar(w, src); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// tarExtractCmd represents the tar extract command
+//
+// Extracts a tar archive into the fs
+var tarExtractCmd = &cobra.Command{
+	Use:   "extract [flags] [DEST]",
+	Short: "Extract a tar archive into the fs",
+	Long: `Extracts the tar archive read from stdin or the file given with -f into
+DEST, which defaults to the root of the fs and is created if needed.
+
+Entries are inserted in large transactions like import, and files which
+already exist with the same size and mtime are skipped. Only regular files and
+directories are extracted; extended attributes aren't stored by sqlfs and are
+dropped with a warning.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		dest := "/"
+		if len(args) > 0 {
+			dest = args[0]
+		}
+
+		var r io.Reader = os.Stdin
+		if tarFile != "-" {
+			file, err := os.Open(tarFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			r = file
+		}
+
+		var opts fsops.ImportOptions
+		if !tarQuiet {
+			opts.Progress = func(progress fsops.ImportProgress) {
+				fmt.Fprintf(os.Stderr, "\r%d dirs, %d files, %d bytes extracted, %d skipped",
+					progress.Dirs, progress.Files, progress.Bytes, progress.Skipped)
+			}
+		}
+
+		err := f.ReadTar(r, dest, !tarNoSameOwner, opts)
+		if !tarQuiet {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tarCmd)
+	tarCmd.AddCommand(tarCreateCmd)
+	tarCmd.AddCommand(tarExtractCmd)
+
+	tarCmd.PersistentFlags().StringVarP(&tarFile, "file", "f", "-", "Archive to write or read, - for stdout/stdin")
+	tarExtractCmd.Flags().BoolVar(&tarNoSameOwner, "no-same-owner", false, "Extract entries as the current user instead of the owner in the archive")
+	tarExtractCmd.Flags().BoolVarP(&tarQuiet, "quiet", "q", false, "Don't print progress")
+}
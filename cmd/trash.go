@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+var trashOlderThan time.Duration
+
+// trashCmd represents the trash command
+//
+// Groups the trash list, restore and purge commands
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage removed files and directories",
+	Long: `With the trash enabled (sqlfs init --trash), removed files and directories
+are moved to the trash instead of being deleted, and can be restored until
+they're purged. They're purged by hand, or automatically once they've been in
+the trash longer than --trash-retention.
+
+Files in the trash still count towards usage and quotas.`,
+}
+
+// trashListCmd represents the trash list command
+//
+// Lists what's in the trash
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List removed files and directories",
+	Long: `Lists what's in the trash, most recently removed first, with the ID to
+restore or purge it by and the path it was removed from. What's been in the
+trash longer than the retention is purged first.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		if err := sqlutils.PurgeExpiredTrash(f.DB); err != nil {
+			log.Fatal(err)
+		}
+
+		entries, err := sqlutils.GetTrash(f.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tREMOVED\tSIZE\tPATH")
+		for _, entry := range entries {
+			p := entry.Path
+			if fsops.IsDir(sqlutils.Metadata{Type: entry.Type}) {
+				p += "/"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", entry.Inode,
+				fsops.Time(entry.Dtime).Format("2006-01-02 15:04:05"), formatSize(entry.Size), p)
+		}
+		w.Flush()
+	},
+}
+
+// trashRestoreCmd represents the trash restore command
+//
+// Puts files and directories back where they were removed from
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore ID|PATH...",
+	Short: "Restore removed files and directories",
+	Long: `Puts files and directories back where they were removed from, given their
+ID or path as listed by sqlfs trash list. A path refers to the most recently
+removed entry with that path.
+
+Restoring a directory restores everything removed from under it too, and
+restoring a file or directory restores the directories it was in, if they're
+in the trash as well. Nothing is restored if something else exists at a path
+being restored.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		for _, arg := range args {
+			inode, err := trashEntry(f, arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := sqlutils.RestoreFromTrash(f.DB, inode); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+// trashPurgeCmd represents the trash purge command
+//
+// Removes files and directories from the trash for good
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge [--older-than DURATION | ID|PATH...]",
+	Short: "Remove files and directories from the trash for good",
+	Long: `Removes files and directories from the trash for good, given their ID or
+path as listed by sqlfs trash list, along with everything removed from under
+them. Without any, the whole trash is purged, or what was removed longer than
+--older-than ago.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 0 && cmd.Flags().Changed("older-than") {
+			log.Fatal("Pass either --older-than or what to purge, not both")
+		}
+
+		f := openFS()
+
+		if len(args) == 0 {
+			if err := sqlutils.PurgeTrashBefore(f.DB, time.Now().Add(-trashOlderThan)); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		for _, arg := range args {
+			inode, err := trashEntry(f, arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := sqlutils.PurgeTrash(f.DB, inode); err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+// trashEntry returns the inode of the trash entry arg refers to, by its ID or
+// the path it was removed from
+func trashEntry(f *fsops.FS, arg string) (int64, error) {
+	if inode, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return inode, nil
+	}
+
+	entries, err := sqlutils.GetTrash(f.DB)
+	if err != nil {
+		return 0, err
+	}
+
+	// entries are listed most recently removed first
+	for _, entry := range entries {
+		if entry.Path == fsops.Clean(arg) {
+			return entry.Inode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", sqlutils.ErrNotInTrash, arg)
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashPurgeCmd)
+
+	trashPurgeCmd.Flags().DurationVar(&trashOlderThan, "older-than", 0, "Only purge what was removed longer than this ago, like 168h")
+}
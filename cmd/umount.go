@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fuse"
+)
+
+var umountLazy bool
+
+// umountCmd represents the umount command
+//
+// Unmounts a mounted fs
+var umountCmd = &cobra.Command{
+	Use:   "umount [flags] MOUNTPOINT",
+	Short: "Unmount the FUSE fs",
+	Long: `Unmounts the FUSE fs mounted at MOUNTPOINT, which makes the sqlfs mount
+process finish its requests, close the DB and exit.
+
+Fails if the fs is busy, unless -z is given to detach it lazily.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := fuse.Unmount(args[0], umountLazy); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(umountCmd)
+
+	umountCmd.Flags().BoolVarP(&umountLazy, "lazy", "z", false, "Detach the fs even if it's busy")
+}
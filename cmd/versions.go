@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yoogottamk/sqlfs/pkg/fsops"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// versionsCmd represents the versions command
+//
+// Lists the versions kept of a file
+var versionsCmd = &cobra.Command{
+	Use:   "versions PATH",
+	Short: "List the versions kept of a file",
+	Long: `Lists the versions kept of a file, newest first. Versions are named by when
+they were written, and are also shown read-only under the hidden .versions
+directory of mounted dirs, as .versions/FILE/VERSION.
+
+Versions are only kept when enabled with sqlfs init --keep-versions or
+--version-max-age.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		metadata, err := f.Stat(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if fsops.IsDir(metadata) {
+			log.Fatalf("%s: directories don't have versions", args[0])
+		}
+
+		versions, err := sqlutils.GetVersions(f.DB, metadata.Inode)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSIZE\tREPLACED")
+		for _, version := range versions {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", version.Name(), formatSize(version.Size),
+				fsops.Time(version.Ctime).Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+// restoreVersionCmd represents the restore-version command
+//
+// Makes a version the contents of its file again
+var restoreVersionCmd = &cobra.Command{
+	Use:   "restore-version PATH VERSION",
+	Short: "Restore a version of a file",
+	Long: `Makes VERSION (as listed by sqlfs versions) the contents of the file at PATH
+again. The contents it replaces are kept as a version.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f := openFS()
+
+		metadata, err := f.Stat(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		version, err := sqlutils.GetVersionByName(f.DB, metadata.Inode, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := sqlutils.RestoreVersion(f.DB, version); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+	rootCmd.AddCommand(restoreVersionCmd)
+}
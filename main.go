@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/yoogottamk/sqlfs/cmd"
+	"github.com/yoogottamk/sqlfs/pkg/daemon"
 )
 
 func main() {
@@ -14,5 +15,12 @@ func main() {
 	log.SetFlags(0)
 	log.SetPrefix(progName)
 
+	// the daemon started by the mount helper gets a sqlfs command line, even
+	// if the helper is a copy or hard link of sqlfs
+	if filepath.Base(os.Args[0]) == cmd.MountHelperName && !daemon.IsDaemon() {
+		cmd.ExecuteMountHelper(os.Args[1:])
+		return
+	}
+
 	cmd.Execute()
 }
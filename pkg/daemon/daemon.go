@@ -0,0 +1,119 @@
+// Package daemon runs commands in the background, reporting back to the
+// process which started them once they are ready or have failed
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// readyFdEnv holds the fd of the pipe to the parent in a daemon
+const readyFdEnv = "SQLFS_DAEMON_READY_FD"
+
+// readyMessage is sent to the parent once the daemon is ready. Anything else
+// is an error message
+const readyMessage = "READY"
+
+// ready is the pipe to the parent, until Ready is called
+var ready *os.File
+
+func init() {
+	if fd, err := strconv.Atoi(os.Getenv(readyFdEnv)); err == nil {
+		ready = os.NewFile(uintptr(fd), "ready")
+		os.Unsetenv(readyFdEnv)
+	}
+}
+
+// IsDaemon reports whether this process was started by Start
+func IsDaemon() bool {
+	return ready != nil
+}
+
+// Start runs this executable with args in the background, in a new session
+// with stdin closed and stdout and stderr appended to logFile (or discarded
+// if it's empty). It returns once the daemon calls Ready, with the error it
+// reported, if any, or an error if it exits before that
+func Start(args []string, logFile string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	if logFile == "" {
+		logFile = os.DevNull
+	}
+	logs, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer logs.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	// the first extra file is fd 3
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), readyFdEnv+"=3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	message, err := bufio.NewReader(r).ReadString('\n')
+	message = strings.TrimSuffix(message, "\n")
+	switch {
+	case message == readyMessage:
+		// leave it running
+		pid := cmd.Process.Pid
+		return pid, cmd.Process.Release()
+	case message != "":
+		cmd.Wait()
+		return 0, errors.New(message)
+	case err != nil && err != io.EOF:
+		return 0, err
+	}
+
+	// the daemon exited, or closed the pipe, without saying anything
+	if err = cmd.Wait(); err != nil {
+		return 0, fmt.Errorf("daemon failed: %v", err)
+	}
+	return 0, errors.New("daemon exited before it was ready")
+}
+
+// Ready tells the process which started this daemon, and systemd if it's
+// waiting for a notification, that it's ready. A non-nil err reports a
+// failure instead. Only the first call has any effect
+func Ready(err error) {
+	if err == nil {
+		Notify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+	}
+
+	if ready == nil {
+		return
+	}
+
+	message := readyMessage
+	if err != nil {
+		message = strings.ReplaceAll(err.Error(), "\n", " ")
+	}
+
+	fmt.Fprintln(ready, message)
+	ready.Close()
+	ready = nil
+}
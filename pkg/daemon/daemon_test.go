@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the daemons started by the tests, which are this test binary
+// with the way they should behave as their only argument
+func TestMain(m *testing.M) {
+	if !IsDaemon() {
+		os.Exit(m.Run())
+	}
+
+	fmt.Println("started")
+	switch os.Args[1] {
+	case "ready":
+		Ready(nil)
+	case "error":
+		Ready(errors.New("couldn't mount\nsomething"))
+		os.Exit(1)
+	case "exit":
+		os.Exit(2)
+	case "silent":
+		// closes the pipe without saying anything
+	}
+}
+
+func TestStart(t *testing.T) {
+	for _, test := range []struct {
+		mode string
+		err  string
+	}{
+		{"ready", ""},
+		{"error", "couldn't mount something"},
+		{"exit", "daemon failed: exit status 2"},
+		{"silent", "daemon exited before it was ready"},
+	} {
+		t.Run(test.mode, func(t *testing.T) {
+			logFile := filepath.Join(t.TempDir(), "log")
+
+			pid, err := Start([]string{test.mode}, logFile)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("Couldn't start daemon: %v", err)
+				}
+				if pid <= 0 {
+					t.Errorf("Start returned pid %d for a running daemon", pid)
+				}
+			} else if err == nil || err.Error() != test.err {
+				t.Fatalf("Start returned %v, expected %q", err, test.err)
+			}
+
+			logs, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatalf("Couldn't read log: %v", err)
+			}
+			if !strings.Contains(string(logs), "started") {
+				t.Errorf("log has %q, expected the output of the daemon", logs)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Notify without NOTIFY_SOCKET failed: %v", err)
+	}
+
+	sockets := map[string]string{"path": filepath.Join(t.TempDir(), "notify")}
+	// only linux has abstract sockets
+	if runtime.GOOS == "linux" {
+		sockets["abstract"] = fmt.Sprintf("@sqlfs-notify-test-%d", os.Getpid())
+	}
+
+	for name, socket := range sockets {
+		t.Run(name, func(t *testing.T) {
+			addr := socket
+			if addr[0] == '@' {
+				addr = "\x00" + addr[1:]
+			}
+			conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+			if err != nil {
+				t.Fatalf("Couldn't listen on %s: %v", socket, err)
+			}
+			defer conn.Close()
+
+			t.Setenv("NOTIFY_SOCKET", socket)
+			if err = Notify("READY=1"); err != nil {
+				t.Fatalf("Couldn't notify: %v", err)
+			}
+
+			buf := make([]byte, 64)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Couldn't read notification: %v", err)
+			}
+			if string(buf[:n]) != "READY=1" {
+				t.Errorf("received %q, expected %q", buf[:n], "READY=1")
+			}
+		})
+	}
+}
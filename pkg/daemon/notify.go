@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// Notify sends state to systemd if it's waiting for notifications through
+// $NOTIFY_SOCKET, like sd_notify(3). It does nothing otherwise
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// abstract sockets start with @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WritePidfile writes the pid of this process to path
+func WritePidfile(path string) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
@@ -0,0 +1,379 @@
+// Package dump reads and writes sqlfs dumps, a streamable archive of a whole
+// fs which doesn't depend on any SQL dialect.
+//
+// # Format
+//
+// A dump starts with a 12 byte header:
+//
+//	magic   8 bytes  "SQLFSDMP"
+//	version 2 bytes  big endian, currently 1
+//	flags   2 bytes  big endian, bit 0 set if the rest is gzip compressed
+//
+// The rest of the dump, after decompression, is a sequence of records:
+//
+//	type    1 byte
+//	length  uvarint, the length of payload
+//	payload length bytes
+//
+// Integers in payloads are varints (signed, zig-zag encoded) unless noted
+// otherwise, as written by encoding/binary. The record types are:
+//
+//	1 entry    a file or directory: inode, parent inode, uid, gid, mode,
+//	           type, ctime, atime, mtime, size, and the name as a uvarint
+//	           length followed by its bytes. Mode, type and times (in ns)
+//	           mean the same as in the metadata table. The root directory
+//	           has inode 1 and parent 0
+//	2 data     a chunk of file contents: inode, offset as a uvarint, and
+//	           the bytes of the chunk making up the rest of the payload
+//	255 end    the trailer: the number of entries and of content bytes as
+//	           uvarints, followed by the sha256 checksum (32 bytes) of all
+//	           records before it
+//
+// Entries come in pre-order, so a directory is always before its entries,
+// and the data records of a file directly follow its entry, in order.
+// Chunks are at most 1MiB.
+//
+// Readers skip records of unknown types and ignore payload bytes after the
+// fields they know, so new record types (for example symlinks or extended
+// attributes, which sqlfs doesn't store yet) and fields can be added without
+// a new version. The version only changes for incompatible changes.
+package dump
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// Magic starts every dump
+const Magic = "SQLFSDMP"
+
+// Version is the version of the format written by Writer
+const Version = 1
+
+// ChunkSize is the maximum size of a data record's contents
+const ChunkSize = 1 << 20
+
+// flagGzip marks dumps compressed with gzip
+const flagGzip = 1
+
+const (
+	recordEntry = 1
+	recordData  = 2
+	recordEnd   = 255
+)
+
+// Record is a record read from a dump, either an *Entry or a *Data
+type Record interface {
+	record()
+}
+
+// Entry is a file or directory in a dump
+type Entry struct {
+	sqlutils.Metadata
+
+	// Parent is the inode of the directory containing the entry, 0 for the root
+	Parent int64
+}
+
+// Data is a chunk of the contents of file Inode, starting at Offset
+type Data struct {
+	Inode  int64
+	Offset int64
+	Bytes  []byte
+}
+
+func (*Entry) record() {}
+func (*Data) record()  {}
+
+// Writer writes a dump
+type Writer struct {
+	w    io.Writer
+	gz   *gzip.Writer
+	hash hash.Hash
+
+	entries int64
+	bytes   int64
+}
+
+// NewWriter writes the header of a dump to w and returns a Writer for its
+// records, compressed with gzip if compress is set
+func NewWriter(w io.Writer, compress bool) (*Writer, error) {
+	header := make([]byte, len(Magic)+4)
+	copy(header, Magic)
+	binary.BigEndian.PutUint16(header[len(Magic):], Version)
+	if compress {
+		binary.BigEndian.PutUint16(header[len(Magic)+2:], flagGzip)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	dw := &Writer{w: w, hash: sha256.New()}
+	if compress {
+		dw.gz = gzip.NewWriter(w)
+		dw.w = dw.gz
+	}
+
+	return dw, nil
+}
+
+func (w *Writer) writeRecord(type_ byte, payload []byte) error {
+	record := append([]byte{type_}, appendUvarint(nil, uint64(len(payload)))...)
+	record = append(record, payload...)
+
+	w.hash.Write(record)
+	_, err := w.w.Write(record)
+	return err
+}
+
+// WriteEntry writes the record for a file or directory
+func (w *Writer) WriteEntry(entry *Entry) error {
+	var payload []byte
+	for _, v := range []int64{
+		entry.Inode, entry.Parent, entry.Uid, entry.Gid, entry.Mode, entry.Type,
+		entry.Ctime, entry.Atime, entry.Mtime, entry.Size,
+	} {
+		payload = appendVarint(payload, v)
+	}
+	payload = appendUvarint(payload, uint64(len(entry.Name)))
+	payload = append(payload, entry.Name...)
+
+	w.entries++
+	return w.writeRecord(recordEntry, payload)
+}
+
+// WriteData writes a chunk of file contents, which must not be larger than ChunkSize
+func (w *Writer) WriteData(data *Data) error {
+	if len(data.Bytes) > ChunkSize {
+		return fmt.Errorf("chunk of %d bytes larger than %d", len(data.Bytes), ChunkSize)
+	}
+
+	payload := appendVarint(nil, data.Inode)
+	payload = appendUvarint(payload, uint64(data.Offset))
+	payload = append(payload, data.Bytes...)
+
+	w.bytes += int64(len(data.Bytes))
+	return w.writeRecord(recordData, payload)
+}
+
+// Close writes the trailer and flushes compressed data. It doesn't close the
+// underlying writer
+func (w *Writer) Close() error {
+	payload := appendUvarint(nil, uint64(w.entries))
+	payload = appendUvarint(payload, uint64(w.bytes))
+	payload = append(payload, w.hash.Sum(nil)...)
+
+	if err := w.writeRecord(recordEnd, payload); err != nil {
+		return err
+	}
+
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+
+	return nil
+}
+
+// Reader reads the records of a dump
+type Reader struct {
+	r    *bufio.Reader
+	hash hash.Hash
+	// compressed is set for dumps compressed with gzip
+	compressed bool
+
+	entries int64
+	bytes   int64
+	done    bool
+}
+
+// ErrFormat is returned for input which isn't a valid dump
+var ErrFormat = errors.New("not a valid sqlfs dump")
+
+// NewReader reads the header of a dump from r and returns a Reader for its records
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, len(Magic)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrFormat
+	}
+	if string(header[:len(Magic)]) != Magic {
+		return nil, ErrFormat
+	}
+
+	version := binary.BigEndian.Uint16(header[len(Magic):])
+	if version != Version {
+		return nil, fmt.Errorf("unsupported dump version %d", version)
+	}
+
+	compressed := binary.BigEndian.Uint16(header[len(Magic)+2:])&flagGzip != 0
+	if compressed {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		r = gz
+	}
+
+	return &Reader{r: bufio.NewReader(r), hash: sha256.New(), compressed: compressed}, nil
+}
+
+// Next returns the next record. It returns io.EOF after the trailer, once
+// the counts and checksum in it have been verified, and
+// io.ErrUnexpectedEOF if the dump ends without one, or if the gzip stream of
+// a compressed dump ends early
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.done {
+			return nil, io.EOF
+		}
+
+		type_, err := r.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		length, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(r.r, payload); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		switch type_ {
+		case recordEntry:
+			r.writeHash(type_, payload)
+			r.entries++
+			return decodeEntry(payload)
+		case recordData:
+			r.writeHash(type_, payload)
+			data, err := decodeData(payload)
+			if err == nil {
+				r.bytes += int64(len(data.Bytes))
+			}
+			return data, err
+		case recordEnd:
+			if err := r.checkTrailer(payload); err != nil {
+				return nil, err
+			}
+			// reading to the end checks the gzip footer
+			if r.compressed {
+				if _, err := io.Copy(io.Discard, r.r); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+			}
+			r.done = true
+		default:
+			// added by a later writer
+			r.writeHash(type_, payload)
+		}
+	}
+}
+
+func (r *Reader) writeHash(type_ byte, payload []byte) {
+	r.hash.Write([]byte{type_})
+	r.hash.Write(appendUvarint(nil, uint64(len(payload))))
+	r.hash.Write(payload)
+}
+
+func (r *Reader) checkTrailer(payload []byte) error {
+	d := decoder{buf: payload}
+	entries, bytes := int64(d.uvarint()), int64(d.uvarint())
+	if d.err != nil || len(d.buf) < sha256.Size {
+		return ErrFormat
+	}
+
+	if entries != r.entries || bytes != r.bytes {
+		return fmt.Errorf("dump has %d entries and %d bytes, trailer says %d and %d", r.entries, r.bytes, entries, bytes)
+	}
+	if string(d.buf[:sha256.Size]) != string(r.hash.Sum(nil)) {
+		return errors.New("dump checksum mismatch")
+	}
+
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// decoder decodes the fields of a payload, remembering the first error
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrFormat
+		return 0
+	}
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrFormat
+		return 0
+	}
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func decodeEntry(payload []byte) (*Entry, error) {
+	d := decoder{buf: payload}
+	entry := &Entry{}
+
+	for _, v := range []*int64{
+		&entry.Inode, &entry.Parent, &entry.Uid, &entry.Gid, &entry.Mode, &entry.Type,
+		&entry.Ctime, &entry.Atime, &entry.Mtime, &entry.Size,
+	} {
+		*v = d.varint()
+	}
+
+	length := d.uvarint()
+	if d.err != nil || uint64(len(d.buf)) < length {
+		return nil, ErrFormat
+	}
+	entry.Name = string(d.buf[:length])
+
+	return entry, nil
+}
+
+func decodeData(payload []byte) (*Data, error) {
+	d := decoder{buf: payload}
+	data := &Data{Inode: d.varint(), Offset: int64(d.uvarint())}
+	if d.err != nil {
+		return nil, ErrFormat
+	}
+	data.Bytes = d.buf
+
+	return data, nil
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
@@ -0,0 +1,175 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+var testRecords = []Record{
+	&Entry{Metadata: sqlutils.Metadata{Inode: 1, Mode: 0x800001ed, Type: 4, Ctime: 1, Atime: 2, Mtime: 3}},
+	&Entry{
+		Metadata: sqlutils.Metadata{Inode: 2, Uid: 1000, Gid: -1, Mode: 0644, Type: 8, Ctime: 4, Atime: 5, Mtime: 6, Name: "file", Size: 7},
+		Parent:   1,
+	},
+	&Data{Inode: 2, Offset: 0, Bytes: []byte("con")},
+	&Data{Inode: 2, Offset: 3, Bytes: []byte("tent")},
+	&Entry{Metadata: sqlutils.Metadata{Inode: 1 << 62, Type: 4, Name: "dir"}, Parent: 1},
+}
+
+// writeTestDump writes testRecords to a dump. before, if set, is called
+// before the trailer is written
+func writeTestDump(t *testing.T, compress bool, before func(w *Writer)) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, compress)
+	if err != nil {
+		t.Fatalf("Couldn't write header: %v", err)
+	}
+
+	for _, record := range testRecords {
+		switch record := record.(type) {
+		case *Entry:
+			err = w.WriteEntry(record)
+		case *Data:
+			err = w.WriteData(record)
+		}
+		if err != nil {
+			t.Fatalf("Couldn't write record: %v", err)
+		}
+	}
+
+	if before != nil {
+		before(w)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Couldn't write trailer: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// readTestDump reads all records of dump, returning them along with the
+// error which stopped reading, nil for io.EOF
+func readTestDump(dump []byte) ([]Record, error) {
+	r, err := NewReader(bytes.NewReader(dump))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, record)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		records, err := readTestDump(writeTestDump(t, compress, nil))
+		if err != nil {
+			t.Fatalf("compress %v: couldn't read dump: %v", compress, err)
+		}
+		if !reflect.DeepEqual(records, testRecords) {
+			t.Errorf("compress %v: read %v, expected %v", compress, records, testRecords)
+		}
+	}
+}
+
+func TestUnknownRecords(t *testing.T) {
+	dump := writeTestDump(t, false, func(w *Writer) {
+		// a record type and a field added by a later writer
+		if err := w.writeRecord(7, []byte("symlink")); err != nil {
+			t.Fatalf("Couldn't write record: %v", err)
+		}
+		payload := appendVarint(appendUvarint(appendVarint(nil, 2), 7), 42)
+		if err := w.writeRecord(recordData, payload[:len(payload)-1]); err != nil {
+			t.Fatalf("Couldn't write record: %v", err)
+		}
+	})
+
+	records, err := readTestDump(dump)
+	if err != nil {
+		t.Fatalf("Couldn't read dump: %v", err)
+	}
+
+	expected := append(append([]Record{}, testRecords...), &Data{Inode: 2, Offset: 7, Bytes: []byte{}})
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("read %v, expected %v", records, expected)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	dump := writeTestDump(t, false, nil)
+
+	i := bytes.Index(dump, []byte("tent"))
+	dump[i] = 'T'
+
+	_, err := readTestDump(dump)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("reading a changed dump returned %v, expected a checksum mismatch", err)
+	}
+}
+
+func TestCountMismatch(t *testing.T) {
+	for name, change := range map[string]func(w *Writer){
+		"entries": func(w *Writer) { w.entries++ },
+		"bytes":   func(w *Writer) { w.bytes-- },
+	} {
+		_, err := readTestDump(writeTestDump(t, false, change))
+		if err == nil || !strings.Contains(err.Error(), "trailer says") {
+			t.Errorf("%s: reading a dump with wrong counts returned %v, expected a count mismatch", name, err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dump := writeTestDump(t, compress, nil)
+
+		// anywhere after the header, and right before the trailer
+		for _, n := range []int{len(Magic) + 4, len(dump) / 2, len(dump) - 1} {
+			_, err := readTestDump(dump[:n])
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("compress %v: reading %d of %d bytes returned %v, expected io.ErrUnexpectedEOF",
+					compress, n, len(dump), err)
+			}
+		}
+	}
+}
+
+func TestNotADump(t *testing.T) {
+	for _, input := range []string{"", "SQLFS", "NOTADUMP\x00\x01\x00\x00"} {
+		if _, err := NewReader(strings.NewReader(input)); !errors.Is(err, ErrFormat) {
+			t.Errorf("NewReader(%q) returned %v, expected ErrFormat", input, err)
+		}
+	}
+
+	if _, err := NewReader(strings.NewReader(Magic + "\x00\x02\x00\x00")); err == nil {
+		t.Errorf("reading a dump of an unknown version didn't fail")
+	}
+}
+
+func TestWriteDataTooLarge(t *testing.T) {
+	w, err := NewWriter(io.Discard, false)
+	if err != nil {
+		t.Fatalf("Couldn't write header: %v", err)
+	}
+
+	if err := w.WriteData(&Data{Inode: 2, Bytes: make([]byte, ChunkSize+1)}); err == nil {
+		t.Errorf("writing a chunk larger than ChunkSize didn't fail")
+	}
+}
@@ -0,0 +1,300 @@
+package fsops
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// copier copies the tree of one fs to another, keeping inode numbers
+type copier struct {
+	from, to *FS
+	opts     ImportOptions
+
+	// created has the directories inserted by this copy, which can't have
+	// any entries from an earlier one
+	created map[int64]bool
+
+	pending      []sqlutils.Entry
+	pendingBytes int64
+
+	progress ImportProgress
+}
+
+// CopyTree copies every file and directory of from into to, which may use a
+// different backend, keeping inode numbers. Entries are inserted in batches
+// like Import, and progress is reported through opts. File contents are read
+// in parts, and files larger than opts.BatchBytes are written in parts too,
+// so no file is held in memory whole.
+//
+// to must either be freshly initialized or the target of an interrupted
+// CopyTree from the same fs, in which case entries which were already copied
+// are skipped, and files which were being written are written again
+func CopyTree(from, to *FS, opts ImportOptions) error {
+	if opts.BatchEntries <= 0 {
+		opts.BatchEntries = 1000
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = 64 << 20
+	}
+
+	c := &copier{from: from, to: to, opts: opts, created: map[int64]bool{}}
+
+	root, err := from.Backend.GetMetadataForInode(from.DB, RootInode)
+	if err != nil {
+		return pathError("copy", "/", err)
+	}
+
+	if err = c.copyDir("/", RootInode); err != nil {
+		return err
+	}
+	if err = c.flush(); err != nil {
+		return err
+	}
+
+	// the root was created by init, so only its metadata is copied
+	if err = to.Backend.SetMetadataForInode(to.DB, RootInode, root); err != nil {
+		return pathError("copy", "/", err)
+	}
+
+	return nil
+}
+
+// copyDir copies the entries of directory p, whose inode exists in c.to or
+// the pending batch, along with everything under them
+func (c *copier) copyDir(p string, inode int64) error {
+	children, err := c.from.Backend.GetDirectoryContentsForInode(c.from.DB, inode)
+	if err != nil {
+		return pathError("copy", p, err)
+	}
+
+	existing := map[int64]bool{}
+	if !c.created[inode] {
+		targetChildren, err := c.to.Backend.GetDirectoryContentsForInode(c.to.DB, inode)
+		if err != nil {
+			return pathError("copy", p, err)
+		}
+		for _, child := range targetChildren {
+			existing[child] = true
+		}
+	}
+
+	for _, child := range children {
+		metadata, err := c.from.Backend.GetMetadataForInode(c.from.DB, child)
+		if err != nil {
+			return pathError("copy", p, err)
+		}
+		childPath := path.Join(p, metadata.Name)
+
+		if existing[child] {
+			err = c.resume(childPath, metadata)
+		} else {
+			err = c.add(childPath, inode, metadata)
+		}
+		if err != nil {
+			return err
+		}
+
+		if IsDir(metadata) {
+			if err = c.copyDir(childPath, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// add adds the file or directory p, in directory parent, to the pending batch.
+// Files larger than a batch are inserted empty, and written in parts
+func (c *copier) add(p string, parent int64, metadata sqlutils.Metadata) error {
+	if IsDir(metadata) {
+		c.created[metadata.Inode] = true
+		c.progress.Dirs++
+
+		return c.insert(sqlutils.Entry{Metadata: metadata, Parent: parent})
+	}
+
+	if metadata.Size > c.opts.BatchBytes {
+		if err := c.insert(sqlutils.Entry{Metadata: metadata, Parent: parent}); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+
+		return c.writeFile(p, metadata)
+	}
+
+	data, err := io.ReadAll(c.from.openInode(p, metadata))
+	if err != nil {
+		return err
+	}
+
+	c.progress.Files++
+	c.progress.Bytes += metadata.Size
+
+	return c.insert(sqlutils.Entry{Metadata: metadata, Parent: parent, Data: data})
+}
+
+// writeFile writes the contents of file p, which exists in c.to, a part at a
+// time
+func (c *copier) writeFile(p string, metadata sqlutils.Metadata) error {
+	reader := c.from.openInode(p, metadata)
+	buf := make([]byte, readChunk)
+
+	var offset int64
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 || offset == 0 {
+			if err := sqlutils.AppendFileContents(c.to.DB, metadata.Inode, offset, buf[:n]); err != nil {
+				return pathError("copy", p, err)
+			}
+			offset += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	c.progress.Files++
+	c.progress.Bytes += metadata.Size
+
+	return nil
+}
+
+// resume handles p, which exists in c.to from an earlier copy. Files which
+// were written in parts and are shorter than they should be are written again
+func (c *copier) resume(p string, metadata sqlutils.Metadata) error {
+	if !IsDir(metadata) && metadata.Size > 0 {
+		last, err := c.to.Backend.GetFileRangeForInode(c.to.DB, metadata.Inode, metadata.Size-1, 1)
+		if err != nil {
+			return pathError("copy", p, err)
+		}
+		if len(last) == 0 {
+			return c.writeFile(p, metadata)
+		}
+	}
+
+	c.progress.Skipped++
+
+	return nil
+}
+
+// insert adds entry to the pending batch, inserting the batch once it's full
+func (c *copier) insert(entry sqlutils.Entry) error {
+	c.pending = append(c.pending, entry)
+	c.pendingBytes += int64(len(entry.Data))
+
+	if len(c.pending) >= c.opts.BatchEntries || c.pendingBytes >= c.opts.BatchBytes {
+		return c.flush()
+	}
+
+	return nil
+}
+
+// flush inserts the pending batch in a single transaction
+func (c *copier) flush() error {
+	if len(c.pending) > 0 {
+		if _, err := sqlutils.InsertEntries(c.to.Backend, c.to.DB, c.pending); err != nil {
+			return errno(err)
+		}
+
+		c.pending = nil
+		c.pendingBytes = 0
+	}
+
+	if c.opts.Progress != nil {
+		c.opts.Progress(c.progress)
+	}
+
+	return nil
+}
+
+// VerifyCopy checks that to has exactly the tree of from: the same inodes in
+// the same directories, the same metadata and the same file contents, which
+// are compared by their sha256 checksums. It returns the number of entries
+// and bytes checked
+func VerifyCopy(from, to *FS) (ImportProgress, error) {
+	var counts ImportProgress
+	err := verifyDir(from, to, "/", RootInode, &counts)
+
+	return counts, err
+}
+
+func verifyDir(from, to *FS, p string, inode int64, counts *ImportProgress) error {
+	fromChildren, err := from.Backend.GetDirectoryContentsForInode(from.DB, inode)
+	if err != nil {
+		return pathError("verify", p, err)
+	}
+	toChildren, err := to.Backend.GetDirectoryContentsForInode(to.DB, inode)
+	if err != nil {
+		return pathError("verify", p, err)
+	}
+
+	sort.Slice(fromChildren, func(i, j int) bool { return fromChildren[i] < fromChildren[j] })
+	sort.Slice(toChildren, func(i, j int) bool { return toChildren[i] < toChildren[j] })
+	if fmt.Sprint(fromChildren) != fmt.Sprint(toChildren) {
+		return fmt.Errorf("verify %s: %d entries in source, %d in target", p, len(fromChildren), len(toChildren))
+	}
+
+	for _, child := range fromChildren {
+		fromMetadata, err := from.Backend.GetMetadataForInode(from.DB, child)
+		if err != nil {
+			return pathError("verify", p, err)
+		}
+		childPath := path.Join(p, fromMetadata.Name)
+
+		toMetadata, err := to.Backend.GetMetadataForInode(to.DB, child)
+		if err != nil {
+			return pathError("verify", childPath, err)
+		}
+		if fromMetadata != toMetadata {
+			return fmt.Errorf("verify %s: metadata differs", childPath)
+		}
+
+		if IsDir(fromMetadata) {
+			counts.Dirs++
+			if err = verifyDir(from, to, childPath, child, counts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fromSum, err := checksum(from.openInode(childPath, fromMetadata))
+		if err != nil {
+			return err
+		}
+		toSum, err := checksum(to.openInode(childPath, toMetadata))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(fromSum, toSum) {
+			return fmt.Errorf("verify %s: contents differ", childPath)
+		}
+
+		counts.Files++
+		counts.Bytes += fromMetadata.Size
+	}
+
+	return nil
+}
+
+// checksum returns the sha256 checksum of everything read from r
+func checksum(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,152 @@
+package fsops
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// newCopySource returns an fs with a few files and directories, one of
+// them larger than a read chunk
+func newCopySource(t *testing.T) (*FS, []byte) {
+	t.Helper()
+
+	from := newTestFS(t)
+	large := randomBytes(readChunk*2 + 1)
+	writeTestFile(t, from, "/large", large)
+	writeTestFile(t, from, "/dir/small", []byte("small"))
+	writeTestFile(t, from, "/dir/sub/empty", nil)
+	if err := from.MkdirAll("/dir/emptydir"); err != nil {
+		t.Fatalf("Couldn't create /dir/emptydir: %v", err)
+	}
+
+	return from, large
+}
+
+func TestCopyTree(t *testing.T) {
+	for _, batchBytes := range []int64{64 << 20, 1000} {
+		from, large := newCopySource(t)
+		to := newTestFS(t)
+
+		var progress ImportProgress
+		opts := ImportOptions{BatchBytes: batchBytes, Progress: func(p ImportProgress) { progress = p }}
+		if err := CopyTree(from, to, opts); err != nil {
+			t.Fatalf("batches of %d bytes: couldn't copy: %v", batchBytes, err)
+		}
+
+		expected := ImportProgress{Dirs: 3, Files: 3, Bytes: int64(len(large)) + 5}
+		if progress != expected {
+			t.Errorf("batches of %d bytes: CopyTree reported %+v, expected %+v", batchBytes, progress, expected)
+		}
+
+		counts, err := VerifyCopy(from, to)
+		if err != nil {
+			t.Fatalf("batches of %d bytes: copy doesn't match: %v", batchBytes, err)
+		}
+		if counts != expected {
+			t.Errorf("batches of %d bytes: VerifyCopy reported %+v, expected %+v", batchBytes, counts, expected)
+		}
+
+		if data := readTestFile(t, to, "/large"); !bytes.Equal(data, large) {
+			t.Errorf("batches of %d bytes: copied /large has %d bytes, which differ from the %d in the source",
+				batchBytes, len(data), len(large))
+		}
+	}
+}
+
+func TestCopyTreeResume(t *testing.T) {
+	from, large := newCopySource(t)
+	to := newTestFS(t)
+
+	opts := ImportOptions{BatchBytes: 1000}
+	if err := CopyTree(from, to, opts); err != nil {
+		t.Fatalf("Couldn't copy: %v", err)
+	}
+
+	// as if the copy was interrupted while writing /large, before /dir/small
+	// was inserted
+	largeInode, err := to.Lookup("/large")
+	if err != nil {
+		t.Fatalf("Couldn't look up /large: %v", err)
+	}
+	if err := sqlutils.AppendFileContents(to.DB, largeInode, 0, large[:readChunk]); err != nil {
+		t.Fatalf("Couldn't truncate /large: %v", err)
+	}
+	if err := to.Remove("/dir/small"); err != nil {
+		t.Fatalf("Couldn't remove /dir/small: %v", err)
+	}
+	if _, err := VerifyCopy(from, to); err == nil {
+		t.Fatalf("VerifyCopy didn't notice the interrupted copy")
+	}
+
+	var progress ImportProgress
+	opts.Progress = func(p ImportProgress) { progress = p }
+	if err := CopyTree(from, to, opts); err != nil {
+		t.Fatalf("Couldn't resume copy: %v", err)
+	}
+
+	// /dir, /dir/sub, /dir/emptydir and /dir/sub/empty were there already
+	expected := ImportProgress{Files: 2, Bytes: int64(len(large)) + 5, Skipped: 4}
+	if progress != expected {
+		t.Errorf("resumed CopyTree reported %+v, expected %+v", progress, expected)
+	}
+
+	if _, err := VerifyCopy(from, to); err != nil {
+		t.Errorf("resumed copy doesn't match: %v", err)
+	}
+}
+
+func TestVerifyCopy(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(to *FS) error
+		expected string
+	}{
+		{
+			name: "contents",
+			change: func(to *FS) error {
+				// same size and metadata, different contents
+				metadata, err := to.Stat("/dir/small")
+				if err != nil {
+					return err
+				}
+				if err = to.WriteFile("/dir/small", []byte("SMALL"), 0644); err != nil {
+					return err
+				}
+				return to.Backend.SetMetadataForInode(to.DB, metadata.Inode, metadata)
+			},
+			expected: "contents differ",
+		},
+		{
+			name:     "metadata",
+			change:   func(to *FS) error { return to.Chmod("/dir/small", 0600) },
+			expected: "metadata differs",
+		},
+		{
+			name:     "entries",
+			change:   func(to *FS) error { return to.Mkdir("/dir/extra") },
+			expected: "entries in source",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from, _ := newCopySource(t)
+			to := newTestFS(t)
+			if err := CopyTree(from, to, ImportOptions{}); err != nil {
+				t.Fatalf("Couldn't copy: %v", err)
+			}
+
+			if err := test.change(to); err != nil {
+				t.Fatalf("Couldn't change the copy: %v", err)
+			}
+
+			_, err := VerifyCopy(from, to)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("VerifyCopy returned %v, expected an error saying %q", err, test.expected)
+			}
+		})
+	}
+}
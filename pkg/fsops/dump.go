@@ -0,0 +1,216 @@
+package fsops
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/yoogottamk/sqlfs/pkg/dump"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// Dump writes the whole fs to w in the format of package dump, compressed
+// with gzip if compress is set. File contents are streamed from the db
+func (f *FS) Dump(w io.Writer, compress bool) error {
+	root, err := f.Backend.GetMetadataForInode(f.DB, RootInode)
+	if err != nil {
+		return pathError("dump", "/", err)
+	}
+
+	dw, err := dump.NewWriter(w, compress)
+	if err != nil {
+		return err
+	}
+
+	if err = dw.WriteEntry(&dump.Entry{Metadata: root}); err != nil {
+		return err
+	}
+	if err = f.dumpDir(dw, "/", RootInode); err != nil {
+		return err
+	}
+
+	return dw.Close()
+}
+
+func (f *FS) dumpDir(dw *dump.Writer, p string, inode int64) error {
+	entries, err := f.readDirInode(p, inode)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		childPath := path.Join(p, entry.Name)
+
+		if err = dw.WriteEntry(&dump.Entry{Metadata: entry, Parent: inode}); err != nil {
+			return err
+		}
+
+		if IsDir(entry) {
+			err = f.dumpDir(dw, childPath, entry.Inode)
+		} else {
+			err = f.dumpFile(dw, childPath, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dumpFile writes the contents of file p as data records
+func (f *FS) dumpFile(dw *dump.Writer, p string, metadata sqlutils.Metadata) error {
+	reader := f.openInode(p, metadata)
+	buf := make([]byte, dump.ChunkSize)
+
+	var offset int64
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			if err := dw.WriteData(&dump.Data{Inode: metadata.Inode, Offset: offset, Bytes: buf[:n]}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Restore reads a dump written by Dump from r into the fs, which must be
+// empty, keeping inode numbers. Entries are inserted in batches like Import.
+// Files larger than opts.BatchBytes are written a data record at a time, so
+// no file is held in memory whole
+func (f *FS) Restore(r io.Reader, opts ImportOptions) error {
+	children, err := f.Backend.GetDirectoryContentsForInode(f.DB, RootInode)
+	if err != nil {
+		return pathError("restore", "/", err)
+	}
+	if len(children) > 0 {
+		return fmt.Errorf("restore: the fs isn't empty")
+	}
+
+	if opts.BatchEntries <= 0 {
+		opts.BatchEntries = 1000
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = 64 << 20
+	}
+	c := &copier{to: f, opts: opts}
+
+	dr, err := dump.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	var root *sqlutils.Metadata
+	// current is the last file read, which gets its contents from the
+	// following data records. They're kept in current.Data until there's
+	// more than a batch of them, then current is inserted and the rest is
+	// written as it comes
+	var current *sqlutils.Entry
+	var written int64
+	var inserted bool
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		if written != current.Size {
+			return fmt.Errorf("restore: inode %d has %d bytes, expected %d", current.Inode, written, current.Size)
+		}
+
+		c.progress.Files++
+		c.progress.Bytes += current.Size
+
+		entry := *current
+		current = nil
+		if inserted {
+			return nil
+		}
+		return c.insert(entry)
+	}
+	write := func(data []byte) error {
+		offset := written
+		written += int64(len(data))
+
+		if !inserted {
+			current.Data = append(current.Data, data...)
+			if int64(len(current.Data)) <= opts.BatchBytes {
+				return nil
+			}
+
+			// insert it empty and write what was read so far
+			data, offset, current.Data = current.Data, 0, nil
+			if err := c.insert(*current); err != nil {
+				return err
+			}
+			if err := c.flush(); err != nil {
+				return err
+			}
+			inserted = true
+		}
+
+		err := sqlutils.AppendFileContents(f.DB, current.Inode, offset, data)
+		if err != nil {
+			return fmt.Errorf("restore: inode %d: %w", current.Inode, errno(err))
+		}
+
+		return nil
+	}
+
+	for {
+		record, err := dr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch record := record.(type) {
+		case *dump.Entry:
+			if err = finish(); err != nil {
+				return err
+			}
+
+			switch {
+			case record.Inode == RootInode:
+				root = &record.Metadata
+			case IsDir(record.Metadata):
+				c.progress.Dirs++
+				err = c.insert(sqlutils.Entry{Metadata: record.Metadata, Parent: record.Parent})
+			default:
+				current = &sqlutils.Entry{Metadata: record.Metadata, Parent: record.Parent, Data: []byte{}}
+				written, inserted = 0, false
+			}
+		case *dump.Data:
+			if current == nil || record.Inode != current.Inode || record.Offset != written {
+				return fmt.Errorf("restore: unexpected contents for inode %d at offset %d", record.Inode, record.Offset)
+			}
+			err = write(record.Bytes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = finish(); err != nil {
+		return err
+	}
+	if err = c.flush(); err != nil {
+		return err
+	}
+
+	if root != nil {
+		if err = f.Backend.SetMetadataForInode(f.DB, RootInode, *root); err != nil {
+			return pathError("restore", "/", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package fsops
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDumpRestore(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		// large files are kept in memory with the default batches, and
+		// written a record at a time with small ones
+		for _, batchBytes := range []int64{64 << 20, 1000} {
+			from, large := newCopySource(t)
+
+			var archive bytes.Buffer
+			if err := from.Dump(&archive, compress); err != nil {
+				t.Fatalf("Couldn't dump: %v", err)
+			}
+
+			to := newTestFS(t)
+			var progress ImportProgress
+			opts := ImportOptions{BatchBytes: batchBytes, Progress: func(p ImportProgress) { progress = p }}
+			if err := to.Restore(&archive, opts); err != nil {
+				t.Fatalf("compress %v, batches of %d bytes: couldn't restore: %v", compress, batchBytes, err)
+			}
+
+			expected := ImportProgress{Dirs: 3, Files: 3, Bytes: int64(len(large)) + 5}
+			if progress != expected {
+				t.Errorf("compress %v, batches of %d bytes: Restore reported %+v, expected %+v",
+					compress, batchBytes, progress, expected)
+			}
+
+			// restoring keeps inodes, so it's checked like a copy
+			if _, err := VerifyCopy(from, to); err != nil {
+				t.Errorf("compress %v, batches of %d bytes: restored fs doesn't match: %v", compress, batchBytes, err)
+			}
+		}
+	}
+}
+
+func TestRestoreNotEmpty(t *testing.T) {
+	from, _ := newCopySource(t)
+
+	var archive bytes.Buffer
+	if err := from.Dump(&archive, false); err != nil {
+		t.Fatalf("Couldn't dump: %v", err)
+	}
+
+	if err := from.Restore(&archive, ImportOptions{}); err == nil {
+		t.Errorf("restoring into a fs which isn't empty didn't fail")
+	}
+}
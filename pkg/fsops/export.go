@@ -0,0 +1,108 @@
+package fsops
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// ExportProgress counts what Export has done so far
+type ExportProgress struct {
+	Dirs  int64
+	Files int64
+	Bytes int64
+}
+
+// Export copies src, a file or directory in the fs, to local path dest.
+// A directory's contents are copied into dest, which is created if needed.
+// Modes and mtimes are preserved, and so is ownership when running as root.
+// File contents are streamed, so large files aren't loaded into memory.
+//
+// progress, if not nil, is called after every file
+func (f *FS) Export(src, dest string, progress func(ExportProgress)) error {
+	metadata, err := f.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	var counts ExportProgress
+	return f.export(Clean(src), dest, metadata, &counts, progress)
+}
+
+func (f *FS) export(src, dest string, metadata sqlutils.Metadata, counts *ExportProgress, progress func(ExportProgress)) error {
+	if IsDir(metadata) {
+		err := os.Mkdir(dest, FileMode(metadata).Perm()|0700)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		entries, err := f.readDirInode(src, metadata.Inode)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			err := f.export(path.Join(src, entry.Name), filepath.Join(dest, entry.Name), entry, counts, progress)
+			if err != nil {
+				return err
+			}
+		}
+
+		counts.Dirs++
+	} else {
+		if err := f.exportFile(src, dest, metadata); err != nil {
+			return err
+		}
+
+		counts.Files++
+		counts.Bytes += metadata.Size
+		if progress != nil {
+			progress(*counts)
+		}
+	}
+
+	// set after the contents are written, since writing them changes the
+	// mtime of directories and the owner could stop us from writing them
+	return setLocalMetadata(dest, metadata)
+}
+
+// exportFile streams the contents of file src to local path dest
+func (f *FS) exportFile(src, dest string, metadata sqlutils.Metadata) error {
+	reader, err := f.Open(src)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FileMode(metadata).Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// setLocalMetadata applies the mode, times and, when running as root,
+// ownership in metadata to local path p
+func setLocalMetadata(p string, metadata sqlutils.Metadata) error {
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(p, int(metadata.Uid), int(metadata.Gid)); err != nil {
+			return err
+		}
+	}
+
+	// chmod after chown, which can clear mode bits
+	if err := os.Chmod(p, FileMode(metadata).Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(p, Time(metadata.Atime), Time(metadata.Mtime))
+}
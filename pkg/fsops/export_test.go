@@ -0,0 +1,84 @@
+package fsops
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+// randomBytes returns n bytes which don't compress
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+
+	return data
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	f := newTestFS(t)
+	src := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+
+	// larger than a read chunk, so it's streamed in parts
+	large := randomBytes(readChunk*2 + 123)
+	writeLocalFile(t, src+"/large", large, mtime)
+	writeLocalFile(t, src+"/dir/small", []byte("small"), mtime)
+	writeLocalFile(t, src+"/dir/sub/empty", nil, mtime)
+	if err := os.Chmod(src+"/dir/small", 0600); err != nil {
+		t.Fatalf("Couldn't chmod: %v", err)
+	}
+
+	if err := f.Import(src, "/", ImportOptions{}); err != nil {
+		t.Fatalf("Couldn't import: %v", err)
+	}
+
+	dest := t.TempDir() + "/export"
+	var progress ExportProgress
+	err := f.Export("/", dest, func(p ExportProgress) { progress = p })
+	if err != nil {
+		t.Fatalf("Couldn't export: %v", err)
+	}
+	if progress.Files != 3 || progress.Bytes != int64(len(large))+5 {
+		t.Errorf("Export reported %+v, expected 3 files and %d bytes", progress, len(large)+5)
+	}
+
+	for p, contents := range map[string][]byte{
+		"/large":         large,
+		"/dir/small":     []byte("small"),
+		"/dir/sub/empty": {},
+	} {
+		data, err := os.ReadFile(dest + p)
+		if err != nil {
+			t.Fatalf("Couldn't read exported %s: %v", p, err)
+		}
+		if !bytes.Equal(data, contents) {
+			t.Errorf("exported %s has %d bytes, which differ from the %d imported", p, len(data), len(contents))
+		}
+
+		fileinfo, err := os.Stat(dest + p)
+		if err != nil {
+			t.Fatalf("Couldn't stat exported %s: %v", p, err)
+		}
+		if !fileinfo.ModTime().Equal(mtime) {
+			t.Errorf("exported %s has mtime %v, expected %v", p, fileinfo.ModTime(), mtime)
+		}
+	}
+
+	fileinfo, err := os.Stat(dest + "/dir/small")
+	if err != nil {
+		t.Fatalf("Couldn't stat exported /dir/small: %v", err)
+	}
+	if fileinfo.Mode().Perm() != 0600 {
+		t.Errorf("exported /dir/small has mode %v, expected -rw-------", fileinfo.Mode())
+	}
+
+	// a single file is exported to dest itself
+	if err := f.Export("/dir/small", dest+"/copy", nil); err != nil {
+		t.Fatalf("Couldn't export /dir/small: %v", err)
+	}
+	if data, err := os.ReadFile(dest + "/copy"); err != nil || string(data) != "small" {
+		t.Errorf("exported /dir/small has %q (%v), expected %q", data, err, "small")
+	}
+}
@@ -0,0 +1,363 @@
+// Package fsops implements path based operations on a sqlfs database using
+// the SQLBackend interface directly, without mounting it
+package fsops
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// RootInode is the inode of the root directory
+const RootInode = 1
+
+// FS gives path based access to the fs stored in DB. Paths are slash
+// separated and relative to the root of the fs, whether or not they start
+// with a slash
+type FS struct {
+	Backend sqlutils.SQLBackend
+	DB      *sql.DB
+}
+
+// IsDir reports whether metadata describes a directory
+func IsDir(metadata sqlutils.Metadata) bool {
+	return metadata.Type == int64(fuse.DT_Dir)
+}
+
+// FileMode returns the os.FileMode for metadata, including the type bits
+func FileMode(metadata sqlutils.Metadata) os.FileMode {
+	mode := os.FileMode(metadata.Mode) & os.ModePerm
+	if IsDir(metadata) {
+		mode |= os.ModeDir
+	}
+
+	return mode
+}
+
+// Time converts the ns timestamps stored in metadata to time.Time
+func Time(ns int64) time.Time {
+	return time.Unix(ns/1e9, ns%1e9)
+}
+
+// Clean returns the canonical form of p, starting with a slash
+func Clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+// split returns the components of p
+func split(p string) []string {
+	p = Clean(p)
+	if p == "/" {
+		return nil
+	}
+
+	return strings.Split(p[1:], "/")
+}
+
+// errno converts errors from the backend into errnos where possible
+func errno(err error) error {
+	var fuseErr fuse.Errno
+	switch {
+	case errors.Is(err, dbsql.ErrNoRows):
+		return syscall.ENOENT
+	case errors.As(err, &fuseErr):
+		return syscall.Errno(fuseErr)
+	}
+
+	return err
+}
+
+func pathError(op, p string, err error) error {
+	return &fs.PathError{Op: op, Path: Clean(p), Err: errno(err)}
+}
+
+// Lookup resolves p to an inode by walking down from the root
+func (f *FS) Lookup(p string) (int64, error) {
+	var inode int64 = RootInode
+
+	for _, name := range split(p) {
+		metadata, err := f.Backend.GetMetadataForInode(f.DB, inode)
+		if err != nil {
+			return 0, pathError("lookup", p, err)
+		}
+		if !IsDir(metadata) {
+			return 0, pathError("lookup", p, syscall.ENOTDIR)
+		}
+
+		inode, err = f.Backend.GetInodeForNameUnderInode(f.DB, inode, name)
+		if err != nil {
+			return 0, pathError("lookup", p, err)
+		}
+	}
+
+	return inode, nil
+}
+
+// lookupParent resolves the directory containing p, and returns it along
+// with the last component of p
+func (f *FS) lookupParent(op, p string) (int64, string, error) {
+	dir, name := path.Split(Clean(p))
+	if name == "" {
+		// p is the root
+		return 0, "", pathError(op, p, syscall.EINVAL)
+	}
+
+	parent, err := f.Lookup(dir)
+	if err != nil {
+		return 0, "", err
+	}
+
+	metadata, err := f.Backend.GetMetadataForInode(f.DB, parent)
+	if err != nil {
+		return 0, "", pathError(op, p, err)
+	}
+	if !IsDir(metadata) {
+		return 0, "", pathError(op, p, syscall.ENOTDIR)
+	}
+
+	return parent, name, nil
+}
+
+// Stat returns the metadata of p
+func (f *FS) Stat(p string) (sqlutils.Metadata, error) {
+	inode, err := f.Lookup(p)
+	if err != nil {
+		return sqlutils.Metadata{}, err
+	}
+
+	metadata, err := f.Backend.GetMetadataForInode(f.DB, inode)
+	if err != nil {
+		return metadata, pathError("stat", p, err)
+	}
+
+	return metadata, nil
+}
+
+// ReadDir returns the metadata of all entries in directory p
+func (f *FS) ReadDir(p string) ([]sqlutils.Metadata, error) {
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !IsDir(metadata) {
+		return nil, pathError("readdir", p, syscall.ENOTDIR)
+	}
+
+	return f.readDirInode(p, metadata.Inode)
+}
+
+func (f *FS) readDirInode(p string, inode int64) ([]sqlutils.Metadata, error) {
+	childInodes, err := f.Backend.GetDirectoryContentsForInode(f.DB, inode)
+	if err != nil {
+		return nil, pathError("readdir", p, err)
+	}
+
+	var entries []sqlutils.Metadata
+	for _, childInode := range childInodes {
+		metadata, err := f.Backend.GetMetadataForInode(f.DB, childInode)
+		if err != nil {
+			return nil, pathError("readdir", p, err)
+		}
+
+		entries = append(entries, metadata)
+	}
+
+	return entries, nil
+}
+
+// ReadFile returns the contents of file p
+func (f *FS) ReadFile(p string) ([]byte, error) {
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if IsDir(metadata) {
+		return nil, pathError("read", p, syscall.EISDIR)
+	}
+
+	data, err := f.Backend.GetFileContentsForInode(f.DB, metadata.Inode)
+	if err != nil {
+		return nil, pathError("read", p, err)
+	}
+
+	return data, nil
+}
+
+// WriteFile writes data to file p, creating it with mode perm if needed.
+// An existing file keeps its mode
+func (f *FS) WriteFile(p string, data []byte, perm os.FileMode) error {
+	parent, name, err := f.lookupParent("write", p)
+	if err != nil {
+		return err
+	}
+
+	inode, err := f.Backend.GetInodeForNameUnderInode(f.DB, parent, name)
+	switch {
+	case errors.Is(err, dbsql.ErrNoRows):
+		inode, err = f.Backend.CreateFileUnderInode(f.DB, parent, name, int64(os.Getuid()), int64(os.Getgid()))
+		if err != nil {
+			return pathError("create", p, err)
+		}
+		if err = f.Chmod(p, perm); err != nil {
+			return err
+		}
+	case err != nil:
+		return pathError("write", p, err)
+	default:
+		metadata, err := f.Backend.GetMetadataForInode(f.DB, inode)
+		if err != nil {
+			return pathError("write", p, err)
+		}
+		if IsDir(metadata) {
+			return pathError("write", p, syscall.EISDIR)
+		}
+	}
+
+	if err = f.Backend.SetFileContentsForInode(f.DB, inode, data); err != nil {
+		return pathError("write", p, err)
+	}
+
+	return nil
+}
+
+// updateMetadata applies update to the metadata of p
+func (f *FS) updateMetadata(op, p string, update func(metadata *sqlutils.Metadata)) error {
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	update(&metadata)
+
+	if err = f.Backend.SetMetadataForInode(f.DB, metadata.Inode, metadata); err != nil {
+		return pathError(op, p, err)
+	}
+
+	return nil
+}
+
+// Chmod sets the permission bits of p
+func (f *FS) Chmod(p string, perm os.FileMode) error {
+	return f.updateMetadata("chmod", p, func(metadata *sqlutils.Metadata) {
+		metadata.Mode = metadata.Mode&^int64(os.ModePerm) | int64(perm&os.ModePerm)
+	})
+}
+
+// Mkdir creates directory p
+func (f *FS) Mkdir(p string) error {
+	parent, name, err := f.lookupParent("mkdir", p)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Backend.GetInodeForNameUnderInode(f.DB, parent, name)
+	if err == nil {
+		return pathError("mkdir", p, syscall.EEXIST)
+	}
+	if !errors.Is(err, dbsql.ErrNoRows) {
+		return pathError("mkdir", p, err)
+	}
+
+	if _, err = f.Backend.CreateDirUnderInode(f.DB, parent, name, int64(os.Getuid()), int64(os.Getgid())); err != nil {
+		return pathError("mkdir", p, err)
+	}
+
+	return nil
+}
+
+// MkdirAll creates directory p along with any missing parents
+func (f *FS) MkdirAll(p string) error {
+	current := "/"
+	for _, name := range split(p) {
+		current = path.Join(current, name)
+
+		metadata, err := f.Stat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = f.Mkdir(current)
+		} else if err == nil && !IsDir(metadata) {
+			err = pathError("mkdir", current, syscall.ENOTDIR)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove removes file or empty directory p
+func (f *FS) Remove(p string) error {
+	parent, name, err := f.lookupParent("remove", p)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if IsDir(metadata) {
+		err = f.Backend.RemoveDirUnderInode(f.DB, parent, name)
+	} else {
+		err = f.Backend.RemoveFileUnderInode(f.DB, parent, name)
+	}
+	if err != nil {
+		return pathError("remove", p, err)
+	}
+
+	return nil
+}
+
+// RemoveAll removes p and everything under it
+func (f *FS) RemoveAll(p string) error {
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if IsDir(metadata) {
+		entries, err := f.readDirInode(p, metadata.Inode)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := f.RemoveAll(path.Join(Clean(p), entry.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return f.Remove(p)
+}
+
+// Rename moves oldpath to newpath, replacing newpath if it exists
+func (f *FS) Rename(oldpath, newpath string) error {
+	oldParent, oldName, err := f.lookupParent("rename", oldpath)
+	if err != nil {
+		return err
+	}
+
+	newParent, newName, err := f.lookupParent("rename", newpath)
+	if err != nil {
+		return err
+	}
+
+	err = f.Backend.RenameUnderInode(f.DB, oldParent, oldName, newParent, newName)
+	if err != nil {
+		return pathError("rename", oldpath, err)
+	}
+
+	return nil
+}
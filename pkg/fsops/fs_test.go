@@ -0,0 +1,142 @@
+package fsops
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		p, expected string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"a", "/a"},
+		{"/a/b/", "/a/b"},
+		{"a//b/./c", "/a/b/c"},
+		{"a/../b", "/b"},
+		{"../../a", "/a"},
+	}
+
+	for _, test := range tests {
+		if cleaned := Clean(test.p); cleaned != test.expected {
+			t.Errorf("Clean(%q) = %q, expected %q", test.p, cleaned, test.expected)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	f := newTestFS(t)
+	writeTestFile(t, f, "/a/b/file", []byte("contents"))
+
+	dir, err := f.Stat("/a/b")
+	if err != nil {
+		t.Fatalf("Couldn't stat /a/b: %v", err)
+	}
+	file, err := f.Stat("/a/b/file")
+	if err != nil {
+		t.Fatalf("Couldn't stat /a/b/file: %v", err)
+	}
+
+	tests := []struct {
+		p        string
+		expected int64
+		err      error
+	}{
+		{"", RootInode, nil},
+		{"/", RootInode, nil},
+		{"/a/b", dir.Inode, nil},
+		{"a/b/", dir.Inode, nil},
+		{"/a/./b/../b", dir.Inode, nil},
+		{"/a/b/file", file.Inode, nil},
+		{"/../a/b/file", file.Inode, nil},
+		{"/a/missing", 0, syscall.ENOENT},
+		{"/missing/file", 0, syscall.ENOENT},
+		{"/a/b/file/x", 0, syscall.ENOTDIR},
+	}
+
+	for _, test := range tests {
+		inode, err := f.Lookup(test.p)
+		if test.err != nil {
+			var pathErr *fs.PathError
+			if !errors.As(err, &pathErr) || !errors.Is(err, test.err) {
+				t.Errorf("Lookup(%q) returned %v, expected a path error with %v", test.p, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Couldn't look up %q: %v", test.p, err)
+		} else if inode != test.expected {
+			t.Errorf("Lookup(%q) = %d, expected %d", test.p, inode, test.expected)
+		}
+	}
+}
+
+func TestPathOperations(t *testing.T) {
+	f := newTestFS(t)
+
+	if err := f.Mkdir("/"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Mkdir(/) returned %v, expected EINVAL", err)
+	}
+	if err := f.Mkdir("/a/b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Mkdir without parent returned %v, expected ENOENT", err)
+	}
+	if err := f.MkdirAll("/a/b"); err != nil {
+		t.Fatalf("Couldn't create /a/b: %v", err)
+	}
+	if err := f.Mkdir("/a/b"); !errors.Is(err, syscall.EEXIST) {
+		t.Errorf("Mkdir of existing dir returned %v, expected EEXIST", err)
+	}
+
+	writeTestFile(t, f, "/a/b/file", []byte("one"))
+	if err := f.MkdirAll("/a/b/file/c"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("MkdirAll through a file returned %v, expected ENOTDIR", err)
+	}
+	if _, err := f.ReadFile("/a"); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("ReadFile of a dir returned %v, expected EISDIR", err)
+	}
+	if err := f.WriteFile("/a", nil, 0644); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("WriteFile of a dir returned %v, expected EISDIR", err)
+	}
+
+	// overwriting keeps the mode
+	if err := f.Chmod("/a/b/file", 0600); err != nil {
+		t.Fatalf("Couldn't chmod /a/b/file: %v", err)
+	}
+	writeTestFile(t, f, "/a/b/file", []byte("two"))
+	metadata, err := f.Stat("/a/b/file")
+	if err != nil {
+		t.Fatalf("Couldn't stat /a/b/file: %v", err)
+	}
+	if FileMode(metadata) != 0600 || metadata.Size != 3 {
+		t.Errorf("/a/b/file has mode %v and size %d, expected -rw------- and 3", FileMode(metadata), metadata.Size)
+	}
+
+	if err := f.Rename("/a/b/file", "/a/moved"); err != nil {
+		t.Fatalf("Couldn't rename /a/b/file: %v", err)
+	}
+	if data := readTestFile(t, f, "/a/moved"); string(data) != "two" {
+		t.Errorf("/a/moved has %q, expected %q", data, "two")
+	}
+	if _, err := f.Stat("/a/b/file"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of renamed file returned %v, expected ENOENT", err)
+	}
+
+	if err := f.Remove("/a"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("Remove of a non-empty dir returned %v, expected ENOTEMPTY", err)
+	}
+	if err := f.RemoveAll("/a"); err != nil {
+		t.Fatalf("Couldn't remove /a: %v", err)
+	}
+
+	entries, err := f.ReadDir("/")
+	if err != nil {
+		t.Fatalf("Couldn't read /: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("/ has %d entries after removing everything", len(entries))
+	}
+}
@@ -0,0 +1,52 @@
+package fsops
+
+import (
+	"testing"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// newTestFS returns an empty fs in a new sqlite db
+func newTestFS(t *testing.T) *FS {
+	t.Helper()
+
+	backend := sqlutils.SQLiteBackend{}
+	db, err := backend.OpenDB(t.TempDir() + "/fs.sql")
+	if err != nil {
+		t.Fatalf("Couldn't open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = backend.CreateDBTables(db); err != nil {
+		t.Fatalf("Couldn't create DB tables: %v", err)
+	}
+	if err = backend.InitializeDBRows(db); err != nil {
+		t.Fatalf("Couldn't insert initial rows: %v", err)
+	}
+
+	return &FS{Backend: backend, DB: db}
+}
+
+// writeTestFile writes contents to file p, creating its directory
+func writeTestFile(t *testing.T, f *FS, p string, contents []byte) {
+	t.Helper()
+
+	if err := f.MkdirAll(Clean(p + "/..")); err != nil {
+		t.Fatalf("Couldn't create directory of %s: %v", p, err)
+	}
+	if err := f.WriteFile(p, contents, 0644); err != nil {
+		t.Fatalf("Couldn't write %s: %v", p, err)
+	}
+}
+
+// readTestFile returns the contents of file p
+func readTestFile(t *testing.T, f *FS, p string) []byte {
+	t.Helper()
+
+	data, err := f.ReadFile(p)
+	if err != nil {
+		t.Fatalf("Couldn't read %s: %v", p, err)
+	}
+
+	return data
+}
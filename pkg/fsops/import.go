@@ -0,0 +1,422 @@
+package fsops
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// ImportOptions controls the batching of Import
+type ImportOptions struct {
+	// BatchEntries is the number of files and directories per transaction
+	BatchEntries int
+	// BatchBytes is the amount of file contents per transaction. A single
+	// file larger than this is written in parts, so that it's never held in
+	// memory whole
+	BatchBytes int64
+
+	// Progress, if set, is called after every transaction
+	Progress func(ImportProgress)
+}
+
+// ImportProgress counts what Import has done so far
+type ImportProgress struct {
+	Dirs  int64
+	Files int64
+	Bytes int64
+
+	// Skipped counts entries already present from an earlier import, and
+	// entries which can't be stored, like symlinks and devices
+	Skipped int64
+}
+
+// importer inserts a tree of files and directories under a directory of the
+// fs in batches. Paths given to it are slash separated and relative to that
+// directory
+type importer struct {
+	fs   *FS
+	dest string
+	opts ImportOptions
+
+	// dirs maps directories to their inodes. Directories which are yet to be
+	// inserted have negative placeholder inodes
+	dirs map[string]int64
+	// created has the directories inserted by this import, which can't have
+	// any entries from an earlier one
+	created map[int64]bool
+	// implicit has the directories added because something inside them came
+	// first, which get their metadata if they come later
+	implicit map[string]bool
+
+	pending      []sqlutils.Entry
+	pendingDirs  []string
+	pendingBytes int64
+	placeholder  int64
+
+	progress ImportProgress
+}
+
+// newImporter returns an importer into directory dest, which is created if needed
+func (f *FS) newImporter(dest string, opts ImportOptions) (*importer, error) {
+	if opts.BatchEntries <= 0 {
+		opts.BatchEntries = 1000
+	}
+	if opts.BatchBytes <= 0 {
+		opts.BatchBytes = 64 << 20
+	}
+
+	if err := f.MkdirAll(dest); err != nil {
+		return nil, err
+	}
+	destInode, err := f.Lookup(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &importer{
+		fs:       f,
+		dest:     Clean(dest),
+		opts:     opts,
+		dirs:     map[string]int64{".": destInode},
+		created:  map[int64]bool{},
+		implicit: map[string]bool{},
+	}, nil
+}
+
+// Import copies the contents of local directory src into directory dest,
+// which is created if needed. Entries are inserted in large transactions.
+//
+// Files which already exist with the same size and mtime are skipped, so an
+// interrupted import can be resumed by running it again. Other existing files
+// are overwritten
+func (f *FS) Import(src, dest string, opts ImportOptions) error {
+	fileinfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fileinfo.IsDir() {
+		return &os.PathError{Op: "import", Path: src, Err: syscall.ENOTDIR}
+	}
+
+	im, err := f.newImporter(dest, opts)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(src, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		fileinfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if !fileinfo.IsDir() && !fileinfo.Mode().IsRegular() {
+			log.Printf("Skipping %s: only regular files and directories can be stored\n", p)
+			im.progress.Skipped++
+			return nil
+		}
+
+		return im.add(filepath.ToSlash(rel), localMetadata(fileinfo), func() (io.ReadCloser, error) {
+			return os.Open(p)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return im.flush()
+}
+
+// dir returns the inode of directory p, adding it if it wasn't seen yet
+func (im *importer) dir(p string) (int64, error) {
+	if inode, ok := im.dirs[p]; ok {
+		return inode, nil
+	}
+
+	now := time.Now().UnixNano()
+	err := im.add(p, sqlutils.Metadata{
+		Uid:   int64(os.Getuid()),
+		Gid:   int64(os.Getgid()),
+		Mode:  int64(os.ModeDir | 0755),
+		Type:  int64(fuse.DT_Dir),
+		Ctime: now,
+		Atime: now,
+		Mtime: now,
+		Name:  path.Base(p),
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	im.implicit[p] = true
+
+	return im.dirs[p], nil
+}
+
+// add adds the file or directory p to the pending batch, unless it was
+// already imported. open opens the contents of a file, which metadata.Size
+// says the size of. Files larger than BatchBytes are written in parts
+func (im *importer) add(p string, metadata sqlutils.Metadata, open func() (io.ReadCloser, error)) error {
+	isDir := metadata.Type == int64(fuse.DT_Dir)
+	if _, ok := im.dirs[p]; ok {
+		if !isDir {
+			return pathError("import", path.Join(im.dest, p), syscall.EISDIR)
+		}
+		if im.implicit[p] {
+			return im.setImplicitDir(p, metadata)
+		}
+		return nil
+	}
+
+	parent, err := im.dir(path.Dir(p))
+	if err != nil {
+		return err
+	}
+
+	metadata.Name = path.Base(p)
+
+	if parent > 0 && !im.created[parent] {
+		done, err := im.addExisting(p, parent, metadata, open)
+		if done || err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	if isDir {
+		im.progress.Dirs++
+	} else if metadata.Size > im.opts.BatchBytes {
+		return im.addLarge(p, parent, metadata, open)
+	} else {
+		if data, err = readAll(open); err != nil {
+			return err
+		}
+		metadata.Size = int64(len(data))
+
+		im.progress.Files++
+		im.progress.Bytes += metadata.Size
+	}
+
+	im.placeholder--
+	metadata.Inode = im.placeholder
+	if isDir {
+		im.dirs[p] = metadata.Inode
+		im.pendingDirs = append(im.pendingDirs, p)
+	}
+
+	im.pending = append(im.pending, sqlutils.Entry{Metadata: metadata, Parent: parent, Data: data})
+	im.pendingBytes += int64(len(data))
+
+	if len(im.pending) >= im.opts.BatchEntries || im.pendingBytes >= im.opts.BatchBytes {
+		return im.flush()
+	}
+
+	return nil
+}
+
+// addLarge adds file p, which is too large for a batch. It's inserted empty,
+// with the pending batch, and then written a part at a time
+func (im *importer) addLarge(p string, parent int64, metadata sqlutils.Metadata, open func() (io.ReadCloser, error)) error {
+	im.placeholder--
+	metadata.Inode = im.placeholder
+	im.pending = append(im.pending, sqlutils.Entry{Metadata: metadata, Parent: parent})
+	if err := im.flush(); err != nil {
+		return err
+	}
+
+	// the parent may have been pending too
+	parent, err := im.dir(path.Dir(p))
+	if err != nil {
+		return err
+	}
+
+	f := im.fs
+	inode, err := f.Backend.GetInodeForNameUnderInode(f.DB, parent, metadata.Name)
+	if err != nil {
+		return pathError("import", path.Join(im.dest, p), err)
+	}
+
+	if err = im.writeParts(p, inode, metadata.Size, open); err != nil {
+		return err
+	}
+
+	im.progress.Files++
+	im.progress.Bytes += metadata.Size
+
+	return nil
+}
+
+// writeParts writes the contents of file p, size bytes opened by open, to
+// inode a part at a time
+func (im *importer) writeParts(p string, inode, size int64, open func() (io.ReadCloser, error)) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buf := make([]byte, readChunk)
+
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 || offset == 0 {
+			if err := sqlutils.AppendFileContents(im.fs.DB, inode, offset, buf[:n]); err != nil {
+				return pathError("import", path.Join(im.dest, p), err)
+			}
+			offset += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if offset != size {
+		return fmt.Errorf("import: %s has %d bytes, expected %d", path.Join(im.dest, p), offset, size)
+	}
+
+	return nil
+}
+
+// readAll returns the contents opened by open
+func readAll(open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// setImplicitDir gives directory p, which was added before it came up itself,
+// its metadata. It's updated in the pending batch, or in the db if the batch
+// was inserted already
+func (im *importer) setImplicitDir(p string, metadata sqlutils.Metadata) error {
+	delete(im.implicit, p)
+
+	metadata.Inode = im.dirs[p]
+	metadata.Name = path.Base(p)
+
+	if metadata.Inode < 0 {
+		for i := range im.pending {
+			if im.pending[i].Inode == metadata.Inode {
+				im.pending[i].Metadata = metadata
+				return nil
+			}
+		}
+	}
+
+	f := im.fs
+	if err := f.Backend.SetMetadataForInode(f.DB, metadata.Inode, metadata); err != nil {
+		return pathError("import", path.Join(im.dest, p), err)
+	}
+
+	return nil
+}
+
+// addExisting handles p when an entry with the same name may already exist in
+// directory parent. It reports whether p was dealt with
+func (im *importer) addExisting(p string, parent int64, metadata sqlutils.Metadata, open func() (io.ReadCloser, error)) (bool, error) {
+	f := im.fs
+
+	inode, err := f.Backend.GetInodeForNameUnderInode(f.DB, parent, metadata.Name)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, pathError("import", path.Join(im.dest, p), err)
+	}
+
+	existing, err := f.Backend.GetMetadataForInode(f.DB, inode)
+	if err != nil {
+		return false, pathError("import", path.Join(im.dest, p), err)
+	}
+
+	switch {
+	case IsDir(existing) != (metadata.Type == int64(fuse.DT_Dir)):
+		return false, pathError("import", path.Join(im.dest, p), syscall.EEXIST)
+	case IsDir(existing):
+		im.dirs[p] = inode
+		im.progress.Skipped++
+		return true, nil
+	case existing.Size == metadata.Size && existing.Mtime == metadata.Mtime:
+		im.progress.Skipped++
+		return true, nil
+	}
+
+	// the file changed since it was imported
+	if metadata.Size > im.opts.BatchBytes {
+		if err = im.writeParts(p, inode, metadata.Size, open); err != nil {
+			return false, err
+		}
+	} else {
+		data, err := readAll(open)
+		if err != nil {
+			return false, err
+		}
+		if err = f.Backend.SetFileContentsForInode(f.DB, inode, data); err != nil {
+			return false, pathError("import", path.Join(im.dest, p), err)
+		}
+		metadata.Size = int64(len(data))
+	}
+
+	metadata.Inode = inode
+	if err = f.Backend.SetMetadataForInode(f.DB, inode, metadata); err != nil {
+		return false, pathError("import", path.Join(im.dest, p), err)
+	}
+
+	im.progress.Files++
+	im.progress.Bytes += metadata.Size
+
+	return true, nil
+}
+
+// flush inserts the pending batch in a single transaction
+func (im *importer) flush() error {
+	if len(im.pending) > 0 {
+		allocated, err := sqlutils.InsertEntries(im.fs.Backend, im.fs.DB, im.pending)
+		if err != nil {
+			return errno(err)
+		}
+
+		for _, p := range im.pendingDirs {
+			inode := allocated[im.dirs[p]]
+			im.dirs[p] = inode
+			im.created[inode] = true
+		}
+
+		im.pending = nil
+		im.pendingDirs = nil
+		im.pendingBytes = 0
+	}
+
+	if im.opts.Progress != nil {
+		im.opts.Progress(im.progress)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package fsops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLocalFile writes contents to local file p, creating its directory,
+// with mtime
+func writeLocalFile(t *testing.T, p string, contents []byte, mtime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatalf("Couldn't create directory of %s: %v", p, err)
+	}
+	if err := os.WriteFile(p, contents, 0644); err != nil {
+		t.Fatalf("Couldn't write %s: %v", p, err)
+	}
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatalf("Couldn't set times of %s: %v", p, err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	f := newTestFS(t)
+	src := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+
+	writeLocalFile(t, src+"/a", []byte("first"), mtime)
+	writeLocalFile(t, src+"/dir/b", []byte("second"), mtime)
+	writeLocalFile(t, src+"/dir/sub/c", []byte("third"), mtime)
+	writeLocalFile(t, src+"/dir/sub/empty", nil, mtime)
+
+	var progress ImportProgress
+	opts := ImportOptions{BatchEntries: 2, Progress: func(p ImportProgress) { progress = p }}
+	if err := f.Import(src, "/dest", opts); err != nil {
+		t.Fatalf("Couldn't import: %v", err)
+	}
+
+	expected := ImportProgress{Dirs: 2, Files: 4, Bytes: 16}
+	if progress != expected {
+		t.Errorf("Import reported %+v, expected %+v", progress, expected)
+	}
+
+	for p, contents := range map[string]string{
+		"/dest/a":             "first",
+		"/dest/dir/b":         "second",
+		"/dest/dir/sub/c":     "third",
+		"/dest/dir/sub/empty": "",
+	} {
+		if data := readTestFile(t, f, p); string(data) != contents {
+			t.Errorf("%s has %q, expected %q", p, data, contents)
+		}
+
+		metadata, err := f.Stat(p)
+		if err != nil {
+			t.Fatalf("Couldn't stat %s: %v", p, err)
+		}
+		if metadata.Mtime != mtime.UnixNano() {
+			t.Errorf("%s has mtime %v, expected %v", p, Time(metadata.Mtime), mtime)
+		}
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	f := newTestFS(t)
+	src := t.TempDir()
+	mtime := time.Unix(1600000000, 0)
+
+	writeLocalFile(t, src+"/same", []byte("unchanged"), mtime)
+	writeLocalFile(t, src+"/dir/changed", []byte("old"), mtime)
+	writeLocalFile(t, src+"/dir/touched", []byte("old"), mtime)
+
+	if err := f.Import(src, "/", ImportOptions{}); err != nil {
+		t.Fatalf("Couldn't import: %v", err)
+	}
+
+	sameBefore, err := f.Stat("/same")
+	if err != nil {
+		t.Fatalf("Couldn't stat /same: %v", err)
+	}
+
+	// same size, newer mtime
+	writeLocalFile(t, src+"/dir/touched", []byte("new"), mtime.Add(time.Second))
+	// different size, same mtime
+	writeLocalFile(t, src+"/dir/changed", []byte("newer"), mtime)
+	writeLocalFile(t, src+"/dir/added", []byte("added"), mtime)
+
+	// small enough batches for the files to be written in parts
+	var progress ImportProgress
+	opts := ImportOptions{BatchBytes: 2, Progress: func(p ImportProgress) { progress = p }}
+	if err := f.Import(src, "/", opts); err != nil {
+		t.Fatalf("Couldn't resume import: %v", err)
+	}
+
+	// /same and /dir are skipped
+	expected := ImportProgress{Files: 3, Bytes: 13, Skipped: 2}
+	if progress != expected {
+		t.Errorf("resumed Import reported %+v, expected %+v", progress, expected)
+	}
+
+	sameAfter, err := f.Stat("/same")
+	if err != nil {
+		t.Fatalf("Couldn't stat /same: %v", err)
+	}
+	if sameAfter != sameBefore {
+		t.Errorf("/same changed from %+v to %+v, expected it to be skipped", sameBefore, sameAfter)
+	}
+
+	for p, contents := range map[string]string{
+		"/same":        "unchanged",
+		"/dir/changed": "newer",
+		"/dir/touched": "new",
+		"/dir/added":   "added",
+	} {
+		if data := readTestFile(t, f, p); string(data) != contents {
+			t.Errorf("%s has %q, expected %q", p, data, contents)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package fsops
+
+import (
+	"os"
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// localMetadata returns the metadata of a local file, including ownership
+// and all timestamps
+func localMetadata(fileinfo os.FileInfo) sqlutils.Metadata {
+	metadata := localMetadataFromMode(fileinfo)
+
+	if stat, ok := fileinfo.Sys().(*syscall.Stat_t); ok {
+		metadata.Uid = int64(stat.Uid)
+		metadata.Gid = int64(stat.Gid)
+		metadata.Atime = stat.Atim.Nano()
+		metadata.Ctime = stat.Ctim.Nano()
+	}
+
+	return metadata
+}
+
+// localMetadataFromMode returns the metadata of a local file from its
+// os.FileInfo, owned by the current user
+func localMetadataFromMode(fileinfo os.FileInfo) sqlutils.Metadata {
+	mtime := fileinfo.ModTime().UnixNano()
+	metadata := sqlutils.Metadata{
+		Uid:   int64(os.Getuid()),
+		Gid:   int64(os.Getgid()),
+		Mode:  int64(fileinfo.Mode().Perm()),
+		Type:  int64(fuse.DT_File),
+		Ctime: mtime,
+		Atime: mtime,
+		Mtime: mtime,
+		Name:  fileinfo.Name(),
+		Size:  fileinfo.Size(),
+	}
+
+	if fileinfo.IsDir() {
+		metadata.Mode |= int64(os.ModeDir)
+		metadata.Type = int64(fuse.DT_Dir)
+		metadata.Size = 0
+	}
+
+	return metadata
+}
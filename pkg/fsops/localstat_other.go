@@ -0,0 +1,41 @@
+//go:build !linux
+
+package fsops
+
+import (
+	"os"
+
+	"bazil.org/fuse"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// localMetadata returns the metadata of a local file. Ownership and times
+// other than mtime aren't portable, so the current user and mtime are used
+func localMetadata(fileinfo os.FileInfo) sqlutils.Metadata {
+	return localMetadataFromMode(fileinfo)
+}
+
+// localMetadataFromMode returns the metadata of a local file from its
+// os.FileInfo, owned by the current user
+func localMetadataFromMode(fileinfo os.FileInfo) sqlutils.Metadata {
+	mtime := fileinfo.ModTime().UnixNano()
+	metadata := sqlutils.Metadata{
+		Uid:   int64(os.Getuid()),
+		Gid:   int64(os.Getgid()),
+		Mode:  int64(fileinfo.Mode().Perm()),
+		Type:  int64(fuse.DT_File),
+		Ctime: mtime,
+		Atime: mtime,
+		Mtime: mtime,
+		Name:  fileinfo.Name(),
+		Size:  fileinfo.Size(),
+	}
+
+	if fileinfo.IsDir() {
+		metadata.Mode |= int64(os.ModeDir)
+		metadata.Type = int64(fuse.DT_Dir)
+		metadata.Size = 0
+	}
+
+	return metadata
+}
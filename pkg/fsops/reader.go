@@ -0,0 +1,69 @@
+package fsops
+
+import (
+	"io"
+	"syscall"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// readChunk is the amount of file contents fetched from the db at a time
+const readChunk = 1 << 20
+
+// fileReader streams the contents of a file from the db a chunk at a time
+type fileReader struct {
+	fs    *FS
+	p     string
+	inode int64
+
+	offset int64
+	size   int64
+	buf    []byte
+}
+
+// Open returns a reader for the contents of file p, which fetches them from
+// the db in chunks instead of loading the whole file
+func (f *FS) Open(p string) (io.Reader, error) {
+	metadata, err := f.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if IsDir(metadata) {
+		return nil, pathError("open", p, syscall.EISDIR)
+	}
+
+	return f.openInode(p, metadata), nil
+}
+
+// openInode returns a reader for the contents of the file p described by metadata
+func (f *FS) openInode(p string, metadata sqlutils.Metadata) io.Reader {
+	return &fileReader{fs: f, p: p, inode: metadata.Inode, size: metadata.Size}
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+
+		want := r.size - r.offset
+		if want > readChunk {
+			want = readChunk
+		}
+
+		data, err := r.fs.Backend.GetFileRangeForInode(r.fs.DB, r.inode, r.offset, want)
+		if err != nil {
+			return 0, pathError("read", r.p, err)
+		}
+
+		// like GetFileContentsForInode, contents shorter than size read as zeros
+		r.buf = make([]byte, want)
+		copy(r.buf, data)
+		r.offset += want
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
@@ -0,0 +1,196 @@
+package fsops
+
+import (
+	"archive/tar"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"bazil.org/fuse"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// xattrPrefix starts the PAX records which hold extended attributes
+const xattrPrefix = "SCHILY.xattr."
+
+// WriteTar writes src, a file or directory in the fs, to w as a PAX tar
+// archive. The entries of a directory are named relative to it, like
+// `tar -C src .`. File contents are streamed from the db
+func (f *FS) WriteTar(w io.Writer, src string) error {
+	metadata, err := f.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	if IsDir(metadata) {
+		err = f.writeTarDir(tw, Clean(src), ".", metadata)
+	} else {
+		err = f.writeTarEntry(tw, Clean(src), metadata.Name, metadata)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func (f *FS) writeTarDir(tw *tar.Writer, p, name string, metadata sqlutils.Metadata) error {
+	if err := f.writeTarEntry(tw, p, name, metadata); err != nil {
+		return err
+	}
+
+	entries, err := f.readDirInode(p, metadata.Inode)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		childPath, childName := path.Join(p, entry.Name), path.Join(name, entry.Name)
+		if IsDir(entry) {
+			err = f.writeTarDir(tw, childPath, childName, entry)
+		} else {
+			err = f.writeTarEntry(tw, childPath, childName, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTarEntry writes the header for p, named name in the archive, along
+// with its contents if it's a file
+func (f *FS) writeTarEntry(tw *tar.Writer, p, name string, metadata sqlutils.Metadata) error {
+	header := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Mode:       int64(FileMode(metadata).Perm()),
+		Uid:        int(metadata.Uid),
+		Gid:        int(metadata.Gid),
+		Size:       metadata.Size,
+		ModTime:    Time(metadata.Mtime),
+		AccessTime: Time(metadata.Atime),
+		ChangeTime: Time(metadata.Ctime),
+		Format:     tar.FormatPAX,
+	}
+	if IsDir(metadata) {
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		header.Size = 0
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if IsDir(metadata) {
+		return nil
+	}
+
+	reader, err := f.Open(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, reader)
+	return err
+}
+
+// ReadTar extracts the tar archive read from r into directory dest, which is
+// created if needed. Entries are inserted in batches like Import, members
+// larger than opts.BatchBytes are written a part at a time as they're read,
+// and existing files with the same size and mtime are skipped. A directory whose
+// header comes after entries inside it, as with `tar --append`, gets the
+// metadata in its header all the same.
+//
+// Only regular files and directories are extracted. Extended attributes
+// aren't stored by sqlfs and are dropped. If sameOwner is false, entries are
+// owned by the current user instead of the owner in the archive
+func (f *FS) ReadTar(r io.Reader, dest string, sameOwner bool, opts ImportOptions) error {
+	im, err := f.newImporter(dest, opts)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// keep everything inside dest
+		p := strings.TrimPrefix(Clean(header.Name), "/")
+		if p == "" {
+			continue
+		}
+
+		for key := range header.PAXRecords {
+			if strings.HasPrefix(key, xattrPrefix) {
+				log.Printf("Dropping extended attributes of %s: sqlfs doesn't store them\n", header.Name)
+				break
+			}
+		}
+
+		metadata := tarMetadata(header)
+		if !sameOwner {
+			metadata.Uid, metadata.Gid = int64(os.Getuid()), int64(os.Getgid())
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = im.add(p, metadata, nil)
+		case tar.TypeReg, tar.TypeRegA:
+			err = im.add(p, metadata, func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			})
+		default:
+			log.Printf("Skipping %s: only regular files and directories can be stored\n", header.Name)
+			im.progress.Skipped++
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return im.flush()
+}
+
+// tarMetadata returns the metadata described by header
+func tarMetadata(header *tar.Header) sqlutils.Metadata {
+	mtime := header.ModTime.UnixNano()
+	atime, ctime := mtime, mtime
+	if !header.AccessTime.IsZero() {
+		atime = header.AccessTime.UnixNano()
+	}
+	if !header.ChangeTime.IsZero() {
+		ctime = header.ChangeTime.UnixNano()
+	}
+
+	metadata := sqlutils.Metadata{
+		Uid:   int64(header.Uid),
+		Gid:   int64(header.Gid),
+		Mode:  header.Mode & int64(os.ModePerm),
+		Type:  int64(fuse.DT_File),
+		Ctime: ctime,
+		Atime: atime,
+		Mtime: mtime,
+		Size:  header.Size,
+	}
+
+	if header.Typeflag == tar.TypeDir {
+		metadata.Mode |= int64(os.ModeDir)
+		metadata.Type = int64(fuse.DT_Dir)
+		metadata.Size = 0
+	}
+
+	return metadata
+}
@@ -0,0 +1,123 @@
+package fsops
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	f := newTestFS(t)
+	large := randomBytes(readChunk + 1)
+	writeTestFile(t, f, "/src/large", large)
+	writeTestFile(t, f, "/src/dir/small", []byte("small"))
+	if err := f.MkdirAll("/src/dir/empty"); err != nil {
+		t.Fatalf("Couldn't create /src/dir/empty: %v", err)
+	}
+	if err := f.Chmod("/src/dir", 0700); err != nil {
+		t.Fatalf("Couldn't chmod /src/dir: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := f.WriteTar(&archive, "/src"); err != nil {
+		t.Fatalf("Couldn't write tar: %v", err)
+	}
+
+	// large files are read whole with the default batches, and written a
+	// part at a time with small ones
+	for _, batchBytes := range []int64{64 << 20, 1000} {
+		to := newTestFS(t)
+		var progress ImportProgress
+		opts := ImportOptions{BatchBytes: batchBytes, Progress: func(p ImportProgress) { progress = p }}
+		if err := to.ReadTar(bytes.NewReader(archive.Bytes()), "/dest", true, opts); err != nil {
+			t.Fatalf("batches of %d bytes: couldn't read tar: %v", batchBytes, err)
+		}
+
+		expected := ImportProgress{Dirs: 2, Files: 2, Bytes: int64(len(large)) + 5}
+		if progress != expected {
+			t.Errorf("batches of %d bytes: ReadTar reported %+v, expected %+v", batchBytes, progress, expected)
+		}
+
+		for _, p := range []string{"/large", "/dir", "/dir/small", "/dir/empty"} {
+			expected, err := f.Stat("/src" + p)
+			if err != nil {
+				t.Fatalf("Couldn't stat /src%s: %v", p, err)
+			}
+			extracted, err := to.Stat("/dest" + p)
+			if err != nil {
+				t.Fatalf("batches of %d bytes: couldn't stat extracted /dest%s: %v", batchBytes, p, err)
+			}
+
+			// PAX headers keep times to the ns, only inodes differ
+			expected.Inode, extracted.Inode = 0, 0
+			if extracted != expected {
+				t.Errorf("batches of %d bytes: extracted %s has metadata %+v, expected %+v",
+					batchBytes, p, extracted, expected)
+			}
+		}
+
+		if data := readTestFile(t, to, "/dest/large"); !bytes.Equal(data, large) {
+			t.Errorf("batches of %d bytes: extracted /large has %d bytes, which differ from the %d archived",
+				batchBytes, len(data), len(large))
+		}
+		if data := readTestFile(t, to, "/dest/dir/small"); string(data) != "small" {
+			t.Errorf("batches of %d bytes: extracted /dir/small has %q, expected %q", batchBytes, data, "small")
+		}
+	}
+}
+
+func TestTarDirAfterEntries(t *testing.T) {
+	mtime := time.Unix(1600000000, 0)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "a/b/file", Mode: 0644, ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "a/other", Mode: 0644, ModTime: mtime},
+		{Typeflag: tar.TypeDir, Name: "a/b/", Mode: 0700, Uid: 1234, Gid: 5678, ModTime: mtime},
+		{Typeflag: tar.TypeDir, Name: "a/", Mode: 0750, Uid: 4321, Gid: 8765, ModTime: mtime},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Couldn't write tar header: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Couldn't write tar: %v", err)
+	}
+
+	// directories are still pending with large batches, and inserted
+	// already with batches of one entry
+	for _, batchEntries := range []int{1000, 1} {
+		f := newTestFS(t)
+		err := f.ReadTar(bytes.NewReader(archive.Bytes()), "/", true, ImportOptions{BatchEntries: batchEntries})
+		if err != nil {
+			t.Fatalf("Couldn't read tar: %v", err)
+		}
+
+		for p, expected := range map[string]struct {
+			mode     os.FileMode
+			uid, gid int64
+		}{
+			"/a":   {os.ModeDir | 0750, 4321, 8765},
+			"/a/b": {os.ModeDir | 0700, 1234, 5678},
+		} {
+			metadata, err := f.Stat(p)
+			if err != nil {
+				t.Fatalf("Couldn't stat %s: %v", p, err)
+			}
+			if FileMode(metadata) != expected.mode || metadata.Uid != expected.uid || metadata.Gid != expected.gid {
+				t.Errorf("batches of %d: %s has mode %v and owner %d:%d, expected %v and %d:%d", batchEntries, p,
+					FileMode(metadata), metadata.Uid, metadata.Gid, expected.mode, expected.uid, expected.gid)
+			}
+			if metadata.Mtime != mtime.UnixNano() {
+				t.Errorf("batches of %d: %s has mtime %v, expected %v", batchEntries, p, Time(metadata.Mtime), mtime)
+			}
+		}
+
+		if _, err := f.Stat("/a/b/file"); err != nil {
+			t.Errorf("batches of %d: couldn't stat /a/b/file: %v", batchEntries, err)
+		}
+	}
+}
@@ -17,9 +17,9 @@ var _ fs.Node = (*Dir)(nil)
 var _ fs.Node = (*File)(nil)
 
 // setAttrFromMetadata populates the fuse attr object with details fetched from
-// db for the given inode
-func setAttrFromMetadata(db *sql.DB, inode int32, attr *fuse.Attr) error {
-	metadata, err := Backend.GetMetadataForInode(db, inode)
+// the db of fsys for the given inode
+func setAttrFromMetadata(fsys *FS, inode int64, attr *fuse.Attr) error {
+	metadata, err := Backend.GetMetadataForInode(fsys.db, inode)
 	if err != nil {
 		log.Println("Failed to update metadata for dir!")
 		return err
@@ -33,18 +33,25 @@ func setAttrFromMetadata(db *sql.DB, inode int32, attr *fuse.Attr) error {
 	attr.Atime = time.Unix(metadata.Atime/1e9, metadata.Atime%1e9)
 	attr.Size = uint64(metadata.Size)
 
+	if fsys.opts.Uid != nil {
+		attr.Uid = *fsys.opts.Uid
+	}
+	if fsys.opts.Gid != nil {
+		attr.Gid = *fsys.opts.Gid
+	}
+
 	return nil
 }
 
 // Attr retrieves metadata attr for dir
 func (d *Dir) Attr(ctx context.Context, attr *fuse.Attr) (err error) {
-	err = setAttrFromMetadata(d.db, d.inode, attr)
+	err = setAttrFromMetadata(d.fs, d.inode, attr)
 	return
 }
 
 // Attr retrieves metadata attr for file
 func (f *File) Attr(ctx context.Context, attr *fuse.Attr) (err error) {
-	err = setAttrFromMetadata(f.db, f.inode, attr)
+	err = setAttrFromMetadata(f.fs, f.inode, attr)
 	return
 }
 
@@ -54,7 +61,7 @@ var _ fs.NodeSetattrer = (*File)(nil)
 // getUpdatedMetadataForSetattr generates the Metadata struct based on attributes
 // from setattr req for a given inode. It loads the current values from db
 // and returns the updated Metadata
-func getUpdatedMetadataForSetattr(db *sql.DB, inode int32, req *fuse.SetattrRequest) (sqlutils.Metadata, error) {
+func getUpdatedMetadataForSetattr(db *sql.DB, inode int64, req *fuse.SetattrRequest) (sqlutils.Metadata, error) {
 	metadata, err := Backend.GetMetadataForInode(db, inode)
 	if err != nil {
 		log.Println("Couldn't get metadata for setattr!")
@@ -112,20 +119,27 @@ func getUpdatedMetadataForSetattr(db *sql.DB, inode int32, req *fuse.SetattrRequ
 	if req.Valid.Uid() {
 		metadata.Uid = int64(req.Uid)
 	}
+	if req.Valid.Gid() {
+		metadata.Gid = int64(req.Gid)
+	}
 
 	return metadata, nil
 }
 
 // Setattr updates the metadata table on db based on req
 func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, res *fuse.SetattrResponse) error {
-	metadata, err := getUpdatedMetadataForSetattr(d.db, d.inode, req)
+	if d.fs.opts.ReadOnly {
+		return errReadOnly
+	}
+
+	metadata, err := getUpdatedMetadataForSetattr(d.fs.db, d.inode, req)
 	if err != nil {
 		return err
 	}
 
 	metadata.Mode ^= int64(os.ModeDir)
 
-	if err := Backend.SetMetadataForInode(d.db, d.inode, metadata); err != nil {
+	if err := Backend.SetMetadataForInode(d.fs.db, d.inode, metadata); err != nil {
 		log.Println("Failed to set metadata in setattr!")
 		return err
 	}
@@ -135,12 +149,16 @@ func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, res *fuse.S
 
 // Setattr updates the metadata table on db based on req
 func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, res *fuse.SetattrResponse) error {
-	metadata, err := getUpdatedMetadataForSetattr(f.db, f.inode, req)
+	if f.fs.opts.ReadOnly {
+		return errReadOnly
+	}
+
+	metadata, err := getUpdatedMetadataForSetattr(f.fs.db, f.inode, req)
 	if err != nil {
 		return err
 	}
 
-	if err := Backend.SetMetadataForInode(f.db, f.inode, metadata); err != nil {
+	if err := Backend.SetMetadataForInode(f.fs.db, f.inode, metadata); err != nil {
 		log.Println("Failed to set metadata in setattr!")
 		return err
 	}
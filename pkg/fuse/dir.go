@@ -16,7 +16,7 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	var ret []fuse.Dirent
 
 	var currentInode = d.inode
-	childInodes, err := Backend.GetDirectoryContentsForInode(d.db, int32(currentInode))
+	childInodes, err := Backend.GetDirectoryContentsForInode(d.fs.db, currentInode)
 	if err != nil {
 		log.Println(err)
 		return ret, fuse.ENOENT
@@ -25,7 +25,7 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	for _, childInode := range childInodes {
 		var dirent fuse.Dirent
 
-		metadata, err := Backend.GetMetadataForInode(d.db, childInode)
+		metadata, err := Backend.GetMetadataForInode(d.fs.db, childInode)
 		if err == nil {
 			dirent.Inode = uint64(childInode)
 			dirent.Name = metadata.Name
@@ -57,7 +57,7 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, res *fuse.Loo
 		if dirent.Name == path {
 			// yeah, looking up the db twice :(
 			// TODO: make it faster. extract relevant stuff from ReadDirAll
-			metadata, err := Backend.GetMetadataForInode(d.db, int32(dirent.Inode))
+			metadata, err := Backend.GetMetadataForInode(d.fs.db, int64(dirent.Inode))
 			if err != nil {
 				log.Println("Couldn't get metadata for inode!")
 				return nil, fuse.ENOENT
@@ -65,15 +65,19 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, res *fuse.Loo
 
 			switch metadata.Type {
 			case int64(fuse.DT_File):
-				return &File{d.db, int32(metadata.Inode)}, nil
+				return &File{d.fs, metadata.Inode}, nil
 			case int64(fuse.DT_Dir):
-				return &Dir{d.db, int32(metadata.Inode)}, nil
+				return &Dir{d.fs, metadata.Inode}, nil
 			default:
 				return nil, fuse.ENOENT
 			}
 		}
 	}
 
+	if path == versionsDirName {
+		return lookupVersionsDir(d.fs, d.inode)
+	}
+
 	return nil, fuse.ENOENT
 }
 
@@ -81,24 +85,32 @@ var _ = fs.NodeMkdirer(&Dir{})
 
 // Mkdir creates a directory under Dir d
 func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
-	inode, err := Backend.CreateDirUnderInode(d.db, d.inode, req.Name)
+	if d.fs.opts.ReadOnly {
+		return nil, errReadOnly
+	}
+
+	inode, err := Backend.CreateDirUnderInode(d.fs.db, d.inode, req.Name, int64(req.Uid), int64(req.Gid))
 	if err != nil {
 		log.Println("Couldn't Mkdir!")
 		return nil, err
 	}
 
-	return &Dir{d.db, inode}, nil
+	return &Dir{d.fs, inode}, nil
 }
 
 var _ = fs.NodeCreater(&Dir{})
 
 // Create creates a file under Dir d
 func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, res *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	if d.fs.opts.ReadOnly {
+		return nil, nil, errReadOnly
+	}
+
 	// TODO: umask, flags, mode
 	var f File
-	f.db = d.db
+	f.fs = d.fs
 
-	inode, err := Backend.CreateFileUnderInode(d.db, d.inode, req.Name)
+	inode, err := Backend.CreateFileUnderInode(d.fs.db, d.inode, req.Name, int64(req.Uid), int64(req.Gid))
 	if err != nil {
 		log.Println("Couldn't create file!")
 		return nil, nil, err
@@ -106,19 +118,23 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, res *fuse.Cre
 	f.inode = inode
 
 	res.OpenResponse.Flags |= fuse.OpenNonSeekable
-	return &f, &FileHandle{d.db, f.inode, &f}, nil
+	return &f, &FileHandle{d.fs, f.inode, &f}, nil
 }
 
 var _ = fs.NodeRemover(&Dir{})
 
 // Remove removes a directory or file based on req under Dir d
 func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if d.fs.opts.ReadOnly {
+		return errReadOnly
+	}
+
 	var err error
 
 	if req.Dir {
-		err = Backend.RemoveDirUnderInode(d.db, d.inode, req.Name)
+		err = Backend.RemoveDirUnderInode(d.fs.db, d.inode, req.Name)
 	} else {
-		err = Backend.RemoveFileUnderInode(d.db, d.inode, req.Name)
+		err = Backend.RemoveFileUnderInode(d.fs.db, d.inode, req.Name)
 	}
 
 	return err
@@ -1,8 +1,13 @@
 package fuse
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"bazil.org/fuse/fs/fstestutil"
+	sql "github.com/jmoiron/sqlx"
+
 	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
 )
 
@@ -19,6 +24,11 @@ func getTestingBackends(t *testing.T) []backendTestSpec {
 			backend: sqlutils.SQLiteBackend{},
 			name:    "sqlite",
 		},
+		{
+			dsn:     t.TempDir() + "/fs.sql",
+			backend: sqlutils.PureGoSQLiteBackend{},
+			name:    "sqlite-purego",
+		},
 		{
 			dsn:     setupMySQLContainer(t),
 			backend: sqlutils.MySQLBackend{},
@@ -29,6 +39,30 @@ func getTestingBackends(t *testing.T) []backendTestSpec {
 			backend: sqlutils.PostgresBackend{},
 			name:    "postgres",
 		},
+		{
+			dsn:     setupCockroachContainer(t),
+			backend: sqlutils.CockroachBackend{},
+			name:    "cockroach",
+		},
+	}
+}
+
+// runWithDB runs test on every backend, with an empty fs mounted with opts
+// and its db, unmounting and closing both afterwards
+func runWithDB(t *testing.T, opts MountOptions, test func(t *testing.T, mnt *fstestutil.Mount, db *sql.DB)) {
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			mnt := getMountedFSWithOptions(t, tc.backend, tc.dsn, opts)
+			defer mnt.Close()
+
+			db, err := tc.backend.OpenDB(tc.dsn)
+			if err != nil {
+				t.Fatalf("Couldn't open db: %v", err)
+			}
+			defer db.Close()
+
+			test(t, mnt, db)
+		})
 	}
 }
 
@@ -64,3 +98,107 @@ func TestBasicDirectoryOperations(t *testing.T) {
 	}
 
 }
+
+func TestTablePrefix(t *testing.T) {
+	if err := sqlutils.SetTablePrefix("sqlfs_"); err != nil {
+		t.Fatalf("Couldn't set table prefix: %v", err)
+	}
+	defer sqlutils.SetTablePrefix("")
+
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			mnt := getMountedFS(t, tc.backend, tc.dsn)
+			defer mnt.Close()
+
+			testBasicFileOperations(t, mnt)
+			testBasicDirOperations(t, mnt)
+		})
+	}
+}
+
+func TestLargeFile(t *testing.T) {
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			mnt := getMountedFS(t, tc.backend, tc.dsn)
+			defer mnt.Close()
+
+			testLargeFile(t, mnt, 4<<20)
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	contents := []byte("can't touch this")
+
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			mnt := getMountedFS(t, tc.backend, tc.dsn)
+			err := ioutil.WriteFile(mnt.Dir+"/testfile", contents, 0644)
+			mnt.Close()
+			if err != nil {
+				t.Fatalf("Couldn't write file: %v", err)
+			}
+
+			mnt = getMountedFSWithOptions(t, tc.backend, tc.dsn, MountOptions{ReadOnly: true})
+			defer mnt.Close()
+
+			testReadOnly(t, mnt, contents)
+		})
+	}
+}
+
+func TestStatfs(t *testing.T) {
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			mnt := getMountedFSWithOptions(t, tc.backend, tc.dsn, MountOptions{Capacity: 1 << 30})
+			defer mnt.Close()
+
+			testStatfs(t, mnt, 1<<30)
+		})
+	}
+}
+
+func TestQuota(t *testing.T) {
+	runWithDB(t, MountOptions{}, testQuota)
+}
+
+func TestOwners(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Creating files as other users needs root")
+	}
+
+	runWithDB(t, MountOptions{AllowOther: true}, testOwners)
+}
+
+func TestSnapshot(t *testing.T) {
+	runWithDB(t, MountOptions{}, testSnapshot)
+}
+
+func TestVersions(t *testing.T) {
+	runWithDB(t, MountOptions{}, testVersions)
+}
+
+func TestTrash(t *testing.T) {
+	runWithDB(t, MountOptions{}, testTrash)
+}
+
+func TestDedup(t *testing.T) {
+	runWithDB(t, MountOptions{}, testDedup)
+}
+
+func TestCompression(t *testing.T) {
+	runWithDB(t, MountOptions{}, testCompression)
+}
+
+func TestUnmountOnSignal(t *testing.T) {
+	for _, tc := range getTestingBackends(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			Backend = tc.backend
+			if err := InitializeDB(tc.dsn); err != nil {
+				t.Fatalf("Couldn't initialize db: %v", err)
+			}
+
+			testUnmountOnSignal(t, tc.dsn)
+		})
+	}
+}
@@ -1,14 +1,22 @@
 package fuse
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"bazil.org/fuse/fs/fstestutil"
 	"github.com/docker/go-connections/nat"
+	sql "github.com/jmoiron/sqlx"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 
@@ -30,6 +38,10 @@ func assertFileSizeIs(t *testing.T, filepath string, expectedSize int64) {
 }
 
 func getMountedFS(t *testing.T, backend sqlutils.SQLBackend, dsn string) *fstestutil.Mount {
+	return getMountedFSWithOptions(t, backend, dsn, MountOptions{})
+}
+
+func getMountedFSWithOptions(t *testing.T, backend sqlutils.SQLBackend, dsn string, opts MountOptions) *fstestutil.Mount {
 	Backend = backend
 
 	t.Logf("Using dsn '%s'", dsn)
@@ -49,8 +61,13 @@ func getMountedFS(t *testing.T, backend sqlutils.SQLBackend, dsn string) *fstest
 		t.Fatalf("Couldn't create initial rows: %v", err)
 	}
 
-	filesys := FS{db}
-	mnt, err := fstestutil.MountedT(t, &filesys, nil)
+	return mountDB(t, db, opts)
+}
+
+// mountDB mounts db, which has to be initialized, using Backend
+func mountDB(t *testing.T, db *sql.DB, opts MountOptions) *fstestutil.Mount {
+	filesys := FS{db, opts}
+	mnt, err := fstestutil.MountedT(t, &filesys, nil, mountOptions(opts)...)
 	if err != nil {
 		t.Fatalf("Couldn't mount sqlfs: %v", err)
 	}
@@ -190,13 +207,540 @@ func testBasicDirOperations(t *testing.T, mnt *fstestutil.Mount) {
 	})
 }
 
-func setupContainer(t *testing.T, image string, port nat.Port, env map[string]string, waitFor wait.Strategy) (string, string) {
+func testLargeFile(t *testing.T, mnt *fstestutil.Mount, size int) {
+	testfile := mnt.Dir + "/largefile"
+
+	contents := make([]byte, size)
+	if _, err := rand.Read(contents); err != nil {
+		t.Fatalf("Couldn't generate file contents: %v", err)
+	}
+
+	if err := ioutil.WriteFile(testfile, contents, 0644); err != nil {
+		t.Fatalf("Couldn't write to file: %v", err)
+	}
+
+	assertFileSizeIs(t, testfile, int64(size))
+
+	data, err := ioutil.ReadFile(testfile)
+	if err != nil {
+		t.Fatalf("Couldn't read from file: %v", err)
+	}
+	if !bytes.Equal(data, contents) {
+		t.Fatalf("Wrong contents read from file")
+	}
+}
+
+// testReadOnly expects mnt to be mounted read-only on a db where testfile was
+// written with contents
+func testReadOnly(t *testing.T, mnt *fstestutil.Mount, contents []byte) {
+	mountedDir := mnt.Dir
+	testfile := mountedDir + "/testfile"
+
+	before, err := os.Stat(testfile)
+	if err != nil {
+		t.Fatalf("Couldn't stat file: %v", err)
+	}
+
+	t.Run("read", func(t *testing.T) {
+		data, err := ioutil.ReadFile(testfile)
+		if err != nil {
+			t.Fatalf("Couldn't read file: %v", err)
+		}
+		if !bytes.Equal(data, contents) {
+			t.Fatalf("File contents don't match")
+		}
+
+		after, err := os.Stat(testfile)
+		if err != nil {
+			t.Fatalf("Couldn't stat file: %v", err)
+		}
+		if after.Sys().(*syscall.Stat_t).Atim != before.Sys().(*syscall.Stat_t).Atim {
+			t.Fatalf("Reading a file on a read-only mount changed its atime")
+		}
+	})
+
+	for name, modify := range map[string]func() error{
+		"create": func() error { return ioutil.WriteFile(mountedDir+"/newfile", contents, 0644) },
+		"write": func() error {
+			return ioutil.WriteFile(testfile, []byte("changed"), 0644)
+		},
+		"mkdir":  func() error { return os.Mkdir(mountedDir+"/newdir", 0755) },
+		"remove": func() error { return os.Remove(testfile) },
+		"chmod":  func() error { return os.Chmod(testfile, 0600) },
+	} {
+		modify := modify
+		t.Run(name, func(t *testing.T) {
+			if err := modify(); !errors.Is(err, syscall.EROFS) {
+				t.Fatalf("Expected EROFS, got %v", err)
+			}
+		})
+	}
+}
+
+// testStatfs expects mnt to be mounted on an empty fs with the given capacity
+func testStatfs(t *testing.T, mnt *fstestutil.Mount, capacity int64) {
+	var before syscall.Statfs_t
+	if err := syscall.Statfs(mnt.Dir, &before); err != nil {
+		t.Fatalf("Couldn't statfs: %v", err)
+	}
+
+	if total := int64(before.Blocks) * before.Bsize; total != capacity {
+		t.Fatalf("Expected a total of %d bytes, got %d", capacity, total)
+	}
+	if before.Bfree == 0 || before.Bfree > before.Blocks || before.Bavail != before.Bfree {
+		t.Fatalf("Unexpected free blocks: %d free, %d available of %d", before.Bfree, before.Bavail, before.Blocks)
+	}
+
+	testLargeFile(t, mnt, 4<<20)
+
+	var after syscall.Statfs_t
+	if err := syscall.Statfs(mnt.Dir, &after); err != nil {
+		t.Fatalf("Couldn't statfs: %v", err)
+	}
+
+	if used := int64(after.Blocks-after.Bfree) * after.Bsize; used < 4<<20 {
+		t.Fatalf("Expected at least %d bytes used after writing a file, got %d", 4<<20, used)
+	}
+	if after.Files-after.Ffree <= before.Files-before.Ffree {
+		t.Fatalf("Used inodes didn't go up after creating a file")
+	}
+}
+
+// testQuota expects mnt to be mounted on an empty fs stored in db
+func testQuota(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	project := mnt.Dir + "/project"
+	if err := os.Mkdir(project, 0755); err != nil {
+		t.Fatalf("Couldn't create dir: %v", err)
+	}
+
+	inode, err := Backend.GetInodeForNameUnderInode(db, 1, "project")
+	if err != nil {
+		t.Fatalf("Couldn't look up dir: %v", err)
+	}
+
+	// the dir, a file and a subdir fit
+	quota := sqlutils.Quota{Kind: sqlutils.QuotaProject, ID: inode, MaxBytes: 1024, MaxInodes: 3}
+	if err := sqlutils.SetQuota(db, quota); err != nil {
+		t.Fatalf("Couldn't set quota: %v", err)
+	}
+
+	if err := ioutil.WriteFile(project+"/file", make([]byte, 1000), 0644); err != nil {
+		t.Fatalf("Couldn't write file under quota: %v", err)
+	}
+	if err := ioutil.WriteFile(project+"/file", make([]byte, 2000), 0644); !errors.Is(err, syscall.EDQUOT) {
+		t.Fatalf("Expected EDQUOT growing a file over quota, got %v", err)
+	}
+	if err := ioutil.WriteFile(project+"/file", make([]byte, 10), 0644); err != nil {
+		t.Fatalf("Couldn't shrink file: %v", err)
+	}
+
+	if err := os.Mkdir(project+"/subdir", 0755); err != nil {
+		t.Fatalf("Couldn't create dir under quota: %v", err)
+	}
+	if err := os.Mkdir(project+"/subdir/another", 0755); !errors.Is(err, syscall.EDQUOT) {
+		t.Fatalf("Expected EDQUOT creating a dir over quota, got %v", err)
+	}
+	if err := ioutil.WriteFile(project+"/subdir/another", nil, 0644); !errors.Is(err, syscall.EDQUOT) {
+		t.Fatalf("Expected EDQUOT creating a file over quota, got %v", err)
+	}
+
+	// outside the project
+	if err := ioutil.WriteFile(mnt.Dir+"/file", make([]byte, 2000), 0644); err != nil {
+		t.Fatalf("Couldn't write file outside the project: %v", err)
+	}
+}
+
+// testOwners expects mnt to be mounted with AllowOther on an empty fs stored
+// in db. It creates files and directories as two different users, so it has
+// to run as root
+func testOwners(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	for _, id := range []uint32{1001, 1002} {
+		name := fmt.Sprint(id)
+
+		cmd := exec.Command("sh", "-c", `mkdir "$1" && echo contents > "$1/file"`, "sh", mnt.Dir+"/"+name)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: id, Gid: id}}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Couldn't create files as %d: %v: %s", id, err, out)
+		}
+
+		dir, err := Backend.GetInodeForNameUnderInode(db, 1, name)
+		if err != nil {
+			t.Fatalf("Couldn't look up dir: %v", err)
+		}
+		file, err := Backend.GetInodeForNameUnderInode(db, dir, "file")
+		if err != nil {
+			t.Fatalf("Couldn't look up file: %v", err)
+		}
+
+		for _, inode := range []int64{dir, file} {
+			metadata, err := Backend.GetMetadataForInode(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't get metadata: %v", err)
+			}
+			if metadata.Uid != int64(id) || metadata.Gid != int64(id) {
+				t.Errorf("%s is owned by %d:%d, expected %d:%d", metadata.Name, metadata.Uid, metadata.Gid, id, id)
+			}
+		}
+	}
+}
+
+// testSnapshot expects mnt to be mounted on an empty fs stored in db
+func testSnapshot(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	backend := Backend
+	before := []byte("before the snapshot")
+
+	if err := ioutil.WriteFile(mnt.Dir+"/changed", before, 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+	if err := os.Mkdir(mnt.Dir+"/dir", 0755); err != nil {
+		t.Fatalf("Couldn't create dir: %v", err)
+	}
+	if err := ioutil.WriteFile(mnt.Dir+"/dir/removed", before, 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	if err := sqlutils.CreateSnapshot(db, "snapshot"); err != nil {
+		t.Fatalf("Couldn't create snapshot: %v", err)
+	}
+
+	if err := ioutil.WriteFile(mnt.Dir+"/changed", []byte("after"), 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+	if err := os.Remove(mnt.Dir + "/dir/removed"); err != nil {
+		t.Fatalf("Couldn't remove file: %v", err)
+	}
+	if err := ioutil.WriteFile(mnt.Dir+"/created", before, 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	// mnt isn't used while Backend is the snapshot's
+	Backend = sqlutils.NewSnapshotBackend(backend, "snapshot")
+	defer func() { Backend = backend }()
+
+	snapshot := mountDB(t, db, MountOptions{ReadOnly: true})
+	defer snapshot.Close()
+
+	for _, name := range []string{"changed", "dir/removed"} {
+		data, err := ioutil.ReadFile(snapshot.Dir + "/" + name)
+		if err != nil {
+			t.Fatalf("Couldn't read %s from snapshot: %v", name, err)
+		}
+		if !bytes.Equal(data, before) {
+			t.Fatalf("Contents of %s in snapshot changed: %q", name, data)
+		}
+	}
+
+	if _, err := os.Stat(snapshot.Dir + "/created"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected file created after the snapshot to be missing, got %v", err)
+	}
+	if err := ioutil.WriteFile(snapshot.Dir+"/changed", nil, 0644); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Expected EROFS writing to a snapshot, got %v", err)
+	}
+}
+
+func testVersions(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	if err := sqlutils.SetVersionOptions(db, sqlutils.VersionOptions{Keep: 2}); err != nil {
+		t.Fatalf("Couldn't enable versions: %v", err)
+	}
+
+	first := []byte("first")
+	if err := ioutil.WriteFile(mnt.Dir+"/file", first, 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	// only contents older than the version interval are kept
+	written := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(mnt.Dir+"/file", written, written); err != nil {
+		t.Fatalf("Couldn't set mtime: %v", err)
+	}
+	if err := ioutil.WriteFile(mnt.Dir+"/file", []byte("second"), 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(mnt.Dir)
+	if err != nil {
+		t.Fatalf("Couldn't read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".versions" {
+			t.Fatalf("Expected .versions to be hidden")
+		}
+	}
+
+	entries, err = ioutil.ReadDir(mnt.Dir + "/.versions")
+	if err != nil {
+		t.Fatalf("Couldn't read .versions: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "file" || !entries[0].IsDir() {
+		t.Fatalf("Expected .versions to list file, got %v", entries)
+	}
+
+	name := written.UTC().Format(sqlutils.VersionTimeFormat)
+	entries, err = ioutil.ReadDir(mnt.Dir + "/.versions/file")
+	if err != nil {
+		t.Fatalf("Couldn't read versions of file: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != name {
+		t.Fatalf("Expected version %s, got %v", name, entries)
+	}
+
+	data, err := ioutil.ReadFile(mnt.Dir + "/.versions/file/" + name)
+	if err != nil {
+		t.Fatalf("Couldn't read version: %v", err)
+	}
+	if !bytes.Equal(data, first) {
+		t.Fatalf("Expected version to contain %q, got %q", first, data)
+	}
+	if err := ioutil.WriteFile(mnt.Dir+"/.versions/file/"+name, nil, 0644); !errors.Is(err, syscall.EROFS) {
+		t.Fatalf("Expected EROFS writing to a version, got %v", err)
+	}
+}
+
+func testTrash(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	if err := sqlutils.SetTrashOptions(db, sqlutils.TrashOptions{Enabled: true}); err != nil {
+		t.Fatalf("Couldn't enable trash: %v", err)
+	}
+
+	contents := []byte("removed by accident")
+	if err := os.MkdirAll(mnt.Dir+"/dir/subdir", 0755); err != nil {
+		t.Fatalf("Couldn't create dirs: %v", err)
+	}
+	if err := ioutil.WriteFile(mnt.Dir+"/dir/subdir/file", contents, 0644); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	if err := os.RemoveAll(mnt.Dir + "/dir"); err != nil {
+		t.Fatalf("Couldn't remove dir: %v", err)
+	}
+	if _, err := os.Stat(mnt.Dir + "/dir"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected removed dir to be missing, got %v", err)
+	}
+
+	entries, err := sqlutils.GetTrash(db)
+	if err != nil {
+		t.Fatalf("Couldn't get trash: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries in trash, got %v", entries)
+	}
+
+	var dir int64
+	for _, entry := range entries {
+		if entry.Path == "/dir" {
+			dir = entry.Inode
+		}
+	}
+	if err := sqlutils.RestoreFromTrash(db, dir); err != nil {
+		t.Fatalf("Couldn't restore dir: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(mnt.Dir + "/dir/subdir/file")
+	if err != nil {
+		t.Fatalf("Couldn't read restored file: %v", err)
+	}
+	if !bytes.Equal(data, contents) {
+		t.Fatalf("Expected restored file to contain %q, got %q", contents, data)
+	}
+
+	if err := os.Remove(mnt.Dir + "/dir/subdir/file"); err != nil {
+		t.Fatalf("Couldn't remove file: %v", err)
+	}
+	if err := sqlutils.PurgeTrashBefore(db, time.Now()); err != nil {
+		t.Fatalf("Couldn't purge trash: %v", err)
+	}
+	if entries, err := sqlutils.GetTrash(db); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected empty trash, got %v, %v", entries, err)
+	}
+}
+
+func testDedup(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	if err := sqlutils.SetDedup(db, true); err != nil {
+		t.Fatalf("Couldn't enable dedup: %v", err)
+	}
+
+	contents := make([]byte, 64*1024)
+	if _, err := rand.Read(contents); err != nil {
+		t.Fatalf("Couldn't generate contents: %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		if err := ioutil.WriteFile(mnt.Dir+"/"+name, contents, 0644); err != nil {
+			t.Fatalf("Couldn't write %s: %v", name, err)
+		}
+	}
+
+	stats, err := sqlutils.GetDedupStats(db)
+	if err != nil {
+		t.Fatalf("Couldn't get dedup stats: %v", err)
+	}
+	if stats.Files != 2 || stats.Chunks != 1 || stats.ChunkBytes != int64(len(contents)) {
+		t.Fatalf("Expected 2 files sharing a chunk, got %+v", stats)
+	}
+
+	if err := os.Remove(mnt.Dir + "/first"); err != nil {
+		t.Fatalf("Couldn't remove file: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(mnt.Dir + "/second")
+	if err != nil {
+		t.Fatalf("Couldn't read file: %v", err)
+	}
+	if !bytes.Equal(data, contents) {
+		t.Fatalf("Contents of deduplicated file changed")
+	}
+
+	if err := os.Remove(mnt.Dir + "/second"); err != nil {
+		t.Fatalf("Couldn't remove file: %v", err)
+	}
+	if stats, err := sqlutils.GetDedupStats(db); err != nil || stats.Chunks != 0 {
+		t.Fatalf("Expected no chunks left, got %+v, %v", stats, err)
+	}
+}
+
+func testCompression(t *testing.T, mnt *fstestutil.Mount, db *sql.DB) {
+	if err := sqlutils.SetCompression(db, sqlutils.CompressionZstd); err != nil {
+		t.Fatalf("Couldn't enable compression: %v", err)
+	}
+
+	var contents []byte
+	for i := 0; len(contents) < 256*1024; i++ {
+		contents = append(contents, fmt.Sprintf("%d: a line of a very repetitive log\n", i)...)
+	}
+
+	// large files are kept in chunks, small ones in filedata
+	for name, data := range map[string][]byte{"large.log": contents, "small.log": contents[:1024]} {
+		if err := ioutil.WriteFile(mnt.Dir+"/"+name, data, 0644); err != nil {
+			t.Fatalf("Couldn't write %s: %v", name, err)
+		}
+
+		read, err := ioutil.ReadFile(mnt.Dir + "/" + name)
+		if err != nil {
+			t.Fatalf("Couldn't read %s: %v", name, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Fatalf("Contents of compressed file %s changed", name)
+		}
+	}
+
+	stats, err := sqlutils.GetCompressionStats(db)
+	if err != nil {
+		t.Fatalf("Couldn't get compression stats: %v", err)
+	}
+	if stats.StoredBytes*2 > stats.Bytes {
+		t.Fatalf("Expected contents to be compressed, got %+v", stats)
+	}
+}
+
+// isMounted reports whether something is mounted at dir
+func isMounted(t *testing.T, dir string) bool {
+	t.Helper()
+
+	var stat, parent syscall.Stat_t
+	if err := syscall.Stat(dir, &stat); err != nil {
+		t.Fatalf("Couldn't stat %s: %v", dir, err)
+	}
+	if err := syscall.Stat(filepath.Dir(dir), &parent); err != nil {
+		t.Fatalf("Couldn't stat the parent of %s: %v", dir, err)
+	}
+
+	return stat.Dev != parent.Dev
+}
+
+// testUnmountOnSignal mounts dsn with MountFS, the way sqlfs mount does, and
+// checks that the mountpoint is released on SIGTERM: right away when the fs
+// is idle, and lazily when a file is kept open in it, once the unmount
+// timeout passes or another signal comes. It also checks unmounting a busy
+// fs with Unmount, as sqlfs umount does, which fails unless it's lazy
+func testUnmountOnSignal(t *testing.T, dsn string) {
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		busy    bool
+		// signals sent, none to unmount with Unmount instead
+		signals int
+	}{
+		{"idle", time.Hour, false, 1},
+		{"busy until timeout", 500 * time.Millisecond, true, 1},
+		{"busy until second signal", time.Hour, true, 2},
+		{"umount", time.Hour, true, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			ready := make(chan struct{})
+			served := make(chan error, 1)
+			opts := MountOptions{UnmountTimeout: tc.timeout, Ready: func() { close(ready) }}
+			go func() {
+				served <- MountFS(dsn, dir, opts)
+			}()
+
+			select {
+			case <-ready:
+			case err := <-served:
+				t.Fatalf("Couldn't mount: %v", err)
+			}
+
+			var open *os.File
+			if tc.busy {
+				var err error
+				if open, err = os.Create(dir + "/busy"); err != nil {
+					t.Fatalf("Couldn't create file: %v", err)
+				}
+				defer open.Close()
+			}
+
+			if tc.signals == 0 {
+				if err := Unmount(dir, false); err == nil {
+					t.Fatalf("Unmounting a busy fs didn't fail")
+				}
+				if err := Unmount(dir, true); err != nil {
+					t.Fatalf("Couldn't unmount lazily: %v", err)
+				}
+			}
+			for i := 0; i < tc.signals; i++ {
+				if i > 0 {
+					// after the first one was handled
+					time.Sleep(200 * time.Millisecond)
+				}
+				if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+					t.Fatalf("Couldn't send SIGTERM: %v", err)
+				}
+			}
+
+			// the timeout of the busy cases is either short or never reached
+			deadline := time.Now().Add(10 * time.Second)
+			for isMounted(t, dir) {
+				if time.Now().After(deadline) {
+					t.Fatalf("%s still mounted", dir)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			// a lazily detached fs is only let go of once the file is closed
+			if open != nil {
+				open.Close()
+			}
+
+			select {
+			case err := <-served:
+				if err != nil {
+					t.Fatalf("MountFS failed: %v", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("MountFS didn't return after %s was unmounted", dir)
+			}
+		})
+	}
+}
+
+func setupContainer(t *testing.T, image string, port nat.Port, env map[string]string, waitFor wait.Strategy, cmd ...string) (string, string) {
 	ctx := context.Background()
 
 	req := testcontainers.ContainerRequest{
 		Image:        image,
 		ExposedPorts: []string{string(port)},
 		Env:          env,
+		Cmd:          cmd,
 		// WaitingFor:   wait.ForListeningPort(port),
 		WaitingFor: waitFor,
 	}
@@ -256,3 +800,12 @@ func setupPostgresContainer(t *testing.T) string {
 
 	return fmt.Sprintf("%s:%s@%s:%s/%s", user, password, ip, mappedPort, dbname)
 }
+
+func setupCockroachContainer(t *testing.T) string {
+	port := nat.Port("26257/tcp")
+
+	ip, mappedPort := setupContainer(t, "cockroachdb/cockroach:latest", port, nil,
+		wait.ForLog("CockroachDB node starting"), "start-single-node", "--insecure")
+
+	return fmt.Sprintf("root@%s:%s/defaultdb", ip, mappedPort)
+}
@@ -6,13 +6,13 @@ import (
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
-	sql "github.com/jmoiron/sqlx"
+	"bazil.org/fuse/fuseutil"
 )
 
 // FileHandle contains information about an open file on fs
 type FileHandle struct {
-	db    *sql.DB
-	inode int32
+	fs    *FS
+	inode int64
 	file  *File
 }
 
@@ -25,27 +25,75 @@ var _ = fs.HandleWriter(&FileHandle{})
 // NOTE: this is in a very bad state currently, need
 //       to split the file into blocks to make it better
 func (fh *FileHandle) Read(ctx context.Context, req *fuse.ReadRequest, res *fuse.ReadResponse) error {
-	data, err := Backend.GetFileContentsForInode(fh.db, fh.inode)
+	if fh.fs.opts.NoAtime || fh.fs.opts.ReadOnly {
+		return fh.readRange(req, res)
+	}
+
+	data, err := Backend.GetFileContentsForInode(fh.fs.db, fh.inode)
+	if err != nil {
+		log.Printf("Couldn't read file contents: %v\n", err)
+		return err
+	}
+
+	// the whole file was loaded, only return the part asked for
+	fuseutil.HandleRead(req, res, data)
+
+	return nil
+}
+
+// readRange reads only the part of the file asked for in req, without
+// updating its atime
+func (fh *FileHandle) readRange(req *fuse.ReadRequest, res *fuse.ReadResponse) error {
+	metadata, err := Backend.GetMetadataForInode(fh.fs.db, fh.inode)
+	if err != nil {
+		log.Printf("Couldn't get metadata: %v\n", err)
+		return err
+	}
+
+	size := metadata.Size - req.Offset
+	if size > int64(req.Size) {
+		size = int64(req.Size)
+	}
+	if size <= 0 {
+		res.Data = nil
+		return nil
+	}
+
+	data, err := Backend.GetFileRangeForInode(fh.fs.db, fh.inode, req.Offset, size)
 	if err != nil {
 		log.Printf("Couldn't read file contents: %v\n", err)
 		return err
 	}
 
-	res.Data = data
+	// contents shorter than the size read as zeros
+	res.Data = make([]byte, size)
+	copy(res.Data, data)
 
 	return nil
 }
 
 // Write writes to a FileHandle, fh
 func (fh *FileHandle) Write(ctx context.Context, req *fuse.WriteRequest, res *fuse.WriteResponse) error {
-	data, err := Backend.GetFileContentsForInode(fh.db, fh.inode)
+	if fh.fs.opts.ReadOnly {
+		return errReadOnly
+	}
+
+	data, err := Backend.GetFileContentsForInode(fh.fs.db, fh.inode)
 	if err != nil {
 		log.Println("Couldn't read file contents!")
 		return err
 	}
 
-	newData := append(data[:req.Offset], req.Data...)
-	err = Backend.SetFileContentsForInode(fh.db, fh.inode, newData)
+	// writes can land anywhere in the file, e.g. with the writeback cache,
+	// so keep what's after them and fill holes before them with zeros
+	newData := data
+	if end := req.Offset + int64(len(req.Data)); end > int64(len(data)) {
+		newData = make([]byte, end)
+		copy(newData, data)
+	}
+	copy(newData[req.Offset:], req.Data)
+
+	err = Backend.SetFileContentsForInode(fh.fs.db, fh.inode, newData)
 	if err != nil {
 		log.Println("Failed to write to file!")
 		return err
@@ -59,8 +107,12 @@ var _ = fs.NodeOpener(&File{})
 
 // Open file (to get FileHandle)
 func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, res *fuse.OpenResponse) (fs.Handle, error) {
+	if f.fs.opts.ReadOnly && !req.Flags.IsReadOnly() {
+		return nil, errReadOnly
+	}
+
 	res.Flags |= fuse.OpenNonSeekable
-	return &FileHandle{f.db, f.inode, f}, nil
+	return &FileHandle{f.fs, f.inode, f}, nil
 }
 
 var _ fs.HandleReleaser = (*FileHandle)(nil)
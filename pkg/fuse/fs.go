@@ -3,13 +3,20 @@
 package fuse
 
 import (
+	"syscall"
+
+	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	sql "github.com/jmoiron/sqlx"
 )
 
+// errReadOnly is returned by operations which would modify a read-only fs
+var errReadOnly = fuse.Errno(syscall.EROFS)
+
 // FS represents the file system itself
 type FS struct {
-	db *sql.DB
+	db   *sql.DB
+	opts MountOptions
 }
 
 var _ fs.FS = (*FS)(nil)
@@ -20,17 +27,17 @@ func (f *FS) Root() (fs.Node, error) {
 	if err != nil {
 		return &Dir{}, err
 	}
-	return &Dir{f.db, int32(metadata.Inode)}, nil
+	return &Dir{f, metadata.Inode}, nil
 }
 
 // Dir represents a on fs
 type Dir struct {
-	db    *sql.DB
-	inode int32
+	fs    *FS
+	inode int64
 }
 
 // File represents a file on fs
 type File struct {
-	db    *sql.DB
-	inode int32
+	fs    *FS
+	inode int64
 }
@@ -2,15 +2,28 @@ package fuse
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	sql "github.com/jmoiron/sqlx"
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
 )
 
-// openDB opens the DB. Caller package must set the Backend
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := Backend.OpenDB(dsn)
+// openDB opens the DB. Caller package must set the Backend. With readOnly,
+// nothing in the db is changed by opening it
+func openDB(dsn string, readOnly bool) (*sql.DB, error) {
+	open := Backend.OpenDB
+	if readOnly {
+		open = func(dsn string) (*sql.DB, error) {
+			return sqlutils.OpenDBReadOnly(Backend, dsn)
+		}
+	}
+
+	db, err := open(dsn)
 	if err != nil {
 		log.Println("Couldn't open DB!")
 		return db, err
@@ -22,7 +35,7 @@ func openDB(dsn string) (*sql.DB, error) {
 // InitializeDB creates the tables and initial rows necessary for
 // the fs to function
 func InitializeDB(dsn string) error {
-	db, err := openDB(dsn)
+	db, err := openDB(dsn, false)
 	if err != nil {
 		return err
 	}
@@ -42,10 +55,11 @@ func InitializeDB(dsn string) error {
 
 // VerifyDB is just a wrapper over Backend's VerifyDB function
 func VerifyDB(dsn string) error {
-	db, err := openDB(dsn)
+	db, err := openDB(dsn, true)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
 	if err := Backend.VerifyDB(db); err != nil {
 		log.Println("SQL DB Verification failed!")
@@ -55,33 +69,180 @@ func VerifyDB(dsn string) error {
 	return nil
 }
 
-// MountFS verifies the db state and mounts the fuse fs at mountpoint
-func MountFS(dsn, mountpoint string) error {
+// MountOptions configures MountFS
+type MountOptions struct {
+	// FSName is the source shown by mount and df, "sqlfs" if empty
+	FSName string
+	// Subtype makes the fs type show as fuse.Subtype, "sqlfs" if empty
+	Subtype string
+
+	// ReadOnly mounts the fs read-only. Every change fails with EROFS and
+	// nothing is written to the db, not even atimes, so a db user with only
+	// select privileges is enough
+	ReadOnly bool
+	// AllowOther lets users other than the one mounting access the fs
+	AllowOther bool
+	// DefaultPermissions makes the kernel check access using the modes and
+	// owners of files
+	DefaultPermissions bool
+
+	// Uid and Gid, if set, are reported as the owner of every file instead
+	// of the stored ones
+	Uid *uint32
+	Gid *uint32
+
+	// NoAtime stops reads from updating access times
+	NoAtime bool
+
+	// MaxReadahead is the most the kernel reads ahead, 0 for its default
+	MaxReadahead uint32
+	// AsyncRead lets the kernel send multiple reads for a file at once
+	AsyncRead bool
+	// WritebackCache lets the kernel buffer writes and send them in bigger
+	// chunks, instead of one request per write
+	WritebackCache bool
+
+	// Capacity is the size of the fs in bytes reported to df. If 0, free
+	// space is reported as practically unlimited
+	Capacity int64
+
+	// UnmountTimeout is how long to wait for the fs to stop being busy after
+	// SIGINT or SIGTERM, before detaching it lazily. Zero detaches a busy fs
+	// right away
+	UnmountTimeout time.Duration
+
+	// Ready, if set, is called once the fs is mounted and being served
+	Ready func()
+}
+
+// MountFS verifies the db state, mounts the fuse fs at mountpoint and serves
+// it until it is unmounted.
+//
+// On SIGINT or SIGTERM, the fs is unmounted (lazily if it's still busy after
+// opts.UnmountTimeout) and the requests being handled are finished before the
+// db is closed. Every operation is committed before it's answered, so nothing
+// else is pending by then
+func MountFS(dsn, mountpoint string, opts MountOptions) error {
+	db, err := openDB(dsn, opts.ReadOnly)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
 	// verify whether its usable
-	if err := VerifyDB(dsn); err != nil {
+	if err := Backend.VerifyDB(db); err != nil {
+		log.Println("SQL DB Verification failed!")
 		return err
 	}
 
-	c, err := fuse.Mount(mountpoint)
+	if !opts.ReadOnly {
+		if err := sqlutils.PurgeExpiredTrash(db); err != nil {
+			log.Printf("Couldn't purge expired trash: %v\n", err)
+		}
+	}
+
+	c, err := fuse.Mount(mountpoint, mountOptions(opts)...)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	db, err := openDB(dsn)
-	if err != nil {
-		return err
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- fs.Serve(c, &FS{db, opts})
+	}()
+
+	if opts.Ready != nil {
+		opts.Ready()
 	}
 
-	filesys := &FS{db}
-	if err = fs.Serve(c, filesys); err != nil {
+	select {
+	case err = <-served:
+	case sig := <-signals:
+		log.Printf("Received %v, unmounting %s\n", sig, mountpoint)
+		err = unmountServed(mountpoint, served, signals, opts.UnmountTimeout)
+	}
+	if err != nil {
 		return err
 	}
 
-	<-c.Ready
-	if err = c.MountError; err != nil {
+	if err = db.Close(); err != nil {
+		log.Println("Couldn't close DB!")
 		return err
 	}
 
 	return nil
 }
+
+// mountOptions returns the fuse.Mount options for opts
+func mountOptions(opts MountOptions) []fuse.MountOption {
+	fsName, subtype := opts.FSName, opts.Subtype
+	if fsName == "" {
+		fsName = "sqlfs"
+	}
+	if subtype == "" {
+		subtype = "sqlfs"
+	}
+
+	options := []fuse.MountOption{fuse.FSName(fsName), fuse.Subtype(subtype)}
+
+	if opts.ReadOnly {
+		options = append(options, fuse.ReadOnly())
+	}
+	if opts.AllowOther {
+		options = append(options, fuse.AllowOther())
+	}
+	if opts.DefaultPermissions {
+		options = append(options, fuse.DefaultPermissions())
+	}
+	if opts.MaxReadahead > 0 {
+		options = append(options, fuse.MaxReadahead(opts.MaxReadahead))
+	}
+	if opts.AsyncRead {
+		options = append(options, fuse.AsyncRead())
+	}
+	if opts.WritebackCache {
+		options = append(options, fuse.WritebackCache())
+	}
+
+	return options
+}
+
+// unmountServed unmounts mountpoint and waits for fs.Serve to return. While
+// the fs is busy, unmounting is retried until timeout has passed or another
+// signal is received, and then the fs is detached lazily
+func unmountServed(mountpoint string, served <-chan error, signals <-chan os.Signal, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	retry := time.NewTicker(200 * time.Millisecond)
+	defer retry.Stop()
+
+	err := Unmount(mountpoint, false)
+	for err != nil {
+		log.Printf("Couldn't unmount %s, retrying: %v\n", mountpoint, err)
+
+		select {
+		case err = <-served:
+			// unmounted by someone else
+			return err
+		case <-retry.C:
+			err = Unmount(mountpoint, false)
+			continue
+		case <-deadline:
+		case <-signals:
+		}
+
+		log.Printf("Detaching %s lazily\n", mountpoint)
+		if err = Unmount(mountpoint, true); err != nil {
+			log.Println("Couldn't unmount!")
+			return err
+		}
+	}
+
+	// fs.Serve returns once the kernel lets go of the fs and the requests
+	// already received have been handled
+	return <-served
+}
@@ -0,0 +1,66 @@
+package fuse
+
+import (
+	"context"
+	"log"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+const (
+	// statfsBlockSize is the block size df counts in. Nothing is stored in
+	// blocks, it's only the unit sizes are reported in
+	statfsBlockSize = 4096
+	// statfsNameLen is the longest name reported as allowed, the limit of
+	// most local filesystems
+	statfsNameLen = 255
+
+	// unlimitedBytes and unlimitedInodes are reported as free when there's
+	// no configured capacity, so tools checking for free space go ahead
+	unlimitedBytes  = 1 << 50
+	unlimitedInodes = 1 << 32
+)
+
+var _ fs.FSStatfser = (*FS)(nil)
+
+// Statfs reports the space and inodes used by the fs, for df and friends.
+//
+// Used space is the size of the tables if the backend can tell, but at least
+// the total size of file contents. Total space is opts.Capacity if set, or
+// used space plus a nominal petabyte
+func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	usage, err := Backend.GetUsage(f.db)
+	if err != nil {
+		log.Println("Couldn't get fs usage!")
+		return err
+	}
+
+	// table sizes may be estimates (mysql updates them lazily), so never
+	// report less than what's stored
+	used := usage.Bytes
+	if usage.DBSize > used {
+		used = usage.DBSize
+	}
+
+	capacity := f.opts.Capacity
+	if capacity <= 0 {
+		capacity = used + unlimitedBytes
+	}
+
+	free := capacity - used
+	if free < 0 {
+		free = 0
+	}
+
+	resp.Bsize = statfsBlockSize
+	resp.Frsize = statfsBlockSize
+	resp.Blocks = uint64((capacity + statfsBlockSize - 1) / statfsBlockSize)
+	resp.Bfree = uint64(free / statfsBlockSize)
+	resp.Bavail = resp.Bfree
+	resp.Files = uint64(usage.Inodes) + unlimitedInodes
+	resp.Ffree = unlimitedInodes
+	resp.Namelen = statfsNameLen
+
+	return nil
+}
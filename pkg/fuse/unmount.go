@@ -0,0 +1,15 @@
+package fuse
+
+import (
+	"bazil.org/fuse"
+)
+
+// Unmount unmounts the fs mounted at mountpoint. A lazy unmount detaches it
+// right away, even if it's busy, and finishes once it's no longer in use
+func Unmount(mountpoint string, lazy bool) error {
+	if lazy {
+		return lazyUnmount(mountpoint)
+	}
+
+	return fuse.Unmount(mountpoint)
+}
@@ -0,0 +1,16 @@
+package fuse
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func lazyUnmount(mountpoint string) error {
+	output, err := exec.Command("fusermount", "-u", "-z", mountpoint).CombinedOutput()
+	if err != nil && len(output) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package fuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lazyUnmount forces the unmount, since there's no lazy unmount outside linux
+func lazyUnmount(mountpoint string) error {
+	if err := unix.Unmount(mountpoint, unix.MNT_FORCE); err != nil {
+		return &os.PathError{Op: "unmount", Path: mountpoint, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+
+	"github.com/yoogottamk/sqlfs/pkg/sqlutils"
+)
+
+// versionsDirName is the hidden directory under every directory which holds
+// the versions of the files in it, as .versions/FILE/VERSION
+const versionsDirName = ".versions"
+
+// versionsDir lists the files of directory inode which have versions
+type versionsDir struct {
+	fs    *FS
+	inode int64
+}
+
+// fileVersionsDir lists the versions of file inode
+type fileVersionsDir struct {
+	fs    *FS
+	inode int64
+}
+
+// versionFile is a read-only version of a file
+type versionFile struct {
+	fs      *FS
+	version sqlutils.Version
+}
+
+var _ fs.Node = (*versionsDir)(nil)
+var _ fs.Node = (*fileVersionsDir)(nil)
+var _ fs.Node = (*versionFile)(nil)
+
+// lookupVersionsDir returns the .versions directory of directory inode.
+// Snapshots don't have versions
+func lookupVersionsDir(fsys *FS, inode int64) (fs.Node, error) {
+	if _, ok := Backend.(sqlutils.SnapshotBackend); ok {
+		return nil, fuse.ENOENT
+	}
+
+	return &versionsDir{fsys, inode}, nil
+}
+
+// setReadOnlyDirAttr populates attr for a virtual directory under the file or
+// directory inode
+func setReadOnlyDirAttr(fsys *FS, inode int64, attr *fuse.Attr) error {
+	if err := setAttrFromMetadata(fsys, inode, attr); err != nil {
+		return err
+	}
+
+	attr.Mode = os.ModeDir | 0555
+	attr.Size = 0
+
+	return nil
+}
+
+// Attr retrieves metadata attr for a .versions dir
+func (d *versionsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	return setReadOnlyDirAttr(d.fs, d.inode, attr)
+}
+
+// ReadDirAll lists the files which have versions
+func (d *versionsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	var ret []fuse.Dirent
+
+	inodes, err := sqlutils.GetVersionedInodesUnderInode(d.fs.db, d.inode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inode := range inodes {
+		metadata, err := Backend.GetMetadataForInode(d.fs.db, inode)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		ret = append(ret, fuse.Dirent{Name: metadata.Name, Type: fuse.DT_Dir})
+	}
+
+	return ret, nil
+}
+
+// Lookup returns the versions of the file named name
+func (d *versionsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	inode, err := Backend.GetInodeForNameUnderInode(d.fs.db, d.inode, name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	versions, err := sqlutils.GetVersions(d.fs.db, inode)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	return &fileVersionsDir{d.fs, inode}, nil
+}
+
+// Attr retrieves metadata attr for the versions dir of a file
+func (d *fileVersionsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	return setReadOnlyDirAttr(d.fs, d.inode, attr)
+}
+
+// ReadDirAll lists the versions of the file, named by their mtime
+func (d *fileVersionsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	var ret []fuse.Dirent
+
+	versions, err := sqlutils.GetVersions(d.fs.db, d.inode)
+	if err != nil {
+		return nil, err
+	}
+
+	// versions within the same second share a name, which refers to the
+	// newest of them
+	seen := map[string]bool{}
+	for _, version := range versions {
+		if name := version.Name(); !seen[name] {
+			seen[name] = true
+			ret = append(ret, fuse.Dirent{Name: name, Type: fuse.DT_File})
+		}
+	}
+
+	return ret, nil
+}
+
+// Lookup returns the version named name
+func (d *fileVersionsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	version, err := sqlutils.GetVersionByName(d.fs.db, d.inode, name)
+	if errors.Is(err, sqlutils.ErrVersionNotFound) {
+		return nil, fuse.ENOENT
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &versionFile{d.fs, version}, nil
+}
+
+// Attr retrieves metadata attr for a version, which has the owner and
+// permissions of the file, without write permissions
+func (v *versionFile) Attr(ctx context.Context, attr *fuse.Attr) error {
+	if err := setAttrFromMetadata(v.fs, v.version.Inode, attr); err != nil {
+		return err
+	}
+
+	attr.Mode &^= 0222
+	attr.Size = uint64(v.version.Size)
+	attr.Mtime = time.Unix(0, v.version.Mtime)
+	attr.Atime = attr.Mtime
+	attr.Ctime = time.Unix(0, v.version.Ctime)
+
+	return nil
+}
+
+var _ fs.NodeOpener = (*versionFile)(nil)
+
+// Open opens a version for reading
+func (v *versionFile) Open(ctx context.Context, req *fuse.OpenRequest, res *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, errReadOnly
+	}
+
+	return v, nil
+}
+
+var _ fs.HandleReadAller = (*versionFile)(nil)
+
+// ReadAll reads the contents of a version
+func (v *versionFile) ReadAll(ctx context.Context) ([]byte, error) {
+	return sqlutils.GetVersionContents(v.fs.db, v.version)
+}
+
+var _ fs.NodeSetattrer = (*versionFile)(nil)
+
+// Setattr fails, versions can't be changed
+func (v *versionFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, res *fuse.SetattrResponse) error {
+	return errReadOnly
+}
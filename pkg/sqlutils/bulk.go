@@ -0,0 +1,305 @@
+package sqlutils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"bazil.org/fuse"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// Entry is a file or directory inserted by InsertEntries
+type Entry struct {
+	Metadata
+
+	// Parent is the inode of the directory containing the entry
+	Parent int64
+	// Data is the contents of a file. Unused for directories
+	Data []byte
+}
+
+// BulkInserter is implemented by backends which have a faster way to insert
+// many rows than an insert statement per row
+type BulkInserter interface {
+	// BulkInsert inserts rows, which have a value for each of columns, into
+	// table. table is one of metadata, filedata or parent
+	BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error
+}
+
+var metadataColumns = []string{"inode", "uid", "gid", "mode", "type", "ctime", "atime", "mtime", "name", "size"}
+var filedataColumns = []string{"inode", "data", "hash", "compression"}
+var parentColumns = []string{"pinode", "inode"}
+
+// InsertEntries inserts entries, their contents and their parent rows in a
+// single transaction, using backend's BulkInserter if it has one.
+//
+// Entries with a negative Inode are placeholders which get a newly allocated
+// inode. Parent can refer to a placeholder of an earlier entry. The returned
+// map has the inode allocated for each placeholder.
+//
+// Quotas are checked for the whole batch, using the Size of entries, and
+// going over one fails with EDQUOT without inserting anything. Contents
+// appended later with AppendFileContents are already counted by Size
+func InsertEntries(backend SQLBackend, db *sql.DB, entries []Entry) (map[int64]int64, error) {
+	var allocated map[int64]int64
+
+	err := runInTx(db, "bulk insert", func(tx *sql.Tx) error {
+		var nNew int
+		for _, entry := range entries {
+			if entry.Inode < 0 {
+				nNew++
+			}
+		}
+
+		inodes, err := allocateInodes(tx, nNew)
+		if err != nil {
+			return err
+		}
+
+		compression, err := GetCompression(tx)
+		if err != nil {
+			return err
+		}
+
+		dedup, err := GetDedup(tx)
+		if err != nil {
+			return err
+		}
+
+		allocated = map[int64]int64{}
+		inodeOf := func(inode int64) int64 {
+			if inode < 0 {
+				return allocated[inode]
+			}
+			return inode
+		}
+
+		var metadataRows, filedataRows, parentRows [][]interface{}
+		uids, gids, parents := map[int64]bool{}, map[int64]bool{}, map[int64]bool{}
+		var grewBytes bool
+		for _, entry := range entries {
+			if entry.Inode < 0 {
+				allocated[entry.Inode], inodes = inodes[0], inodes[1:]
+			}
+
+			inode := inodeOf(entry.Inode)
+			metadataRows = append(metadataRows, []interface{}{
+				inode, entry.Uid, entry.Gid, entry.Mode, entry.Type,
+				entry.Ctime, entry.Atime, entry.Mtime, entry.Name, entry.Size,
+			})
+			if entry.Type != int64(fuse.DT_Dir) {
+				data := entry.Data
+				if data == nil {
+					data = []byte{}
+				}
+				row, err := fileDataRow(tx, compression, dedup, inode, data)
+				if err != nil {
+					return err
+				}
+				filedataRows = append(filedataRows, row)
+			}
+			parentRows = append(parentRows, []interface{}{inodeOf(entry.Parent), inode})
+
+			uids[entry.Uid], gids[entry.Gid], parents[inodeOf(entry.Parent)] = true, true, true
+			grewBytes = grewBytes || entry.Size > 0
+		}
+
+		for _, table := range []struct {
+			name    string
+			columns []string
+			rows    [][]interface{}
+		}{
+			{"metadata", metadataColumns, metadataRows},
+			{"filedata", filedataColumns, filedataRows},
+			{"parent", parentColumns, parentRows},
+		} {
+			if len(table.rows) == 0 {
+				continue
+			}
+
+			if err := bulkInsert(backend, tx, table.name, table.columns, table.rows); err != nil {
+				log.Printf("Couldn't insert %s rows!\n", table.name)
+				return err
+			}
+		}
+
+		var dirs []int64
+		for parent := range parents {
+			dirs = append(dirs, parent)
+		}
+
+		return checkQuotas(tx, uids, gids, dirs, grewBytes, len(entries) > 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return allocated, nil
+}
+
+// AppendFileContents writes data at offset in the contents of file inode,
+// which has to be where they end, or 0 to replace them. It's meant for files
+// too large to insert with InsertEntries, which are written a part at a time
+// without loading what's already there.
+//
+// Like InsertEntries it leaves metadata alone, so the size should be set
+// beforehand or once all parts are written. Replaced contents are kept as a
+// version, like with SetFileContentsForInode, and snapshots sharing the
+// contents keep them as they were. Contents written this way are stored
+// without compression or deduplication, until they're rewritten. A part too
+// large for the database fails with EFBIG
+func AppendFileContents(db *sql.DB, inode int64, offset int64, data []byte) error {
+	if err := checkWriteSize(db, int64(len(data))); err != nil {
+		return err
+	}
+
+	return runInTx(db, "filedata append", func(tx *sql.Tx) error {
+		if err := preserveSnapshotData(tx, inode); err != nil {
+			return err
+		}
+
+		if offset == 0 {
+			if err := saveAppendedVersion(tx, inode); err != nil {
+				return err
+			}
+
+			if err := releaseFileData(tx, inode); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(rebind(tx, upsert(dialectOf(tx), "{{filedata}}", []string{"inode"}, filedataColumns)),
+				inode, data, nil, nil)
+			if err != nil {
+				log.Println("Couldn't update data for filedata row!")
+				return err
+			}
+
+			return nil
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+
+		res, err := tx.Exec(rebind(tx, "update {{filedata}} set data = "+blobConcat(dialectOf(tx), "data", "?")+
+			" where inode = ? and hash is null and compression is null and length(data) = ?"), data, inode, offset)
+		if err != nil {
+			log.Println("Couldn't append to filedata row!")
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n != 1 {
+			return fmt.Errorf("can't append to the contents of inode %d at offset %d", inode, offset)
+		}
+
+		return nil
+	})
+}
+
+// saveAppendedVersion is saveVersion for contents about to be replaced by
+// AppendFileContents. Contents which are still being written a part at a
+// time, like those of a file inserted empty with its final size, are shorter
+// than the size of the file and aren't kept
+func saveAppendedVersion(tx *sql.Tx, inode int64) error {
+	var partial int64
+	err := tx.QueryRow(rebind(tx,
+		`select count(*) from {{filedata}} filedata
+        join {{metadata}} metadata on metadata.inode = filedata.inode
+        where filedata.inode = ? and filedata.hash is null and filedata.compression is null
+            and coalesce(length(filedata.data), 0) < metadata.size`), inode).Scan(&partial)
+	if err != nil {
+		log.Println("Couldn't get filedata!")
+		return err
+	}
+	if partial > 0 {
+		return nil
+	}
+
+	return saveVersion(tx, inode, false)
+}
+
+// bulkInsert inserts rows using backend's BulkInserter, or a prepared insert
+func bulkInsert(backend SQLBackend, tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	if inserter, ok := backend.(BulkInserter); ok {
+		return inserter.BulkInsert(tx, table, columns, rows)
+	}
+
+	stmt, err := tx.Prepare(rebind(tx, insertQuery(table, columns, 1)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertQuery returns an insert of nRows rows of columns into table
+func insertQuery(table string, columns []string, nRows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := strings.TrimSuffix(strings.Repeat(row+", ", nRows), ", ")
+
+	return fmt.Sprintf("insert into %s(%s) values %s", TableName(table), strings.Join(columns, ", "), values)
+}
+
+// allocateInodes reserves n new inode numbers inside tx
+func allocateInodes(tx *sql.Tx, n int) ([]int64, error) {
+	var inodes []int64
+	if n == 0 {
+		return inodes, nil
+	}
+
+	d := dialectOf(tx)
+	if d.Inodes == InodeFromReturning && d.InodeDefault != "" {
+		// ask the database for n values of the column default, a chunk at a time
+		for len(inodes) < n {
+			chunk := n - len(inodes)
+			if chunk > 100 {
+				chunk = 100
+			}
+
+			query := strings.TrimSuffix(strings.Repeat("select "+d.InodeDefault+" union all ", chunk), " union all ")
+			rows, err := tx.Query(query)
+			if err != nil {
+				log.Println("Couldn't allocate inodes!")
+				return nil, err
+			}
+			for rows.Next() {
+				var inode int64
+				if err := rows.Scan(&inode); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				inodes = append(inodes, inode)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		return inodes, nil
+	}
+
+	var max int64
+	err := tx.QueryRow(rebind(tx, "select coalesce(max(inode), 0) from {{metadata}}")).Scan(&max)
+	if err != nil {
+		log.Println("Couldn't allocate inodes!")
+		return nil, err
+	}
+
+	for i := 1; i <= n; i++ {
+		inodes = append(inodes, max+int64(i))
+	}
+
+	return inodes, nil
+}
@@ -0,0 +1,102 @@
+package sqlutils
+
+import (
+	"bytes"
+	"testing"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// sqliteBackends are the backends tested without a database server
+var sqliteBackends = map[string]SQLBackend{
+	"sqlite":        SQLiteBackend{},
+	"sqlite-purego": PureGoSQLiteBackend{},
+}
+
+// newTestDB returns a new, initialized db of backend
+func newTestDB(t *testing.T, backend SQLBackend) *sql.DB {
+	t.Helper()
+
+	db, err := backend.OpenDB(t.TempDir() + "/fs.sql")
+	if err != nil {
+		t.Fatalf("Couldn't open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err = backend.CreateDBTables(db); err != nil {
+		t.Fatalf("Couldn't create DB tables: %v", err)
+	}
+	if err = backend.InitializeDBRows(db); err != nil {
+		t.Fatalf("Couldn't insert initial rows: %v", err)
+	}
+
+	return db
+}
+
+func TestAppendFileContents(t *testing.T) {
+	// not valid utf-8, with nul bytes
+	part := bytes.Repeat([]byte{0, 0xff, 'x', 0x80}, 1024)
+
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetCompression(db, CompressionZstd); err != nil {
+				t.Fatalf("Couldn't set compression: %v", err)
+			}
+			if err := SetDedup(db, true); err != nil {
+				t.Fatalf("Couldn't enable dedup: %v", err)
+			}
+
+			inode, err := backend.CreateFileUnderInode(db, 1, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+			// compressed and deduplicated
+			if err = backend.SetFileContentsForInode(db, inode, bytes.Repeat([]byte("a"), 8192)); err != nil {
+				t.Fatalf("Couldn't write file: %v", err)
+			}
+			if err = AppendFileContents(db, inode, 8192, part); err == nil {
+				t.Errorf("appending to compressed contents didn't fail")
+			}
+			if err = CreateSnapshot(db, "snapshot"); err != nil {
+				t.Fatalf("Couldn't create snapshot: %v", err)
+			}
+
+			var expected []byte
+			for i := 0; i < 3; i++ {
+				if err = AppendFileContents(db, inode, int64(len(expected)), part); err != nil {
+					t.Fatalf("Couldn't append part %d: %v", i, err)
+				}
+				expected = append(expected, part...)
+			}
+
+			if err = AppendFileContents(db, inode, 1, part); err == nil {
+				t.Errorf("appending before the end of the contents didn't fail")
+			}
+
+			data, err := backend.GetFileRangeForInode(db, inode, 0, int64(len(expected))+1)
+			if err != nil {
+				t.Fatalf("Couldn't read file: %v", err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Errorf("file has %d bytes, which differ from the %d appended", len(data), len(expected))
+			}
+
+			stats, err := GetDedupStats(db)
+			if err != nil {
+				t.Fatalf("Couldn't get dedup stats: %v", err)
+			}
+			if stats.Chunks != 0 {
+				t.Errorf("%d chunks left after replacing the only file using one", stats.Chunks)
+			}
+
+			snapshotted, err := NewSnapshotBackend(backend, "snapshot").GetFileContentsForInode(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't read snapshot: %v", err)
+			}
+			if !bytes.Equal(snapshotted, bytes.Repeat([]byte("a"), 8192)) {
+				t.Errorf("snapshot has %d bytes, which differ from the %d written before it", len(snapshotted), 8192)
+			}
+		})
+	}
+}
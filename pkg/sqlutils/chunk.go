@@ -0,0 +1,294 @@
+package sqlutils
+
+import (
+	"crypto/sha256"
+	dbsql "database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// With deduplication enabled (see SetDedup), file contents of at least
+// dedupMinSize bytes are stored once per distinct contents, in chunk, keyed by
+// their sha256. The filedata row of such a file has a null data and the hash
+// of its chunk, and refs counts the filedata rows referring to each chunk. A
+// chunk is removed with the last file using it. Contents are hashed whole
+// every time they're written, so it's off unless enabled
+
+// dedupSetting is the setting enabling deduplication
+const dedupSetting = "dedup"
+
+// dedupMinSize is the smallest file contents which are deduplicated. Smaller
+// ones aren't worth the extra row
+const dedupMinSize = 4096
+
+// fileData selects the contents of a file, joined by fileDataFrom
+const fileData = "coalesce(chunk.data, filedata.data)"
+
+// fileDataFrom joins filedata rows to their chunks
+const fileDataFrom = `
+    from {{filedata}} filedata
+    left join {{chunk}} chunk on chunk.hash = filedata.hash`
+
+// DedupStats describes how much deduplication saves
+type DedupStats struct {
+	// Files is the number of files whose contents are in chunks, and Bytes
+	// their total size
+	Files int64
+	Bytes int64
+	// Chunks is the number of distinct contents stored for them, and
+	// ChunkBytes their total size
+	Chunks     int64
+	ChunkBytes int64
+}
+
+// Ratio returns how many bytes of files there are per byte stored in chunks
+func (s DedupStats) Ratio() float64 {
+	if s.ChunkBytes == 0 {
+		return 1
+	}
+
+	return float64(s.Bytes) / float64(s.ChunkBytes)
+}
+
+// GetDedupStats returns how much deduplication saves in the fs
+func GetDedupStats(db *sql.DB) (DedupStats, error) {
+	var stats DedupStats
+
+	err := db.QueryRow(expandTables(
+		`select count(*), coalesce(sum(metadata.size), 0)
+        from {{filedata}} filedata
+        join {{metadata}} metadata on metadata.inode = filedata.inode
+        where filedata.hash is not null`)).Scan(&stats.Files, &stats.Bytes)
+	if err != nil {
+		log.Println("Couldn't get deduplicated files!")
+		return stats, err
+	}
+
+	err = db.QueryRow(expandTables("select count(*), coalesce(sum(size), 0) from {{chunk}}")).
+		Scan(&stats.Chunks, &stats.ChunkBytes)
+	if err != nil {
+		log.Println("Couldn't get chunks!")
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// GetDedup reports whether new file contents are deduplicated
+func GetDedup(db queryer) (bool, error) {
+	enabled, err := GetSetting(db, dedupSetting)
+	if err != nil || enabled == "" {
+		return false, err
+	}
+
+	dedup, err := strconv.ParseBool(enabled)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s setting: %w", dedupSetting, err)
+	}
+
+	return dedup, nil
+}
+
+// SetDedup sets whether new file contents are deduplicated. Existing contents
+// stay as they are until they're rewritten
+func SetDedup(db *sql.DB, dedup bool) error {
+	enabled := ""
+	if dedup {
+		enabled = strconv.FormatBool(dedup)
+	}
+
+	return SetSetting(db, dedupSetting, enabled)
+}
+
+// chunkHash returns the hash data is stored under, or "" if it's too small to
+// be deduplicated
+func chunkHash(data []byte) string {
+	if len(data) < dedupMinSize {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// addChunk adds a reference to the chunk with data, storing it compressed
+// with c if it's the first. A chunk inserted by a concurrent transaction in
+// the meantime gets the reference instead
+func addChunk(tx *sql.Tx, c Compression, hash string, data []byte) error {
+	res, err := tx.Exec(rebind(tx, "update {{chunk}} set refs = refs + 1 where hash = ?"), hash)
+	if err != nil {
+		log.Println("Couldn't update chunk refs!")
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	stored, c, err := compress(c, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, upsertIncrement(dialectOf(tx), "{{chunk}}", []string{"hash"},
+		[]string{"hash", "refs", "size", "data", "compression"}, "refs")),
+		hash, 1, len(data), stored, compressionValue(c))
+	if err != nil {
+		log.Println("Couldn't insert chunk row!")
+		return err
+	}
+
+	return nil
+}
+
+// releaseFileData drops the reference of file inode to its chunk, if it has
+// one, removing the chunk if nothing else uses it. Call it before the filedata
+// row is changed or removed, in the same transaction. The cached contents of
+// the file are dropped too
+func releaseFileData(tx *sql.Tx, inode int64) error {
+	uncacheFile(inode)
+
+	var hash dbsql.NullString
+	err := tx.QueryRow(rebind(tx, "select hash from {{filedata}} where inode = ?"), inode).Scan(&hash)
+	if err == dbsql.ErrNoRows || (err == nil && !hash.Valid) {
+		return nil
+	}
+	if err != nil {
+		log.Println("Couldn't get filedata!")
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, "update {{chunk}} set refs = refs - 1 where hash = ?"), hash.String)
+	if err != nil {
+		log.Println("Couldn't update chunk refs!")
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, "delete from {{chunk}} where hash = ? and refs <= 0"), hash.String)
+	if err != nil {
+		log.Println("Couldn't remove chunk row!")
+		return err
+	}
+
+	return nil
+}
+
+// writeFileData stores data as the contents of file inode, in a chunk if
+// deduplication is enabled and it's large enough, compressed with the
+// compression of the fs
+func writeFileData(tx *sql.Tx, inode int64, data []byte) error {
+	c, err := GetCompression(tx)
+	if err != nil {
+		return err
+	}
+
+	dedup, err := GetDedup(tx)
+	if err != nil {
+		return err
+	}
+
+	// the new chunk is referenced before the old one is released, so
+	// rewriting the same contents doesn't remove and insert it again
+	row, err := fileDataRow(tx, c, dedup, inode, data)
+	if err != nil {
+		return err
+	}
+
+	if err := releaseFileData(tx, inode); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, upsert(dialectOf(tx), "{{filedata}}", []string{"inode"}, filedataColumns)), row...)
+	if err != nil {
+		log.Println("Couldn't update data for filedata row!")
+		return err
+	}
+
+	return nil
+}
+
+// fileDataRow returns the filedata row of file inode with contents data,
+// compressed with c, as in filedataColumns. With dedup, it adds a reference
+// to the chunk of data if it's large enough to be deduplicated
+func fileDataRow(tx *sql.Tx, c Compression, dedup bool, inode int64, data []byte) ([]interface{}, error) {
+	var hash string
+	if dedup {
+		hash = chunkHash(data)
+	}
+	if hash != "" {
+		if err := addChunk(tx, c, hash, data); err != nil {
+			return nil, err
+		}
+
+		return []interface{}{inode, nil, hash, nil}, nil
+	}
+
+	stored, c, err := compress(c, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{inode, stored, nil, compressionValue(c)}, nil
+}
+
+// fileDataKey returns the key the decompressed contents of file inode are
+// cached under, given the hash of its chunk and its mtime
+func fileDataKey(db *sql.DB, inode int64, hash dbsql.NullString, mtime int64) cacheKey {
+	if hash.Valid {
+		return chunkKey(hash.String)
+	}
+
+	return fileKey(db, inode, mtime)
+}
+
+// readFileData returns the contents of file inode, decompressed
+func readFileData(db *sql.DB, inode int64) ([]byte, error) {
+	var data []byte
+	var c, hash dbsql.NullString
+	var mtime int64
+
+	err := db.QueryRow(rebind(db, "select "+fileData+", "+fileCompression+", filedata.hash, metadata.mtime"+
+		fileDataFrom+" join {{metadata}} metadata on metadata.inode = filedata.inode where filedata.inode = ?"),
+		inode).Scan(&data, &c, &hash, &mtime)
+	if err != nil {
+		log.Println("Couldn't get filedata!")
+		return nil, err
+	}
+
+	return decompressData(Compression(c.String), fileDataKey(db, inode, hash, mtime), data)
+}
+
+// readFileRange returns size bytes of the contents of file inode starting at
+// offset. Uncompressed contents are sliced by the database, compressed ones
+// are decompressed whole, or taken from contentsCache
+func readFileRange(db *sql.DB, inode int64, offset, size int64) ([]byte, error) {
+	var data []byte
+	var c, hash dbsql.NullString
+	var mtime int64
+
+	// substr counts from 1
+	err := db.QueryRow(rebind(db, "select "+fileCompression+", filedata.hash, metadata.mtime, case when "+
+		fileCompression+" is null then substr("+fileData+", ?, ?) end"+fileDataFrom+
+		" join {{metadata}} metadata on metadata.inode = filedata.inode where filedata.inode = ?"),
+		offset+1, size, inode).Scan(&c, &hash, &mtime, &data)
+	if err != nil {
+		log.Println("Couldn't get filedata!")
+		return nil, err
+	}
+	if !c.Valid {
+		return data, nil
+	}
+
+	contents, ok := getCachedContents(fileDataKey(db, inode, hash, mtime))
+	if !ok {
+		if contents, err = readFileData(db, inode); err != nil {
+			return nil, err
+		}
+	}
+
+	return sliceRange(contents, offset, size), nil
+}
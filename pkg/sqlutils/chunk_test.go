@@ -0,0 +1,69 @@
+package sqlutils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	contents := bytes.Repeat([]byte("deduplicated "), 1024)
+
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+
+			var inodes []int64
+			for _, name := range []string{"first", "second"} {
+				inode, err := backend.CreateFileUnderInode(db, 1, name, 0, 0)
+				if err != nil {
+					t.Fatalf("Couldn't create file: %v", err)
+				}
+				inodes = append(inodes, inode)
+			}
+
+			write := func() DedupStats {
+				t.Helper()
+
+				for _, inode := range inodes {
+					if err := backend.SetFileContentsForInode(db, inode, contents); err != nil {
+						t.Fatalf("Couldn't write file: %v", err)
+					}
+				}
+
+				stats, err := GetDedupStats(db)
+				if err != nil {
+					t.Fatalf("Couldn't get dedup stats: %v", err)
+				}
+				return stats
+			}
+
+			if stats := write(); stats.Chunks != 0 {
+				t.Errorf("%d chunks stored without dedup enabled", stats.Chunks)
+			}
+
+			if err := SetDedup(db, true); err != nil {
+				t.Fatalf("Couldn't enable dedup: %v", err)
+			}
+			if stats := write(); stats.Files != 2 || stats.Chunks != 1 {
+				t.Errorf("Expected 2 files sharing a chunk, got %+v", stats)
+			}
+
+			for _, inode := range inodes {
+				data, err := backend.GetFileContentsForInode(db, inode)
+				if err != nil {
+					t.Fatalf("Couldn't read file: %v", err)
+				}
+				if !bytes.Equal(data, contents) {
+					t.Errorf("deduplicated file has %d bytes, which differ from the %d written", len(data), len(contents))
+				}
+			}
+
+			if err := SetDedup(db, false); err != nil {
+				t.Fatalf("Couldn't disable dedup: %v", err)
+			}
+			if stats := write(); stats.Chunks != 0 {
+				t.Errorf("%d chunks left after rewriting with dedup disabled", stats.Chunks)
+			}
+		})
+	}
+}
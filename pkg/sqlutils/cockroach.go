@@ -0,0 +1,62 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	_ "embed"
+
+	sql "github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// CockroachBackend talks to CockroachDB over the postgres wire protocol.
+// Inodes are generated by unique_rowid() instead of max(inode) to avoid
+// contention, and transactions are retried when cockroach asks for it.
+type CockroachBackend struct{ defaultBackend }
+
+var _ SQLBackend = (*CockroachBackend)(nil)
+
+//go:embed init-cockroach.sql
+var createTableCockroach string
+
+var cockroachDialect = Dialect{
+	Driver:       "cockroach",
+	BindType:     sql.DOLLAR,
+	BlobType:     "bytes",
+	Upsert:       UpsertOnConflict,
+	Inodes:       InodeFromReturning,
+	InodeDefault: "unique_rowid()",
+	Schemas:      true,
+	RetryTx:      true,
+	Tables:       createTableCockroach,
+	// ranges are replicated and can hold several tables, so this is the size
+	// of the stored contents and names rather than what's on disk
+	SizeQuery: `select
+        (select coalesce(sum(octet_length(name)), 0) from {{metadata}}) +
+        (select coalesce(sum(octet_length(data)), 0) from {{filedata}}) +
+        (select coalesce(sum(octet_length(name)), 0) from {{snapshot_metadata}}) +
+        (select coalesce(sum(octet_length(data)), 0) from {{snapshot_data}}) +
+        (select coalesce(sum(octet_length(data)), 0) from {{version}}) +
+        (select coalesce(sum(octet_length(data)), 0) from {{chunk}})`,
+}
+
+func init() {
+	// registered under its own name so that it gets its own dialect
+	dbsql.Register("cockroach", &pq.Driver{})
+
+	Register("cockroach", CockroachBackend{})
+}
+
+// Dialect returns the cockroach dialect
+func (c CockroachBackend) Dialect() Dialect {
+	return cockroachDialect
+}
+
+// OpenDB connects to dsn, which is accepted in the same forms as postgres
+func (c CockroachBackend) OpenDB(dsn string) (*sql.DB, error) {
+	connStr, err := postgresConnString(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.Open("cockroach", connStr)
+}
@@ -1,7 +1,9 @@
 package sqlutils
 
 import (
+	dbsql "database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"syscall"
@@ -11,12 +13,6 @@ import (
 	sql "github.com/jmoiron/sqlx"
 )
 
-var AvaialableBackends = map[string]SQLBackend{
-	"sqlite":   SQLiteBackend{},
-	"mysql":    MySQLBackend{},
-	"postgres": PostgresBackend{},
-}
-
 // Metadata table as go struct
 type Metadata struct {
 	Inode int64 `db:"inode"`
@@ -36,40 +32,110 @@ type Metadata struct {
 }
 
 type SQLBackend interface {
+	// Dialect describes the SQL flavour spoken by the backend's database
+	Dialect() Dialect
+
 	OpenDB(dsn string) (*sql.DB, error)
 	VerifyDB(db *sql.DB) error
 
 	CreateDBTables(db *sql.DB) error
 	InitializeDBRows(db *sql.DB) error
 
-	GetMetadataForInode(db *sql.DB, inode int32) (Metadata, error)
-	SetMetadataForInode(db *sql.DB, inode int32, metadata Metadata) error
+	GetMetadataForInode(db *sql.DB, inode int64) (Metadata, error)
+	SetMetadataForInode(db *sql.DB, inode int64, metadata Metadata) error
 
-	GetDirectoryContentsForInode(db *sql.DB, inode int32) ([]int32, error)
+	GetDirectoryContentsForInode(db *sql.DB, inode int64) ([]int64, error)
+	// GetInodeForNameUnderInode returns the inode of the entry named name in
+	// the directory referred to by inode, or sql.ErrNoRows
+	GetInodeForNameUnderInode(db *sql.DB, inode int64, name string) (int64, error)
 
-	GetFileContentsForInode(db *sql.DB, inode int32) ([]byte, error)
-	SetFileContentsForInode(db *sql.DB, inode int32, data []byte) error
+	GetFileContentsForInode(db *sql.DB, inode int64) ([]byte, error)
+	SetFileContentsForInode(db *sql.DB, inode int64, data []byte) error
+	// GetFileRangeForInode reads up to size bytes of the contents of file
+	// inode, starting at offset, without loading the whole file. Unlike
+	// GetFileContentsForInode, it doesn't update atime
+	GetFileRangeForInode(db *sql.DB, inode int64, offset, size int64) ([]byte, error)
 
 	// could've been the same function with an if condition
 	// but maybe some backends might want to utilize the segregation
-	CreateDirUnderInode(db *sql.DB, inode int32, name string) (int32, error)
-	CreateFileUnderInode(db *sql.DB, inode int32, name string) (int32, error)
+	CreateDirUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error)
+	CreateFileUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error)
 
 	// could've been the same function with an if condition
 	// but maybe some backends might want to utilize the segregation
-	RemoveDirUnderInode(db *sql.DB, inode int32, name string) error
-	RemoveFileUnderInode(db *sql.DB, inode int32, name string) error
+	RemoveDirUnderInode(db *sql.DB, inode int64, name string) error
+	RemoveFileUnderInode(db *sql.DB, inode int64, name string) error
+
+	// RenameUnderInode moves the entry named name in directory inode to
+	// directory newInode as newName, replacing what was there
+	RenameUnderInode(db *sql.DB, inode int64, name string, newInode int64, newName string) error
+
+	// GetUsage reports how many inodes and bytes are stored, and how large the
+	// tables are
+	GetUsage(db *sql.DB) (Usage, error)
+}
+
+// ReadOnlyOpener is implemented by backends which change the db when opening
+// it unless told it's only going to be read, like sqlite setting its journal
+// mode
+type ReadOnlyOpener interface {
+	// OpenDBReadOnly connects to dsn without changing anything in the db
+	OpenDBReadOnly(dsn string) (*sql.DB, error)
+}
+
+// OpenDBReadOnly connects to dsn using backend's ReadOnlyOpener if it has
+// one, or OpenDB
+func OpenDBReadOnly(backend SQLBackend, dsn string) (*sql.DB, error) {
+	if opener, ok := backend.(ReadOnlyOpener); ok {
+		return opener.OpenDBReadOnly(dsn)
+	}
+
+	return backend.OpenDB(dsn)
 }
 
 type defaultBackend struct{}
 
+// CreateDBTables creates the schema, if one was set, and runs the table
+// creation script of db's dialect
+func (d defaultBackend) CreateDBTables(db *sql.DB) error {
+	dialect := dialectOf(db)
+
+	if schema := Schema(); schema != "" && dialect.Schemas {
+		if _, err := db.Exec("create schema if not exists " + schema); err != nil {
+			log.Println("Couldn't create schema!")
+			return err
+		}
+	}
+
+	_, err := db.Exec(createTablesScript(dialect))
+	if err != nil {
+		log.Println("Couldn't write initial tables!")
+		return err
+	}
+
+	// tables of dbs created by older versions don't have newer columns
+	for _, c := range addedColumns {
+		if hasColumn(db, c.table, c.column) {
+			continue
+		}
+
+		_, err := db.Exec(expandTables("alter table {{" + c.table + "}} add column " + c.column + " " + c.definition))
+		if err != nil {
+			log.Printf("Couldn't add %s to %s!\n", c.column, c.table)
+			return err
+		}
+	}
+
+	return nil
+}
+
 // VerifyDB does pretty basic check for whether the necessary tables were created.
 // This check might pass and later operations still might fail.
 //
 // TODO: do more extensive checks
 func (d defaultBackend) VerifyDB(db *sql.DB) error {
 	var rootName string
-	err := db.QueryRow(db.Rebind("select name from metadata where inode = ?"), 1).Scan(&rootName)
+	err := db.QueryRow(rebind(db, "select name from {{metadata}} where inode = ?"), 1).Scan(&rootName)
 	if err != nil {
 		return err
 	}
@@ -78,49 +144,64 @@ func (d defaultBackend) VerifyDB(db *sql.DB) error {
 		return errors.New("Expected to find entry with empty name for inode=1 in metadata")
 	}
 
+	// tables added since the db was created are added by running init again
+	for _, table := range tables {
+		var one int64
+		err := db.QueryRow(expandTables("select 1 from {{" + table + "}} where 1 = 0")).Scan(&one)
+		if err != dbsql.ErrNoRows {
+			return fmt.Errorf("Couldn't find the %s table, run `sqlfs init` to upgrade the db: %w", table, err)
+		}
+	}
+	for _, c := range addedColumns {
+		if !hasColumn(db, c.table, c.column) {
+			return fmt.Errorf("Couldn't find the %s column of the %s table, run `sqlfs init` to upgrade the db", c.column, c.table)
+		}
+	}
+
 	return nil
 }
 
-// InitializeDBRows creates the necessary rows for fs to function
+// InitializeDBRows creates the necessary rows for fs to function. Rows which
+// already exist are left alone, so it's safe to run on an initialized db
 //
 // Currently, only root metadata is setup
 func (d defaultBackend) InitializeDBRows(db *sql.DB) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for initial rows!")
-		return err
-	}
+	return runInTx(db, "initial rows", func(tx *sql.Tx) error {
+		var nRoots int64
+		err := tx.QueryRow(rebind(tx, "select count(*) from {{metadata}} where inode = ?"), 1).Scan(&nRoots)
+		if err != nil {
+			log.Println("Couldn't look for root metadata!")
+			return err
+		}
+		if nRoots > 0 {
+			return nil
+		}
 
-	// add metadata entries for /
-	var currentTimeNs = time.Now().UnixNano()
-	_, err = tx.Exec(db.Rebind(
-		`insert into
-            metadata(inode,uid,gid,mode,type,ctime,atime,mtime,name)
+		// add metadata entries for /
+		var currentTimeNs = time.Now().UnixNano()
+		_, err = tx.Exec(rebind(tx,
+			`insert into
+            {{metadata}}(inode,uid,gid,mode,type,ctime,atime,mtime,name)
             values (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
-		1, os.Getuid(), os.Getgid(), os.ModeDir|0755, fuse.DT_Dir, currentTimeNs, currentTimeNs, currentTimeNs, "",
-	)
-	if err != nil {
-		log.Println("Couldn't insert metadata rows!")
-		return err
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		log.Println("Couldn't commit tx for initial rows!")
-		return err
-	}
+			1, os.Getuid(), os.Getgid(), os.ModeDir|0755, fuse.DT_Dir, currentTimeNs, currentTimeNs, currentTimeNs, "",
+		)
+		if err != nil {
+			log.Println("Couldn't insert metadata rows!")
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // GetMetadataForInode retrieves metadata for a given inode from db
-func (d defaultBackend) GetMetadataForInode(db *sql.DB, inode int32) (Metadata, error) {
+func (d defaultBackend) GetMetadataForInode(db *sql.DB, inode int64) (Metadata, error) {
 	var metadata Metadata
 
-	err := db.QueryRowx(db.Rebind(
+	err := db.QueryRowx(rebind(db,
 		`select
             inode,uid,gid,mode,type,ctime,atime,mtime,name,size
-            from metadata where inode = ?`), inode,
+            from {{metadata}} where inode = ?`), inode,
 	).StructScan(&metadata)
 	if err != nil {
 		log.Println("Coulnd't query select statement for Attr lookup")
@@ -130,39 +211,41 @@ func (d defaultBackend) GetMetadataForInode(db *sql.DB, inode int32) (Metadata,
 	return metadata, nil
 }
 
-// SetMetadataForInode updates metadata for inode on db
-func (d defaultBackend) SetMetadataForInode(db *sql.DB, inode int32, metadata Metadata) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for metadata update!")
-		return err
-	}
-	_, err = tx.Exec(db.Rebind(
-		`update metadata
+// SetMetadataForInode updates metadata for inode on db. Growing the file, by
+// truncating it to a larger size, or giving it to another owner or group is
+// checked against quotas
+func (d defaultBackend) SetMetadataForInode(db *sql.DB, inode int64, metadata Metadata) error {
+	return runInTx(db, "metadata update", func(tx *sql.Tx) error {
+		var size, uid, gid int64
+		err := tx.QueryRow(rebind(tx, "select size, uid, gid from {{metadata}} where inode = ?"), metadata.Inode).
+			Scan(&size, &uid, &gid)
+		if err != nil {
+			log.Println("Couldn't get metadata!")
+			return err
+		}
+
+		_, err = tx.Exec(rebind(tx,
+			`update {{metadata}}
             set uid = ?, gid = ?, mode = ?, type = ?, ctime = ?, atime = ?, mtime = ?, name = ?, size = ?
             where inode = ?`),
-		metadata.Uid, metadata.Gid, metadata.Mode, metadata.Type, metadata.Ctime,
-		metadata.Atime, metadata.Mtime, metadata.Name, metadata.Size, metadata.Inode,
-	)
-	if err != nil {
-		log.Println("Couldn't update data for metadata row!")
-		return err
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		log.Println("Couldn't commit tx for metadata update!")
-		return err
-	}
+			metadata.Uid, metadata.Gid, metadata.Mode, metadata.Type, metadata.Ctime,
+			metadata.Atime, metadata.Mtime, metadata.Name, metadata.Size, metadata.Inode,
+		)
+		if err != nil {
+			log.Println("Couldn't update data for metadata row!")
+			return err
+		}
 
-	return nil
+		chowned := metadata.Uid != uid || metadata.Gid != gid
+		return checkQuota(tx, metadata.Inode, metadata.Size > size || chowned, chowned)
+	})
 }
 
 // GetDirectoryContentsForInode returns all children of inode from db
-func (d defaultBackend) GetDirectoryContentsForInode(db *sql.DB, inode int32) ([]int32, error) {
-	var childInodes []int32
+func (d defaultBackend) GetDirectoryContentsForInode(db *sql.DB, inode int64) ([]int64, error) {
+	var childInodes []int64
 
-	rows, err := db.Query(db.Rebind("select inode from parent where pinode = ?"), inode)
+	rows, err := db.Query(rebind(db, "select inode from {{parent}} where pinode = ?"), inode)
 	if err != nil {
 		log.Println("Couldn't query parent table!")
 		return childInodes, err
@@ -176,7 +259,7 @@ func (d defaultBackend) GetDirectoryContentsForInode(db *sql.DB, inode int32) ([
 			return childInodes, err
 		}
 
-		childInodes = append(childInodes, int32(childInode))
+		childInodes = append(childInodes, childInode)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -187,41 +270,41 @@ func (d defaultBackend) GetDirectoryContentsForInode(db *sql.DB, inode int32) ([
 	return childInodes, nil
 }
 
+// GetInodeForNameUnderInode returns the inode of Dir/File named name under
+// directory referred to by inode
+func (d defaultBackend) GetInodeForNameUnderInode(db *sql.DB, inode int64, name string) (int64, error) {
+	return getInodeFromNameUnderDir(db, inode, name)
+}
+
 // GetFileContentsForInode reads file contents for inode from db
 //
 // TODO: split contents into blocks
-func (d defaultBackend) GetFileContentsForInode(db *sql.DB, inode int32) ([]byte, error) {
+func (d defaultBackend) GetFileContentsForInode(db *sql.DB, inode int64) ([]byte, error) {
 	var data []byte
 	var size int64
 
-	err := db.QueryRow(db.Rebind("select size from metadata where inode = ?"), inode).Scan(&size)
+	err := db.QueryRow(rebind(db, "select size from {{metadata}} where inode = ?"), inode).Scan(&size)
 	if err != nil {
 		log.Println("Couldn't get metadata!")
 		return data, err
 	}
 
-	err = db.QueryRow(db.Rebind("select data from filedata where inode = ?"), inode).Scan(&data)
+	data, err = readFileData(db, inode)
 	if err != nil {
-		log.Println("Couldn't get filedata!")
 		return data, err
 	}
 
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for metadata update!")
-		return data, err
-	}
-
-	var currentTimeNs = time.Now().UnixNano()
-	_, err = tx.Exec(db.Rebind("update metadata set atime = ? where inode = ?"), currentTimeNs, inode)
-	if err != nil {
-		log.Println("Couldn't update data for metadata row!")
-		return data, err
-	}
+	err = runInTx(db, "metadata update", func(tx *sql.Tx) error {
+		var currentTimeNs = time.Now().UnixNano()
+		_, err := tx.Exec(rebind(tx, "update {{metadata}} set atime = ? where inode = ?"), currentTimeNs, inode)
+		if err != nil {
+			log.Println("Couldn't update data for metadata row!")
+			return err
+		}
 
-	err = tx.Commit()
+		return nil
+	})
 	if err != nil {
-		log.Println("Couldn't commit tx for metadata update!")
 		return data, err
 	}
 
@@ -231,98 +314,121 @@ func (d defaultBackend) GetFileContentsForInode(db *sql.DB, inode int32) ([]byte
 	return filecontents, nil
 }
 
-// SetFileContentsForInode updates file content for inode on db
-func (d defaultBackend) SetFileContentsForInode(db *sql.DB, inode int32, data []byte) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for filedata update!")
+// GetFileRangeForInode reads size bytes of file contents for inode from db,
+// starting at offset
+func (d defaultBackend) GetFileRangeForInode(db *sql.DB, inode int64, offset, size int64) ([]byte, error) {
+	return readFileRange(db, inode, offset, size)
+}
+
+// SetFileContentsForInode updates file content for inode on db. The previous
+// contents are kept as a version if versions are enabled. Growing a file over
+// a quota fails with EDQUOT, and contents too large for the database with
+// EFBIG
+func (d defaultBackend) SetFileContentsForInode(db *sql.DB, inode int64, data []byte) error {
+	if err := checkWriteSize(db, int64(len(data))); err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(db.Rebind("update filedata set data = ? where inode = ?"), data, inode)
+	return runInTx(db, "filedata update", func(tx *sql.Tx) error {
+		return setFileContents(tx, inode, data, false)
+	})
+}
+
+// setFileContents is SetFileContentsForInode inside tx. forceVersion keeps the
+// previous contents as a version however recently they were written
+func setFileContents(tx *sql.Tx, inode int64, data []byte, forceVersion bool) error {
+	var size int64
+	err := tx.QueryRow(rebind(tx, "select size from {{metadata}} where inode = ?"), inode).Scan(&size)
 	if err != nil {
-		log.Println("Couldn't update data for filedata row!")
+		log.Println("Couldn't get metadata!")
+		return err
+	}
+
+	if err := preserveSnapshotData(tx, inode); err != nil {
+		return err
+	}
+
+	if err := saveVersion(tx, inode, forceVersion); err != nil {
+		return err
+	}
+
+	if err := writeFileData(tx, inode, data); err != nil {
 		return err
 	}
 
 	var currentTimeNs = time.Now().UnixNano()
-	_, err = tx.Exec(db.Rebind("update metadata set size = ?, mtime = ? where inode = ?"), len(data), currentTimeNs, inode)
+	_, err = tx.Exec(rebind(tx, "update {{metadata}} set size = ?, mtime = ? where inode = ?"), len(data), currentTimeNs, inode)
 	if err != nil {
 		log.Println("Couldn't update data for metadata row!")
 		return err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		log.Println("Couldn't commit tx for filedata update!")
-		return err
+	if int64(len(data)) > size {
+		return checkQuota(tx, inode, true, false)
 	}
 
 	return nil
 }
 
-// CreateDirUnderInode creates a Dir named name under directory referred to by inode
-func (d defaultBackend) CreateDirUnderInode(db *sql.DB, inode int32, name string) (int32, error) {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for mkdir!")
-		return 0, err
-	}
+// CreateDirUnderInode creates a Dir named name, owned by uid and gid, under
+// directory referred to by inode. Going over an inode quota fails with EDQUOT
+func (d defaultBackend) CreateDirUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error) {
+	var newDirInode int64
 
-	newDirInode, err := insertIntoMetadata(tx, int64(os.ModeDir|0755), int64(fuse.DT_Dir), name)
-	if err != nil {
-		return 0, err
-	}
+	err := runInTx(db, "mkdir", func(tx *sql.Tx) error {
+		var err error
+		newDirInode, err = insertIntoMetadata(tx, int64(os.ModeDir|0755), int64(fuse.DT_Dir), name, uid, gid)
+		if err != nil {
+			return err
+		}
 
-	err = insertIntoParent(tx, int64(inode), int64(newDirInode))
-	if err != nil {
-		return 0, err
-	}
+		if err := insertIntoParent(tx, inode, newDirInode); err != nil {
+			return err
+		}
 
-	err = tx.Commit()
+		return checkQuota(tx, newDirInode, false, true)
+	})
 	if err != nil {
-		log.Println("Couldn't commit tx for mkdir!")
 		return 0, err
 	}
 
-	return int32(newDirInode), nil
+	return newDirInode, nil
 }
 
-// CreateFileUnderInode creates a File named name under directory referred to by inode
-func (d defaultBackend) CreateFileUnderInode(db *sql.DB, inode int32, name string) (int32, error) {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for create file!")
-		return 0, err
-	}
+// CreateFileUnderInode creates a File named name, owned by uid and gid, under
+// directory referred to by inode. Going over an inode quota fails with EDQUOT
+func (d defaultBackend) CreateFileUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error) {
+	var newFileInode int64
 
-	newFileInode, err := insertIntoMetadata(tx, int64(0644), int64(fuse.DT_File), name)
-	if err != nil {
-		return 0, err
-	}
+	err := runInTx(db, "create file", func(tx *sql.Tx) error {
+		var err error
+		newFileInode, err = insertIntoMetadata(tx, int64(0644), int64(fuse.DT_File), name, uid, gid)
+		if err != nil {
+			return err
+		}
 
-	_, err = tx.Exec(db.Rebind("insert into filedata values (?, ?)"), newFileInode, []byte(""))
-	if err != nil {
-		log.Println("Couldn't insert create file data rows!")
-		return 0, err
-	}
+		_, err = tx.Exec(rebind(tx, "insert into {{filedata}}(inode, data) values (?, ?)"), newFileInode, []byte(""))
+		if err != nil {
+			log.Println("Couldn't insert create file data rows!")
+			return err
+		}
 
-	err = insertIntoParent(tx, int64(inode), int64(newFileInode))
-	if err != nil {
-		return 0, err
-	}
+		if err := insertIntoParent(tx, inode, newFileInode); err != nil {
+			return err
+		}
 
-	err = tx.Commit()
+		return checkQuota(tx, newFileInode, false, true)
+	})
 	if err != nil {
-		log.Println("Couldn't commit tx for create file!")
 		return 0, err
 	}
 
-	return int32(newFileInode), nil
+	return newFileInode, nil
 }
 
-// RemoveDirUnderInode removes Dir named name from  directory referred to by inode
-func (d defaultBackend) RemoveDirUnderInode(db *sql.DB, inode int32, name string) error {
+// RemoveDirUnderInode removes Dir named name from  directory referred to by
+// inode, moving it to the trash if it's enabled
+func (d defaultBackend) RemoveDirUnderInode(db *sql.DB, inode int64, name string) error {
 	childInode, err := getInodeFromNameUnderDir(db, inode, name)
 	if err != nil {
 		log.Println("Couldn't retrieve inode from name!")
@@ -330,7 +436,7 @@ func (d defaultBackend) RemoveDirUnderInode(db *sql.DB, inode int32, name string
 	}
 
 	var nChildren int64
-	err = db.QueryRow(db.Rebind("select count(*) from parent where pinode = ?"), childInode).Scan(&nChildren)
+	err = db.QueryRow(rebind(db, "select count(*) from {{parent}} where pinode = ?"), childInode).Scan(&nChildren)
 	if err != nil {
 		log.Println("Couldn't retrive children for inode!")
 	}
@@ -339,71 +445,91 @@ func (d defaultBackend) RemoveDirUnderInode(db *sql.DB, inode int32, name string
 		return fuse.Errno(syscall.ENOTEMPTY)
 	}
 
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for dir removal!")
-		return err
-	}
+	return runInTx(db, "dir removal", func(tx *sql.Tx) error {
+		if trashed, err := moveToTrash(tx, inode, childInode); err != nil || trashed {
+			return err
+		}
 
-	// delete from metadata
-	err = removeFromMetadata(tx, int64(childInode))
-	if err != nil {
-		return err
-	}
+		if err := deleteInode(tx, childInode); err != nil {
+			return err
+		}
 
-	// delete from parent
-	err = removeFromParent(tx, int64(inode), int64(childInode))
-	if err != nil {
-		return err
-	}
+		// delete from parent
+		return removeFromParent(tx, inode, childInode)
+	})
+}
 
-	err = tx.Commit()
+// RemoveFileUnderInode removes File named name from  directory referred to by
+// inode, moving it to the trash if it's enabled
+func (d defaultBackend) RemoveFileUnderInode(db *sql.DB, inode int64, name string) error {
+	childInode, err := getInodeFromNameUnderDir(db, inode, name)
 	if err != nil {
-		log.Println("Couldn't commit tx for dir removal!")
+		log.Println("Couldn't retrieve inode from name!")
 		return err
 	}
 
-	return nil
+	return runInTx(db, "file removal", func(tx *sql.Tx) error {
+		if trashed, err := moveToTrash(tx, inode, childInode); err != nil || trashed {
+			return err
+		}
+
+		if err := deleteInode(tx, childInode); err != nil {
+			return err
+		}
+
+		// delete from parent
+		return removeFromParent(tx, inode, childInode)
+	})
 }
 
-// RemoveFileUnderInode removes File named name from  directory referred to by inode
-func (d defaultBackend) RemoveFileUnderInode(db *sql.DB, inode int32, name string) error {
+// RenameUnderInode moves Dir/File named name from directory referred to by
+// inode to directory referred to by newInode, naming it newName. An existing
+// newName is replaced, if it's an empty dir or a file like the one moved
+func (d defaultBackend) RenameUnderInode(db *sql.DB, inode int64, name string, newInode int64, newName string) error {
 	childInode, err := getInodeFromNameUnderDir(db, inode, name)
 	if err != nil {
 		log.Println("Couldn't retrieve inode from name!")
 		return err
 	}
 
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("Couldn't prepare tx for file removal!")
-		return err
-	}
+	return runInTx(db, "rename", func(tx *sql.Tx) error {
+		var childType int64
+		err := tx.QueryRow(rebind(tx, "select type from {{metadata}} where inode = ?"), childInode).Scan(&childType)
+		if err != nil {
+			log.Println("Couldn't get metadata!")
+			return err
+		}
 
-	// delete from metadata
-	err = removeFromMetadata(tx, int64(childInode))
-	if err != nil {
-		return err
-	}
+		// a dir can't be moved inside itself
+		if childType == int64(fuse.DT_Dir) {
+			inside, err := isAncestor(tx, childInode, newInode)
+			if err != nil {
+				return err
+			}
+			if inside {
+				return fuse.Errno(syscall.EINVAL)
+			}
+		}
 
-	// delete from filedata
-	_, err = tx.Exec(db.Rebind("delete from filedata where inode = ?"), childInode)
-	if err != nil {
-		log.Println("Couldn't remove filedata rows!")
-		return err
-	}
+		if err := removeRenameTarget(tx, newInode, newName, childInode, childType); err != nil {
+			return err
+		}
 
-	// delete from parent
-	err = removeFromParent(tx, int64(inode), int64(childInode))
-	if err != nil {
-		return err
-	}
+		_, err = tx.Exec(rebind(tx, "update {{parent}} set pinode = ? where pinode = ? and inode = ?"),
+			newInode, inode, childInode)
+		if err != nil {
+			log.Println("Couldn't update parent row!")
+			return err
+		}
 
-	err = tx.Commit()
-	if err != nil {
-		log.Println("Couldn't commit tx for file removal!")
-		return err
-	}
+		var currentTimeNs = time.Now().UnixNano()
+		_, err = tx.Exec(rebind(tx, "update {{metadata}} set name = ?, ctime = ? where inode = ?"),
+			newName, currentTimeNs, childInode)
+		if err != nil {
+			log.Println("Couldn't update data for metadata row!")
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
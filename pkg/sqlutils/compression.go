@@ -0,0 +1,356 @@
+package sqlutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	sql "github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/zstd"
+)
+
+// File contents are compressed with the compression of the fs when they're
+// written, if that makes them small enough. Every row holding contents (in
+// filedata, chunk, snapshot_data and version) records how its data was
+// compressed in its compression column, null for uncompressed, so changing
+// the compression of the fs leaves existing contents readable. Copying
+// contents between those tables copies the column along
+
+// compressionSetting is the setting holding the compression of the fs
+const compressionSetting = "compression"
+
+// Compression is how file contents are compressed
+type Compression string
+
+// Compressions which can be used. CompressionNone stores contents as they are
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Compressions lists the compressions which can be used, besides none
+var Compressions = []Compression{CompressionGzip, CompressionZstd}
+
+// compressMinSize is the smallest file contents which are compressed
+const compressMinSize = 128
+
+// compressMaxRatio is the largest compressed size, relative to the original,
+// which is worth keeping. Contents which don't compress better than this are
+// stored as they are
+const compressMaxRatio = 0.9
+
+// fileCompression selects the compression of the contents of a file, joined
+// by fileDataFrom
+const fileCompression = "coalesce(chunk.compression, filedata.compression)"
+
+// ParseCompression returns the compression named name, "none" or "" being
+// CompressionNone
+func ParseCompression(name string) (Compression, error) {
+	if name == "" || name == "none" {
+		return CompressionNone, nil
+	}
+
+	for _, c := range Compressions {
+		if Compression(name) == c {
+			return c, nil
+		}
+	}
+
+	return CompressionNone, fmt.Errorf("unknown compression `%s`, expected none, gzip or zstd", name)
+}
+
+// GetCompression returns the compression new file contents are stored with
+func GetCompression(db queryer) (Compression, error) {
+	name, err := GetSetting(db, compressionSetting)
+	if err != nil {
+		return CompressionNone, err
+	}
+
+	return ParseCompression(name)
+}
+
+// SetCompression sets the compression new file contents are stored with.
+// Existing contents stay as they are until they're rewritten
+func SetCompression(db *sql.DB, c Compression) error {
+	if _, err := ParseCompression(string(c)); err != nil {
+		return err
+	}
+
+	return SetSetting(db, compressionSetting, string(c))
+}
+
+// compressionValue returns c as stored in compression columns, null for
+// CompressionNone
+func compressionValue(c Compression) interface{} {
+	if c == CompressionNone {
+		return nil
+	}
+
+	return string(c)
+}
+
+// zstd encoders and decoders are safe for concurrent use with EncodeAll and
+// DecodeAll, and expensive to create
+var zstdEncoder, _ = zstd.NewWriter(nil)
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// compress compresses data with c, returning the compression it's stored
+// with, which is CompressionNone if compressing it isn't worth it
+func compress(c Compression, data []byte) ([]byte, Compression, error) {
+	if c == CompressionNone || len(data) < compressMinSize {
+		return data, CompressionNone, nil
+	}
+
+	var compressed []byte
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, c, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, c, err
+		}
+		compressed = buf.Bytes()
+	case CompressionZstd:
+		compressed = zstdEncoder.EncodeAll(data, nil)
+	default:
+		return nil, c, fmt.Errorf("unknown compression `%s`", c)
+	}
+
+	if float64(len(compressed)) > compressMaxRatio*float64(len(data)) {
+		return data, CompressionNone, nil
+	}
+
+	return compressed, c, nil
+}
+
+// decompress undoes compress. Contents stored without compression have a
+// null compression, which scans as CompressionNone
+func decompress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			log.Println("Couldn't decompress file contents!")
+			return nil, err
+		}
+		defer r.Close()
+
+		return ioutil.ReadAll(r)
+	case CompressionZstd:
+		decompressed, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			log.Println("Couldn't decompress file contents!")
+			return nil, err
+		}
+
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf("unknown compression `%s`", c)
+	}
+}
+
+// decompressData decompresses data, compressed with c, keeping the result in
+// contentsCache under key
+func decompressData(c Compression, key cacheKey, data []byte) ([]byte, error) {
+	if c == CompressionNone {
+		return data, nil
+	}
+
+	if cached, ok := getCachedContents(key); ok {
+		return cached, nil
+	}
+
+	data, err := decompress(c, data)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&decompressions, 1)
+
+	cacheContents(key, data)
+
+	return data, nil
+}
+
+// decompressions counts the contents decompressed by decompressData
+var decompressions int64
+
+// sliceRange returns a copy of size bytes of data starting at offset, or what
+// there is of them
+func sliceRange(data []byte, offset, size int64) []byte {
+	if offset >= int64(len(data)) {
+		return []byte{}
+	}
+
+	end := offset + size
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+
+	return append([]byte{}, data[offset:end]...)
+}
+
+// cacheKey identifies decompressed contents in contentsCache. Chunks never
+// change, so their hash is enough, and is the same in every db. Other
+// contents are those file inode of db had at mtime, or those of row dataID of
+// snapshot_data, which never changes either
+type cacheKey struct {
+	hash   string
+	db     *sql.DB
+	inode  int64
+	mtime  int64
+	dataID int64
+}
+
+// chunkKey, fileKey and snapshotDataKey return the keys of the contents of
+// chunk hash, of file inode in db at mtime, and of snapshot_data row dataID
+func chunkKey(hash string) cacheKey {
+	return cacheKey{hash: hash}
+}
+
+func fileKey(db *sql.DB, inode, mtime int64) cacheKey {
+	return cacheKey{db: db, inode: inode, mtime: mtime}
+}
+
+func snapshotDataKey(db *sql.DB, dataID int64) cacheKey {
+	return cacheKey{db: db, dataID: dataID}
+}
+
+// contentsCacheSize is the most bytes of decompressed contents kept in memory
+const contentsCacheSize = 64 << 20
+
+// contentsCache keeps recently decompressed contents, so reading a compressed
+// file in parts doesn't decompress it all again for every part. Contents
+// written in this process are dropped by releaseFileData; a file rewritten by
+// another process gets a new mtime, and so a new key
+var contentsCache = struct {
+	sync.Mutex
+	contents map[cacheKey][]byte
+	// order has the keys of contents, least recently added first
+	order []cacheKey
+	size  int
+}{contents: map[cacheKey][]byte{}}
+
+// getCachedContents returns the decompressed contents under key, if cached
+func getCachedContents(key cacheKey) ([]byte, bool) {
+	contentsCache.Lock()
+	defer contentsCache.Unlock()
+
+	data, ok := contentsCache.contents[key]
+	return data, ok
+}
+
+// cacheContents keeps the decompressed contents under key, evicting the
+// oldest contents to make room. Contents larger than the cache aren't kept
+func cacheContents(key cacheKey, data []byte) {
+	if len(data) > contentsCacheSize {
+		return
+	}
+
+	contentsCache.Lock()
+	defer contentsCache.Unlock()
+
+	if _, ok := contentsCache.contents[key]; ok {
+		return
+	}
+
+	for contentsCache.size+len(data) > contentsCacheSize {
+		oldest := contentsCache.order[0]
+		contentsCache.order = contentsCache.order[1:]
+		contentsCache.size -= len(contentsCache.contents[oldest])
+		delete(contentsCache.contents, oldest)
+	}
+
+	contentsCache.contents[key] = data
+	contentsCache.order = append(contentsCache.order, key)
+	contentsCache.size += len(data)
+}
+
+// uncacheFile drops the cached contents of file inode, in every db, before
+// they're changed
+func uncacheFile(inode int64) {
+	uncache(func(key cacheKey) bool {
+		return key.hash == "" && key.dataID == 0 && key.inode == inode
+	})
+}
+
+// uncacheSnapshotData drops the cached contents of snapshot_data rows in db,
+// whose ids are reused once they're removed
+func uncacheSnapshotData(db *sql.DB) {
+	uncache(func(key cacheKey) bool {
+		return key.db == db && key.dataID != 0
+	})
+}
+
+// uncache drops the cached contents whose keys match
+func uncache(match func(key cacheKey) bool) {
+	contentsCache.Lock()
+	defer contentsCache.Unlock()
+
+	order := contentsCache.order[:0]
+	for _, key := range contentsCache.order {
+		if !match(key) {
+			order = append(order, key)
+			continue
+		}
+
+		contentsCache.size -= len(contentsCache.contents[key])
+		delete(contentsCache.contents, key)
+	}
+	contentsCache.order = order
+}
+
+// CompressionStats describes how much compression saves
+type CompressionStats struct {
+	// Bytes is the size of file contents, counting deduplicated contents
+	// once, and StoredBytes the space they take up as stored
+	Bytes       int64
+	StoredBytes int64
+}
+
+// Ratio returns how many bytes of file contents there are per byte stored
+func (s CompressionStats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+
+	return float64(s.Bytes) / float64(s.StoredBytes)
+}
+
+// GetCompressionStats returns how much compression saves in the fs. Only the
+// live fs is counted, not snapshots or versions
+func GetCompressionStats(db *sql.DB) (CompressionStats, error) {
+	var stats CompressionStats
+
+	err := db.QueryRow(expandTables(
+		`select coalesce(sum(metadata.size), 0), coalesce(sum(length(filedata.data)), 0)
+        from {{filedata}} filedata
+        join {{metadata}} metadata on metadata.inode = filedata.inode
+        where filedata.hash is null`)).Scan(&stats.Bytes, &stats.StoredBytes)
+	if err != nil {
+		log.Println("Couldn't get filedata sizes!")
+		return stats, err
+	}
+
+	var chunkBytes, chunkStoredBytes int64
+	err = db.QueryRow(expandTables("select coalesce(sum(size), 0), coalesce(sum(length(data)), 0) from {{chunk}}")).
+		Scan(&chunkBytes, &chunkStoredBytes)
+	if err != nil {
+		log.Println("Couldn't get chunk sizes!")
+		return stats, err
+	}
+
+	stats.Bytes += chunkBytes
+	stats.StoredBytes += chunkStoredBytes
+
+	return stats, nil
+}
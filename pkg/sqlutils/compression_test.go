@@ -0,0 +1,104 @@
+package sqlutils
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// readParts reads size bytes of file inode a part at a time, returning them
+// and how many times contents were decompressed meanwhile
+func readParts(t *testing.T, backend SQLBackend, db *sql.DB, inode int64, size int) ([]byte, int64) {
+	t.Helper()
+	const partSize = 16 << 10
+
+	before := atomic.LoadInt64(&decompressions)
+
+	var data []byte
+	for offset := int64(0); offset < int64(size); offset += partSize {
+		part, err := backend.GetFileRangeForInode(db, inode, offset, partSize)
+		if err != nil {
+			t.Fatalf("Couldn't read file: %v", err)
+		}
+		data = append(data, part...)
+	}
+
+	return data, atomic.LoadInt64(&decompressions) - before
+}
+
+func TestReadCompressedRanges(t *testing.T) {
+	contents := bytes.Repeat([]byte("compressed "), 16<<10)
+
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetCompression(db, CompressionZstd); err != nil {
+				t.Fatalf("Couldn't set compression: %v", err)
+			}
+
+			inode, err := backend.CreateFileUnderInode(db, 1, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+
+			for _, written := range [][]byte{contents, bytes.ToUpper(contents)} {
+				if err = backend.SetFileContentsForInode(db, inode, written); err != nil {
+					t.Fatalf("Couldn't write file: %v", err)
+				}
+
+				data, n := readParts(t, backend, db, inode, len(written))
+				if !bytes.Equal(data, written) {
+					t.Errorf("read %d bytes, which differ from the %d written", len(data), len(written))
+				}
+				if n != 1 {
+					t.Errorf("reading the file in parts decompressed it %d times, expected once", n)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCompressedSnapshotRanges(t *testing.T) {
+	contents := bytes.Repeat([]byte("snapshotted "), 16<<10)
+
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetCompression(db, CompressionZstd); err != nil {
+				t.Fatalf("Couldn't set compression: %v", err)
+			}
+
+			inode, err := backend.CreateFileUnderInode(db, 1, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+			if err = backend.SetFileContentsForInode(db, inode, contents); err != nil {
+				t.Fatalf("Couldn't write file: %v", err)
+			}
+			if err = CreateSnapshot(db, "snapshot"); err != nil {
+				t.Fatalf("Couldn't create snapshot: %v", err)
+			}
+			snapshot := NewSnapshotBackend(backend, "snapshot")
+
+			// first still shared with the live file, then moved to
+			// snapshot_data by rewriting it
+			for _, rewrite := range []bool{false, true} {
+				if rewrite {
+					if err = backend.SetFileContentsForInode(db, inode, []byte("rewritten")); err != nil {
+						t.Fatalf("Couldn't write file: %v", err)
+					}
+				}
+
+				data, n := readParts(t, snapshot, db, inode, len(contents))
+				if !bytes.Equal(data, contents) {
+					t.Errorf("read %d bytes, which differ from the %d snapshotted", len(data), len(contents))
+				}
+				if n != 1 {
+					t.Errorf("reading the snapshot in parts decompressed it %d times, expected once", n)
+				}
+			}
+		})
+	}
+}
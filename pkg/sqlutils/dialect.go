@@ -0,0 +1,200 @@
+package sqlutils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// UpsertStyle is the syntax a database uses to update a row in place of
+// inserting a conflicting one
+type UpsertStyle int
+
+const (
+	// UpsertOnConflict is `insert ... on conflict (key) do update set ...`
+	// (sqlite, postgres)
+	UpsertOnConflict UpsertStyle = iota
+	// UpsertOnDuplicateKey is `insert ... on duplicate key update ...` (mysql)
+	UpsertOnDuplicateKey
+)
+
+// InodeAllocation is the way new inode numbers are generated
+type InodeAllocation int
+
+const (
+	// InodeFromMax uses one more than the largest inode in metadata, inside
+	// the transaction creating the inode
+	InodeFromMax InodeAllocation = iota
+	// InodeFromReturning lets the database generate the inode using the column
+	// default and reads it back with `returning inode`
+	InodeFromReturning
+	// InodeFromLastInsertID lets the database generate the inode using the
+	// column default and reads it back using LastInsertId
+	InodeFromLastInsertID
+)
+
+// Dialect describes the parts of SQL which differ between databases. The
+// queries shared by all backends consult the dialect registered for the
+// driver they run on
+type Dialect struct {
+	// Driver is the database/sql driver name. Each driver has one dialect
+	Driver string
+	// BindType is the placeholder style, one of sqlx.QUESTION, sqlx.DOLLAR,
+	// sqlx.NAMED or sqlx.AT
+	BindType int
+	// BlobType is the column type used to store file contents. Replaces
+	// {{blob}} in Tables
+	BlobType string
+	// Upsert is the syntax used to overwrite existing rows
+	Upsert UpsertStyle
+	// Inodes is the way new inode numbers are generated
+	Inodes InodeAllocation
+	// InodeDefault is the expression generating inodes as the column default,
+	// for InodeFromReturning. If set, bulk inserts use it to allocate inodes
+	// instead of max(inode)
+	InodeDefault string
+	// Schemas is set if tables can be placed in a schema (see SetSchema)
+	Schemas bool
+	// RetryTx is set if transactions failing with a serialization failure
+	// (SQLSTATE 40001) should be retried
+	RetryTx bool
+	// BlobConcat is the expression appending one blob to another, as a
+	// format taking both, e.g. "%s || %s". Defaults to ||
+	BlobConcat string
+	// SizeQuery returns the number of bytes the tables take up, e.g. for df.
+	// Table names are written as in Tables. Optional
+	SizeQuery string
+	// Limits are the limits of the database on what can be written.
+	// Optional
+	Limits Limits
+	// Tables is the script creating the tables. Table names are written as
+	// {{metadata}}, {{filedata}}, {{parent}} and so on (see newTableReplacer)
+	Tables string
+}
+
+// Limits describes how much a database can write at once, and the errors it
+// fails with when that, or the disk, runs out. Implementations have to be
+// comparable, like Dialect
+type Limits interface {
+	// MaxWriteSize returns the most bytes of file contents a single
+	// statement can write to db, 0 for no limit. Larger writes fail with
+	// EFBIG before anything is written
+	MaxWriteSize(db *sql.DB) (int64, error)
+	// Errno maps errors of the driver which have a matching errno, like a
+	// full disk, to it, and returns others as they are. Transactions failing
+	// with such errors return the errno
+	Errno(err error) error
+}
+
+// dialects maps driver names to their dialect
+var dialects = map[string]Dialect{}
+
+// fallbackDialect is used for drivers nobody registered a dialect for
+var fallbackDialect = Dialect{BindType: sql.QUESTION, BlobType: "blob"}
+
+// driverNamer is implemented by both sql.DB and sql.Tx
+type driverNamer interface {
+	DriverName() string
+}
+
+// dialectOf returns the dialect registered for the driver db uses
+func dialectOf(db driverNamer) Dialect {
+	if d, ok := dialects[db.DriverName()]; ok {
+		return d
+	}
+
+	return fallbackDialect
+}
+
+// createTablesScript returns d's table creation script with table names and
+// column types filled in
+func createTablesScript(d Dialect) string {
+	return expandTables(strings.ReplaceAll(d.Tables, "{{blob}}", d.BlobType))
+}
+
+// checkWriteSize returns EFBIG if size bytes of file contents are too large
+// to be written to db by a single statement
+func checkWriteSize(db *sql.DB, size int64) error {
+	limits := dialectOf(db).Limits
+	if limits == nil {
+		return nil
+	}
+
+	maxSize, err := limits.MaxWriteSize(db)
+	if err != nil {
+		return err
+	}
+
+	if maxSize > 0 && size > maxSize {
+		log.Printf("File contents (%d bytes) larger than can be written at once (%d bytes)\n", size, maxSize)
+		return fuse.Errno(syscall.EFBIG)
+	}
+
+	return nil
+}
+
+// blobConcat returns the expression appending value to blob in dialect d
+func blobConcat(d Dialect, blob, value string) string {
+	if d.BlobConcat == "" {
+		return blob + " || " + value
+	}
+
+	return fmt.Sprintf(d.BlobConcat, blob, value)
+}
+
+// upsert returns an insert into table for columns which overwrites the
+// non-key columns of the existing row if one with the same keys exists.
+// keys must have a unique constraint on them
+func upsert(d Dialect, table string, keys, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("insert into %s(%s) values (%s)",
+		table, strings.Join(columns, ", "), placeholders)
+
+	isKey := map[string]bool{}
+	for _, key := range keys {
+		isKey[key] = true
+	}
+
+	var updates []string
+	for _, column := range columns {
+		if isKey[column] {
+			continue
+		}
+
+		switch d.Upsert {
+		case UpsertOnDuplicateKey:
+			updates = append(updates, fmt.Sprintf("%s = values(%s)", column, column))
+		default:
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+		}
+	}
+
+	switch d.Upsert {
+	case UpsertOnDuplicateKey:
+		return query + " on duplicate key update " + strings.Join(updates, ", ")
+	default:
+		return query + fmt.Sprintf(" on conflict (%s) do update set ", strings.Join(keys, ", ")) +
+			strings.Join(updates, ", ")
+	}
+}
+
+// upsertIncrement returns a query inserting a row into table, like upsert,
+// except that an existing row with the same keys only gets 1 added to counter
+func upsertIncrement(d Dialect, table string, keys, columns []string, counter string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("insert into %s(%s) values (%s)",
+		table, strings.Join(columns, ", "), placeholders)
+
+	switch d.Upsert {
+	case UpsertOnDuplicateKey:
+		return query + fmt.Sprintf(" on duplicate key update %s = %s + 1", counter, counter)
+	default:
+		// a bare column is ambiguous with excluded on postgres
+		return query + fmt.Sprintf(" on conflict (%s) do update set %s = %s.%s + 1",
+			strings.Join(keys, ", "), counter, table, counter)
+	}
+}
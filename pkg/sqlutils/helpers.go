@@ -1,55 +1,90 @@
 package sqlutils
 
 import (
+	dbsql "database/sql"
 	"log"
-	"os"
+	"strings"
+	"syscall"
 	"time"
 
+	"bazil.org/fuse"
 	sql "github.com/jmoiron/sqlx"
 )
 
+// queryer is implemented by both sql.DB and sql.Tx
+type queryer interface {
+	binder
+	QueryRow(query string, args ...interface{}) *dbsql.Row
+}
+
 // getInodeFromNameUnderDir returns the inode of Dir/File under directory
 // referred by parentInode from db
-func getInodeFromNameUnderDir(db *sql.DB, parentInode int32, name string) (int32, error) {
+func getInodeFromNameUnderDir(db queryer, parentInode int64, name string) (int64, error) {
 	var childInode int64
-	err := db.QueryRow(db.Rebind(
+	err := db.QueryRow(rebind(db,
 		`select parent.inode
-            from parent
-            left join metadata on parent.inode = metadata.Inode
-            where pinode = ? and name = ?`),
+            from {{parent}} parent
+            left join {{metadata}} metadata on parent.inode = metadata.inode
+            where parent.pinode = ? and metadata.name = ?`),
 		parentInode, name).Scan(&childInode)
 	if err != nil {
-		log.Printf("Couldn't retrieve inode from name!\n")
+		if err != dbsql.ErrNoRows {
+			log.Printf("Couldn't retrieve inode from name!\n")
+		}
 		return 0, err
 	}
 
-	return int32(childInode), nil
+	return childInode, nil
 }
 
-// insertIntoMetadata creates a metadata tbale row given mode, type_ and name
-func insertIntoMetadata(tx *sql.Tx, mode, type_ int64, name string) (int32, error) {
+// insertIntoMetadata creates a metadata tbale row given mode, type_, name and
+// owner
+func insertIntoMetadata(tx *sql.Tx, mode, type_ int64, name string, uid, gid int64) (int64, error) {
 	var inode int64
-	// all backends don't provide LastInsertId
-	tx.QueryRow(tx.Rebind("select 1 + max(inode) from metadata")).Scan(&inode)
-
+	var err error
 	var currentTimeNs = time.Now().UnixNano()
-	_, err := tx.Exec(tx.Rebind(
-		`insert into
-            metadata(inode, uid,gid,mode,type,ctime,atime,mtime,name)
+
+	switch dialectOf(tx).Inodes {
+	case InodeFromReturning:
+		err = tx.QueryRow(rebind(tx,
+			`insert into
+            {{metadata}}(uid,gid,mode,type,ctime,atime,mtime,name)
+            values (?, ?, ?, ?, ?, ?, ?, ?) returning inode`),
+			uid, gid, mode, type_, currentTimeNs, currentTimeNs, currentTimeNs, name,
+		).Scan(&inode)
+	case InodeFromLastInsertID:
+		var res dbsql.Result
+		res, err = tx.Exec(rebind(tx,
+			`insert into
+            {{metadata}}(uid,gid,mode,type,ctime,atime,mtime,name)
+            values (?, ?, ?, ?, ?, ?, ?, ?)`),
+			uid, gid, mode, type_, currentTimeNs, currentTimeNs, currentTimeNs, name,
+		)
+		if err == nil {
+			inode, err = res.LastInsertId()
+		}
+	default:
+		// all backends don't provide LastInsertId
+		tx.QueryRow(rebind(tx, "select 1 + max(inode) from {{metadata}}")).Scan(&inode)
+
+		_, err = tx.Exec(rebind(tx,
+			`insert into
+            {{metadata}}(inode, uid,gid,mode,type,ctime,atime,mtime,name)
             values (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
-		inode, os.Getuid(), os.Getgid(), mode, type_, currentTimeNs, currentTimeNs, currentTimeNs, name,
-	)
+			inode, uid, gid, mode, type_, currentTimeNs, currentTimeNs, currentTimeNs, name,
+		)
+	}
 	if err != nil {
 		log.Printf("Couldn't insert metadata rows: %v\n", err)
 		return 0, err
 	}
 
-	return int32(inode), nil
+	return inode, nil
 }
 
 // insertIntoParent creates a parent table row given parentInode and childInode
 func insertIntoParent(tx *sql.Tx, parentInode, childInode int64) error {
-	_, err := tx.Exec(tx.Rebind("insert into parent values (?, ?)"), parentInode, childInode)
+	_, err := tx.Exec(rebind(tx, "insert into {{parent}} values (?, ?)"), parentInode, childInode)
 	if err != nil {
 		log.Println("Couldn't insert mkdir parent rows!")
 		return err
@@ -60,7 +95,7 @@ func insertIntoParent(tx *sql.Tx, parentInode, childInode int64) error {
 
 // removeFromMetadata removes row with inode from metadata table
 func removeFromMetadata(tx *sql.Tx, inode int64) error {
-	_, err := tx.Exec(tx.Rebind("delete from metadata where inode = ?"), inode)
+	_, err := tx.Exec(rebind(tx, "delete from {{metadata}} where inode = ?"), inode)
 	if err != nil {
 		log.Println("Couldn't remove file metadata rows!")
 		return err
@@ -72,9 +107,10 @@ func removeFromMetadata(tx *sql.Tx, inode int64) error {
 // removeFromParent removes row with parentInode,childInode from parent table
 //
 // NOTE: this should never actually be required since foreign key ON DELETE should
-//       take care of this
+//
+//	take care of this
 func removeFromParent(tx *sql.Tx, parentInode, childInode int64) error {
-	_, err := tx.Exec(tx.Rebind("delete from parent where pinode = ? and inode = ?"),
+	_, err := tx.Exec(rebind(tx, "delete from {{parent}} where pinode = ? and inode = ?"),
 		parentInode, childInode)
 	if err != nil {
 		log.Println("Couldn't remove parent rows!")
@@ -83,3 +119,130 @@ func removeFromParent(tx *sql.Tx, parentInode, childInode int64) error {
 
 	return nil
 }
+
+// isAncestor reports whether ancestor is inode or one of its parents
+func isAncestor(db queryer, ancestor, inode int64) (bool, error) {
+	for inode != ancestor {
+		if inode == 1 {
+			return false, nil
+		}
+
+		err := db.QueryRow(rebind(db, "select pinode from {{parent}} where inode = ?"), inode).Scan(&inode)
+		if err != nil {
+			log.Println("Couldn't retrieve parent inode!")
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// removeRenameTarget removes name from directory parentInode so that inode, of
+// type type_, can be moved there. Nothing is removed if name doesn't exist or
+// is inode itself. With the trash enabled the target goes there, keeping its
+// versions, otherwise its versions are given to inode
+func removeRenameTarget(tx *sql.Tx, parentInode int64, name string, inode, type_ int64) error {
+	target, err := getInodeFromNameUnderDir(tx, parentInode, name)
+	if err == dbsql.ErrNoRows || (err == nil && target == inode) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var targetType, nChildren int64
+	err = tx.QueryRow(rebind(tx, "select type from {{metadata}} where inode = ?"), target).Scan(&targetType)
+	if err != nil {
+		log.Println("Couldn't get metadata!")
+		return err
+	}
+	err = tx.QueryRow(rebind(tx, "select count(*) from {{parent}} where pinode = ?"), target).Scan(&nChildren)
+	if err != nil {
+		log.Println("Couldn't retrive children for inode!")
+		return err
+	}
+
+	switch {
+	case type_ == int64(fuse.DT_Dir) && targetType != int64(fuse.DT_Dir):
+		return fuse.Errno(syscall.ENOTDIR)
+	case type_ != int64(fuse.DT_Dir) && targetType == int64(fuse.DT_Dir):
+		return fuse.Errno(syscall.EISDIR)
+	case nChildren > 0:
+		return fuse.Errno(syscall.ENOTEMPTY)
+	}
+
+	if trashed, err := moveToTrash(tx, parentInode, target); err != nil || trashed {
+		return err
+	}
+
+	if targetType != int64(fuse.DT_Dir) {
+		if err := moveVersions(tx, target, inode); err != nil {
+			return err
+		}
+	}
+
+	if err := removeFromParent(tx, parentInode, target); err != nil {
+		return err
+	}
+
+	return deleteInode(tx, target)
+}
+
+// deleteInode removes the file or empty directory inode, which has already
+// been removed from parent, for good
+func deleteInode(tx *sql.Tx, inode int64) error {
+	if err := preserveSnapshotData(tx, inode); err != nil {
+		return err
+	}
+
+	// the inode may be reused, which shouldn't inherit the quota
+	if err := removeQuota(tx, QuotaProject, inode); err != nil {
+		return err
+	}
+
+	if err := releaseFileData(tx, inode); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"delete from {{filedata}} where inode = ?",
+		"delete from {{version}} where inode = ?",
+		"delete from {{trash}} where inode = ?",
+	} {
+		if _, err := tx.Exec(rebind(tx, query), inode); err != nil {
+			log.Println("Couldn't remove inode rows!")
+			return err
+		}
+	}
+
+	return removeFromMetadata(tx, inode)
+}
+
+// hasColumn reports whether table has column
+func hasColumn(db *sql.DB, table, column string) bool {
+	var one int64
+	err := db.QueryRow(expandTables("select 1 from {{" + table + "}} where " + column + " is null and 1 = 0")).Scan(&one)
+	return err == dbsql.ErrNoRows
+}
+
+// GetPathForInode returns the absolute path of inode in the fs
+func GetPathForInode(db *sql.DB, inode int64) (string, error) {
+	var names []string
+
+	for inode != 1 {
+		var name string
+		err := db.QueryRow(rebind(db,
+			`select parent.pinode, metadata.name
+            from {{parent}} parent
+            join {{metadata}} metadata on parent.inode = metadata.inode
+            where parent.inode = ?`), inode).Scan(&inode, &name)
+		if err != nil {
+			log.Println("Couldn't retrieve parent inode!")
+			return "", err
+		}
+
+		names = append([]string{name}, names...)
+	}
+
+	return "/" + strings.Join(names, "/"), nil
+}
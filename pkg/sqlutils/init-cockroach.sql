@@ -0,0 +1,126 @@
+create table if not exists {{metadata}} (
+    inode int8 primary key default unique_rowid(),
+
+    uid   int8 not null,
+    gid   int8 not null,
+
+    mode  int8 not null,
+    type  int8 not null,
+
+    ctime int8 not null,
+    atime int8 not null,
+    mtime int8 not null,
+
+    name  string not null,
+    size  int8 not null default 0
+);
+
+create table if not exists {{filedata}} (
+    inode  int8 unique not null,
+    data   {{blob}} default null,
+    hash   string default null,
+    compression string default null,
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{parent}} (
+    pinode int8 not null,
+    inode  int8 not null,
+
+    unique (pinode, inode),
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade,
+    foreign key(pinode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{quota}} (
+    kind       string not null,
+    id         int8 not null,
+
+    max_bytes  int8 not null default 0,
+    max_inodes int8 not null default 0,
+
+    primary key (kind, id)
+);
+
+create table if not exists {{snapshot}} (
+    id    int8 primary key,
+    name  string unique not null,
+    ctime int8 not null
+);
+
+create table if not exists {{snapshot_metadata}} (
+    snapshot int8 not null,
+    inode    int8 not null,
+
+    uid      int8 not null,
+    gid      int8 not null,
+
+    mode     int8 not null,
+    type     int8 not null,
+
+    ctime    int8 not null,
+    atime    int8 not null,
+    mtime    int8 not null,
+
+    name     string not null,
+    size     int8 not null default 0,
+
+    data_id  int8 default null,
+
+    primary key (inode, snapshot),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_parent}} (
+    snapshot int8 not null,
+    pinode   int8 not null,
+    inode    int8 not null,
+
+    primary key (snapshot, pinode, inode),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_data}} (
+    id   int8 primary key,
+    refs int8 not null,
+    data {{blob}} default null,
+    compression string default null
+);
+
+create table if not exists {{version}} (
+    inode int8 not null,
+    mtime int8 not null,
+    ctime int8 not null,
+    size  int8 not null,
+    data  {{blob}} default null,
+    compression string default null,
+
+    primary key (inode, mtime),
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{setting}} (
+    name  string primary key,
+    value string not null
+);
+
+create table if not exists {{trash}} (
+    inode  int8 primary key,
+    pinode int8 not null,
+    dtime  int8 not null,
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{chunk}} (
+    hash string primary key,
+    refs int8 not null,
+    size int8 not null,
+    data {{blob}} default null,
+    compression string default null
+);
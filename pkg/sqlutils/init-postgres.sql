@@ -1,5 +1,5 @@
-create table if not exists metadata (
-    inode serial primary key,
+create table if not exists {{metadata}} (
+    inode bigserial primary key,
 
     uid   bigint not null,
     gid   bigint not null,
@@ -15,19 +15,112 @@ create table if not exists metadata (
     size  bigint not null default 0
 );
 
-create table if not exists filedata (
+create table if not exists {{filedata}} (
     inode  bigint unique not null,
-    data   bytea  default null,
+    data   {{blob}} default null,
+    hash   varchar(64) default null,
+    compression varchar(8) default null,
 
-    foreign key(inode) references metadata(inode) on delete cascade
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
 );
 
-create table if not exists parent (
+create table if not exists {{parent}} (
     pinode bigint not null,
     inode  bigint not null,
 
     unique (pinode, inode),
 
-    foreign key(inode) references metadata(inode) on delete cascade,
-    foreign key(pinode) references metadata(inode) on delete cascade
+    foreign key(inode) references {{metadata}}(inode) on delete cascade,
+    foreign key(pinode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{quota}} (
+    kind       varchar(16) not null,
+    id         bigint not null,
+
+    max_bytes  bigint not null default 0,
+    max_inodes bigint not null default 0,
+
+    primary key (kind, id)
+);
+
+create table if not exists {{snapshot}} (
+    id    bigint primary key,
+    name  text unique not null,
+    ctime bigint not null
+);
+
+create table if not exists {{snapshot_metadata}} (
+    snapshot bigint not null,
+    inode    bigint not null,
+
+    uid      bigint not null,
+    gid      bigint not null,
+
+    mode     bigint not null,
+    type     bigint not null,
+
+    ctime    bigint not null,
+    atime    bigint not null,
+    mtime    bigint not null,
+
+    name     text not null,
+    size     bigint not null default 0,
+
+    data_id  bigint default null,
+
+    primary key (inode, snapshot),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_parent}} (
+    snapshot bigint not null,
+    pinode   bigint not null,
+    inode    bigint not null,
+
+    primary key (snapshot, pinode, inode),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_data}} (
+    id   bigint primary key,
+    refs bigint not null,
+    data {{blob}} default null,
+    compression varchar(8) default null
+);
+
+create table if not exists {{version}} (
+    inode bigint not null,
+    mtime bigint not null,
+    ctime bigint not null,
+    size  bigint not null,
+    data  {{blob}} default null,
+    compression varchar(8) default null,
+
+    primary key (inode, mtime),
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{setting}} (
+    name  text primary key,
+    value text not null
+);
+
+create table if not exists {{trash}} (
+    inode  bigint primary key,
+    pinode bigint not null,
+    dtime  bigint not null,
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{chunk}} (
+    hash varchar(64) primary key,
+    refs bigint not null,
+    size bigint not null,
+    data {{blob}} default null,
+    compression varchar(8) default null
 );
@@ -1,6 +1,6 @@
 pragma foreign_keys=on;
 
-create table if not exists metadata (
+create table if not exists {{metadata}} (
     inode integer primary key autoincrement,
 
     uid   integer not null,
@@ -17,19 +17,112 @@ create table if not exists metadata (
     size  integer not null default 0
 );
 
-create table if not exists filedata (
+create table if not exists {{filedata}} (
     inode  integer unique not null,
-    data   blob    default null,
+    data   {{blob}} default null,
+    hash   text default null,
+    compression text default null,
 
-    foreign key(inode) references metadata(inode) on delete cascade
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
 );
 
-create table if not exists parent (
+create table if not exists {{parent}} (
     pinode integer not null,
     inode  integer not null,
 
     unique (pinode, inode),
 
-    foreign key(inode) references metadata(inode) on delete cascade,
-    foreign key(pinode) references metadata(inode) on delete cascade
+    foreign key(inode) references {{metadata}}(inode) on delete cascade,
+    foreign key(pinode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{quota}} (
+    kind       text not null,
+    id         integer not null,
+
+    max_bytes  integer not null default 0,
+    max_inodes integer not null default 0,
+
+    primary key (kind, id)
+);
+
+create table if not exists {{snapshot}} (
+    id    integer primary key,
+    name  text unique not null,
+    ctime integer not null
+);
+
+create table if not exists {{snapshot_metadata}} (
+    snapshot integer not null,
+    inode    integer not null,
+
+    uid      integer not null,
+    gid      integer not null,
+
+    mode     integer not null,
+    type     integer not null,
+
+    ctime    integer not null,
+    atime    integer not null,
+    mtime    integer not null,
+
+    name     text not null,
+    size     integer not null default 0,
+
+    data_id  integer default null,
+
+    primary key (inode, snapshot),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_parent}} (
+    snapshot integer not null,
+    pinode   integer not null,
+    inode    integer not null,
+
+    primary key (snapshot, pinode, inode),
+
+    foreign key(snapshot) references {{snapshot}}(id) on delete cascade
+);
+
+create table if not exists {{snapshot_data}} (
+    id   integer primary key,
+    refs integer not null,
+    data {{blob}} default null,
+    compression text default null
+);
+
+create table if not exists {{version}} (
+    inode integer not null,
+    mtime integer not null,
+    ctime integer not null,
+    size  integer not null,
+    data  {{blob}} default null,
+    compression text default null,
+
+    primary key (inode, mtime),
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{setting}} (
+    name  text primary key,
+    value text not null
+);
+
+create table if not exists {{trash}} (
+    inode  integer primary key,
+    pinode integer not null,
+    dtime  integer not null,
+
+    foreign key(inode) references {{metadata}}(inode) on delete cascade
+);
+
+create table if not exists {{chunk}} (
+    hash text primary key,
+    refs integer not null,
+    size integer not null,
+    data {{blob}} default null,
+    compression text default null
 );
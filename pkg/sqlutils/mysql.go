@@ -2,11 +2,15 @@ package sqlutils
 
 import (
 	_ "embed"
+	"errors"
 	"log"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"bazil.org/fuse"
+	"github.com/go-sql-driver/mysql"
 	sql "github.com/jmoiron/sqlx"
 )
 
@@ -17,6 +21,34 @@ var _ SQLBackend = (*MySQLBackend)(nil)
 //go:embed init-mysql.sql
 var createTableMySql string
 
+var mysqlDialect = Dialect{
+	Driver:   "mysql",
+	BindType: sql.QUESTION,
+	BlobType: "longblob",
+	Upsert:   UpsertOnDuplicateKey,
+	Inodes:   InodeFromMax,
+	Tables:   createTableMySql,
+	// || is a logical or
+	BlobConcat: "concat(%s, %s)",
+	Limits:     mysqlLimits{},
+	SizeQuery: `select coalesce(sum(data_length + index_length), 0)
+        from information_schema.tables
+        where table_schema = database() and table_name in (
+            '{{metadata}}', '{{filedata}}', '{{parent}}', '{{quota}}',
+            '{{snapshot}}', '{{snapshot_metadata}}', '{{snapshot_parent}}', '{{snapshot_data}}',
+            '{{version}}', '{{setting}}', '{{trash}}', '{{chunk}}'
+        )`,
+}
+
+func init() {
+	Register("mysql", MySQLBackend{})
+}
+
+// Dialect returns the mysql dialect
+func (m MySQLBackend) Dialect() Dialect {
+	return mysqlDialect
+}
+
 // OpenDB enables multiStatements and connects to dsn
 func (m MySQLBackend) OpenDB(dsn string) (*sql.DB, error) {
 	var querySep string
@@ -29,7 +61,13 @@ func (m MySQLBackend) OpenDB(dsn string) (*sql.DB, error) {
 		querySep = "?"
 	}
 
-	db, err := sql.Open("mysql", dsn+querySep+"multiStatements=true")
+	options := "multiStatements=true"
+	if !strings.Contains(dsn, "maxAllowedPacket=") {
+		// use the server's max_allowed_packet instead of the driver's 4MiB
+		options += "&maxAllowedPacket=0"
+	}
+
+	db, err := sql.Open("mysql", dsn+querySep+options)
 	if err != nil {
 		return nil, err
 	}
@@ -41,13 +79,136 @@ func (m MySQLBackend) OpenDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-// CreateDBTables creates db tables using sql file
+// CreateDBTables creates db tables using sql file. Tables created by older
+// versions stored file contents as blob, which is limited to 64KiB, so those
+// are converted to longblob. Converting rebuilds the table, so it's only done
+// when the column isn't a longblob already
 func (m MySQLBackend) CreateDBTables(db *sql.DB) error {
-	_, err := db.Exec(createTableMySql)
+	if err := m.defaultBackend.CreateDBTables(db); err != nil {
+		return err
+	}
+
+	var dataType string
+	err := db.QueryRow(expandTables(
+		`select data_type from information_schema.columns
+        where table_schema = database() and table_name = '{{filedata}}' and column_name = 'data'`)).Scan(&dataType)
+	if err != nil {
+		log.Println("Couldn't get filedata column type!")
+		return err
+	}
+	if strings.EqualFold(dataType, "longblob") {
+		return nil
+	}
+
+	_, err = db.Exec(expandTables("alter table {{filedata}} modify data longblob default null"))
 	if err != nil {
-		log.Println("Couldn't write initial tables!")
+		log.Println("Couldn't convert filedata to longblob!")
 		return err
 	}
 
 	return nil
 }
+
+// packetOverhead is room left in a packet for the rest of the query
+const packetOverhead = 1024
+
+// maxAllowedPackets caches max_allowed_packet per db, so that writes don't
+// each ask the server for it
+var maxAllowedPackets sync.Map
+
+// mysqlLimits are the limits of mysql: file contents are sent to the server
+// in a single packet, of at most max_allowed_packet bytes
+type mysqlLimits struct{}
+
+// MaxWriteSize returns the most bytes of file contents which fit in a packet
+// with the rest of the query
+func (mysqlLimits) MaxWriteSize(db *sql.DB) (int64, error) {
+	if maxAllowedPacket, ok := maxAllowedPackets.Load(db); ok {
+		return maxAllowedPacket.(int64) - packetOverhead, nil
+	}
+
+	var maxAllowedPacket int64
+	err := db.QueryRow("select @@max_allowed_packet").Scan(&maxAllowedPacket)
+	if err != nil {
+		log.Println("Couldn't get max_allowed_packet!")
+		return 0, err
+	}
+
+	maxAllowedPackets.Store(db, maxAllowedPacket)
+	return maxAllowedPacket - packetOverhead, nil
+}
+
+// Errno maps mysql errors about sizes to the corresponding errno
+func (mysqlLimits) Errno(err error) error {
+	return mysqlErrno(err)
+}
+
+// mysqlErrno maps mysql errors about sizes to the corresponding errno: EFBIG
+// for contents larger than a packet, and ENOSPC for a full disk or table
+func mysqlErrno(err error) error {
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.Is(err, mysql.ErrPktTooLarge):
+		return fuse.Errno(syscall.EFBIG)
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case 1153: // ER_NET_PACKET_TOO_LARGE
+			return fuse.Errno(syscall.EFBIG)
+		case 1021, 1114: // ER_DISK_FULL, ER_RECORD_FILE_FULL
+			return fuse.Errno(syscall.ENOSPC)
+		}
+	}
+
+	return err
+}
+
+// maxPlaceholders is the maximum number of placeholders in a prepared statement
+const maxPlaceholders = 65535
+
+// BulkInsert inserts rows into table using multi-row inserts, each of which
+// fits in max_allowed_packet
+func (m MySQLBackend) BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	var maxAllowedPacket int64
+	err := tx.QueryRow("select @@max_allowed_packet").Scan(&maxAllowedPacket)
+	if err != nil {
+		log.Println("Couldn't get max_allowed_packet!")
+		return err
+	}
+
+	for len(rows) > 0 {
+		var n int
+		size := int64(packetOverhead)
+		for n < len(rows) && (n+1)*len(columns) <= maxPlaceholders {
+			rowSize := int64(len(columns)) * 32
+			for _, value := range rows[n] {
+				if data, ok := value.([]byte); ok {
+					rowSize += int64(len(data))
+				}
+			}
+
+			if n > 0 && size+rowSize > maxAllowedPacket {
+				break
+			}
+			size += rowSize
+			n++
+		}
+
+		if size > maxAllowedPacket {
+			log.Printf("Row (%d bytes) larger than max_allowed_packet (%d bytes)\n", size, maxAllowedPacket)
+			return fuse.Errno(syscall.EFBIG)
+		}
+
+		var args []interface{}
+		for _, row := range rows[:n] {
+			args = append(args, row...)
+		}
+
+		if _, err := tx.Exec(insertQuery(table, columns, n), args...); err != nil {
+			return mysqlErrno(err)
+		}
+
+		rows = rows[n:]
+	}
+
+	return nil
+}
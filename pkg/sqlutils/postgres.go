@@ -3,30 +3,175 @@ package sqlutils
 import (
 	_ "embed"
 	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
 
 	sql "github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresBackend struct{ defaultBackend }
 
-var _ SQLBackend = (*MySQLBackend)(nil)
+var _ SQLBackend = (*PostgresBackend)(nil)
 
 //go:embed init-postgres.sql
 var createTablePostgres string
 
-// OpenDB connects to dsn
+var postgresDialect = Dialect{
+	Driver:   "postgres",
+	BindType: sql.DOLLAR,
+	BlobType: "bytea",
+	Upsert:   UpsertOnConflict,
+	Inodes:   InodeFromMax,
+	Schemas:  true,
+	Tables:   createTablePostgres,
+	SizeQuery: `select pg_total_relation_size('{{metadata}}') +
+        pg_total_relation_size('{{filedata}}') +
+        pg_total_relation_size('{{parent}}') +
+        pg_total_relation_size('{{quota}}') +
+        pg_total_relation_size('{{snapshot}}') +
+        pg_total_relation_size('{{snapshot_metadata}}') +
+        pg_total_relation_size('{{snapshot_parent}}') +
+        pg_total_relation_size('{{snapshot_data}}') +
+        pg_total_relation_size('{{version}}') +
+        pg_total_relation_size('{{setting}}') +
+        pg_total_relation_size('{{trash}}') +
+        pg_total_relation_size('{{chunk}}')`,
+}
+
+func init() {
+	Register("postgres", PostgresBackend{})
+	Register("postgresql", PostgresBackend{})
+}
+
+// Dialect returns the postgres dialect
+func (p PostgresBackend) Dialect() Dialect {
+	return postgresDialect
+}
+
+// OpenDB connects to dsn, which is either a libpq URL without the scheme or a
+// keyword/value connection string
 func (p PostgresBackend) OpenDB(dsn string) (*sql.DB, error) {
-	return sql.Open("postgres", "postgres://"+dsn+"?sslmode=disable")
+	connStr, err := postgresConnString(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.Open("postgres", connStr)
 }
 
-// CreateDBTables creates db tables using sql file
+// CreateDBTables creates db tables using sql file. Tables created by older
+// versions had 32 bit inodes, which can't hold those of a fs copied from
+// cockroach, so those are widened to bigint. Widening rewrites the table, so
+// it's only done when the column is still an integer
 func (p PostgresBackend) CreateDBTables(db *sql.DB) error {
-	_, err := db.Exec(createTablePostgres)
+	if err := p.defaultBackend.CreateDBTables(db); err != nil {
+		return err
+	}
+
+	var dataType string
+	err := db.QueryRow(rebind(db,
+		`select data_type from information_schema.columns
+        where table_schema = coalesce(nullif(?, ''), current_schema()) and table_name = ? and column_name = 'inode'`),
+		strings.ToLower(tableSchema), strings.ToLower(tablePrefix+"metadata")).Scan(&dataType)
 	if err != nil {
-		log.Println("Couldn't write initial tables!")
+		log.Println("Couldn't get metadata column type!")
+		return err
+	}
+	if dataType == "bigint" {
+		return nil
+	}
+
+	_, err = db.Exec(expandTables("alter table {{metadata}} alter column inode type bigint"))
+	if err != nil {
+		log.Println("Couldn't convert metadata inodes to bigint!")
 		return err
 	}
 
 	return nil
 }
+
+// keywordDSN matches keyword/value connection strings like "host=/tmp dbname=sqlfs"
+var keywordDSN = regexp.MustCompile(`^\s*[A-Za-z_]+\s*=`)
+
+// keywordParam matches the keywords set in a keyword/value connection string
+var keywordParam = regexp.MustCompile(`(?:^|\s)([A-Za-z_]+)\s*=`)
+
+// postgresConnString turns dsn into a connection string for lib/pq. Unset
+// connection parameters are taken from the standard PG* environment variables
+// (and PGPASSFILE) by lib/pq itself. On top of that:
+//
+//   - sslmode defaults to disable unless given in dsn or PGSSLMODE
+//   - application_name defaults to sqlfs
+func postgresConnString(dsn string) (string, error) {
+	defaults := [][2]string{{"fallback_application_name", "sqlfs"}}
+	if os.Getenv("PGSSLMODE") == "" {
+		defaults = append(defaults, [2]string{"sslmode", "disable"})
+	}
+
+	// an empty dsn means everything comes from the environment
+	if strings.TrimSpace(dsn) == "" || keywordDSN.MatchString(dsn) {
+		set := map[string]bool{}
+		for _, match := range keywordParam.FindAllStringSubmatch(dsn, -1) {
+			set[match[1]] = true
+		}
+
+		for _, kv := range defaults {
+			if !set[kv[0]] {
+				dsn = strings.TrimSpace(dsn + " " + kv[0] + "=" + kv[1])
+			}
+		}
+
+		return dsn, nil
+	}
+
+	connURL, err := url.Parse("postgres://" + dsn)
+	if err != nil {
+		return "", err
+	}
+
+	query := connURL.Query()
+	for _, kv := range defaults {
+		if !query.Has(kv[0]) {
+			query.Set(kv[0], kv[1])
+		}
+	}
+	connURL.RawQuery = query.Encode()
+
+	return connURL.String(), nil
+}
+
+// BulkInsert inserts rows into table using COPY
+func (p PostgresBackend) BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	// COPY quotes identifiers, while the unquoted ones in the DDL are folded to lower case
+	name := strings.ToLower(tablePrefix + table)
+
+	var copyQuery string
+	if tableSchema != "" {
+		copyQuery = pq.CopyInSchema(strings.ToLower(tableSchema), name, columns...)
+	} else {
+		copyQuery = pq.CopyIn(name, columns...)
+	}
+
+	stmt, err := tx.Prepare(copyQuery)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// flush the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+
+	return stmt.Close()
+}
@@ -0,0 +1,262 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// QuotaKind is what a quota limits
+type QuotaKind string
+
+const (
+	// QuotaUser limits the files owned by the uid in Quota.ID
+	QuotaUser QuotaKind = "user"
+	// QuotaGroup limits the files owned by the gid in Quota.ID
+	QuotaGroup QuotaKind = "group"
+	// QuotaProject limits the directory tree under the inode in Quota.ID,
+	// including the directory itself
+	QuotaProject QuotaKind = "project"
+)
+
+// Quota limits the bytes and inodes of a user, group or project. A limit of 0
+// means no limit
+type Quota struct {
+	Kind QuotaKind `db:"kind"`
+	ID   int64     `db:"id"`
+
+	MaxBytes  int64 `db:"max_bytes"`
+	MaxInodes int64 `db:"max_inodes"`
+}
+
+// QuotaUsage is a quota along with what's currently used of it
+type QuotaUsage struct {
+	Quota
+
+	Bytes  int64
+	Inodes int64
+}
+
+// errQuota is returned by changes which would go over a quota
+var errQuota = fuse.Errno(syscall.EDQUOT)
+
+// SetQuota sets the limits of quota.Kind and quota.ID. Setting both limits
+// to 0 removes the quota
+func SetQuota(db *sql.DB, quota Quota) error {
+	switch quota.Kind {
+	case QuotaUser, QuotaGroup, QuotaProject:
+	default:
+		return fmt.Errorf("unknown quota kind `%s`", quota.Kind)
+	}
+
+	return runInTx(db, "quota update", func(tx *sql.Tx) error {
+		if quota.MaxBytes == 0 && quota.MaxInodes == 0 {
+			return removeQuota(tx, quota.Kind, quota.ID)
+		}
+
+		_, err := tx.Exec(rebind(tx, upsert(dialectOf(tx), "{{quota}}", []string{"kind", "id"},
+			[]string{"kind", "id", "max_bytes", "max_inodes"})),
+			quota.Kind, quota.ID, quota.MaxBytes, quota.MaxInodes)
+		if err != nil {
+			log.Println("Couldn't update quota row!")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// GetQuota returns the limits and usage of kind and id. Usage is reported
+// even if there's no quota, with both limits 0
+func GetQuota(db *sql.DB, kind QuotaKind, id int64) (QuotaUsage, error) {
+	usage := QuotaUsage{Quota: Quota{Kind: kind, ID: id}}
+
+	err := db.QueryRowx(rebind(db,
+		"select kind, id, max_bytes, max_inodes from {{quota}} where kind = ? and id = ?"), kind, id,
+	).StructScan(&usage.Quota)
+	if err != nil && err != dbsql.ErrNoRows {
+		log.Println("Couldn't get quota!")
+		return usage, err
+	}
+
+	usage.Bytes, usage.Inodes, err = quotaUsage(db, kind, id)
+	return usage, err
+}
+
+// GetQuotas returns all quotas along with their usage
+func GetQuotas(db *sql.DB) ([]QuotaUsage, error) {
+	var quotas []Quota
+	err := db.Select(&quotas, expandTables(
+		"select kind, id, max_bytes, max_inodes from {{quota}} order by kind, id"))
+	if err != nil {
+		log.Println("Couldn't get quotas!")
+		return nil, err
+	}
+
+	var usages []QuotaUsage
+	for _, quota := range quotas {
+		usage := QuotaUsage{Quota: quota}
+		usage.Bytes, usage.Inodes, err = quotaUsage(db, quota.Kind, quota.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, usage)
+	}
+
+	return usages, nil
+}
+
+// quotaUsage returns the bytes and inodes counted against kind and id
+func quotaUsage(db queryer, kind QuotaKind, id int64) (int64, int64, error) {
+	var query string
+	switch kind {
+	case QuotaUser:
+		query = "select coalesce(sum(size), 0), count(*) from {{metadata}} where uid = ?"
+	case QuotaGroup:
+		query = "select coalesce(sum(size), 0), count(*) from {{metadata}} where gid = ?"
+	case QuotaProject:
+		query = `with recursive tree(inode) as (
+                select inode from {{metadata}} where inode = ?
+                union all
+                select parent.inode from {{parent}} parent join tree on parent.pinode = tree.inode
+            )
+            select coalesce(sum(metadata.size), 0), count(*)
+            from tree join {{metadata}} metadata on metadata.inode = tree.inode`
+	default:
+		return 0, 0, fmt.Errorf("unknown quota kind `%s`", kind)
+	}
+
+	var bytes, inodes int64
+	if err := db.QueryRow(rebind(db, query), id).Scan(&bytes, &inodes); err != nil {
+		log.Println("Couldn't get quota usage!")
+		return 0, 0, err
+	}
+
+	return bytes, inodes, nil
+}
+
+// checkQuota returns EDQUOT if inode, which was just created or grew, puts its
+// owner, group or a directory tree it's in over a quota. Only the limits on
+// what grew are checked, so files over quota can still be shrunk.
+//
+// Call it after the change, inside the same transaction, so that the usage
+// includes it
+func checkQuota(tx *sql.Tx, inode int64, grewBytes, grewInodes bool) error {
+	if !grewBytes && !grewInodes {
+		return nil
+	}
+
+	var uid, gid int64
+	err := tx.QueryRow(rebind(tx, "select uid, gid from {{metadata}} where inode = ?"), inode).Scan(&uid, &gid)
+	if err != nil {
+		log.Println("Couldn't get metadata!")
+		return err
+	}
+
+	return checkQuotas(tx, map[int64]bool{uid: true}, map[int64]bool{gid: true}, []int64{inode}, grewBytes, grewInodes)
+}
+
+// checkQuotas is checkQuota for changes to many inodes, owned by uids and gids.
+//
+// Usage is only summed for quotas which apply to the change and have a limit
+// on what grew. Directories above inodes are only looked up if there's such a
+// project quota, and the tree of a project is only walked if it contains one
+// of inodes, so without quotas a change costs a single query
+func checkQuotas(tx *sql.Tx, uids, gids map[int64]bool, inodes []int64, grewBytes, grewInodes bool) error {
+	var limits []string
+	if grewBytes {
+		limits = append(limits, "max_bytes > 0")
+	}
+	if grewInodes {
+		limits = append(limits, "max_inodes > 0")
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	var quotas []Quota
+	err := tx.Select(&quotas, expandTables(
+		"select kind, id, max_bytes, max_inodes from {{quota}} where "+strings.Join(limits, " or ")))
+	if err != nil {
+		log.Println("Couldn't get quotas!")
+		return err
+	}
+
+	var ancestors map[int64]bool
+	for _, quota := range quotas {
+		switch quota.Kind {
+		case QuotaUser:
+			if !uids[quota.ID] {
+				continue
+			}
+		case QuotaGroup:
+			if !gids[quota.ID] {
+				continue
+			}
+		case QuotaProject:
+			if ancestors == nil {
+				if ancestors, err = getAncestors(tx, inodes); err != nil {
+					return err
+				}
+			}
+			if !ancestors[quota.ID] {
+				continue
+			}
+		}
+
+		usedBytes, usedInodes, err := quotaUsage(tx, quota.Kind, quota.ID)
+		if err != nil {
+			return err
+		}
+
+		checkBytes := grewBytes && quota.MaxBytes > 0
+		checkInodes := grewInodes && quota.MaxInodes > 0
+		if (checkBytes && usedBytes > quota.MaxBytes) || (checkInodes && usedInodes > quota.MaxInodes) {
+			log.Printf("Over %s quota of %d: %d/%d bytes, %d/%d inodes\n",
+				quota.Kind, quota.ID, usedBytes, quota.MaxBytes, usedInodes, quota.MaxInodes)
+			return errQuota
+		}
+	}
+
+	return nil
+}
+
+// getAncestors returns inodes and all the directories above them
+func getAncestors(db queryer, inodes []int64) (map[int64]bool, error) {
+	ancestors := map[int64]bool{}
+
+	for _, inode := range inodes {
+		// the directories above one which was seen already are known
+		for !ancestors[inode] {
+			ancestors[inode] = true
+			if inode == 1 {
+				break
+			}
+
+			err := db.QueryRow(rebind(db, "select pinode from {{parent}} where inode = ?"), inode).Scan(&inode)
+			if err != nil {
+				log.Println("Couldn't retrieve parent inode!")
+				return nil, err
+			}
+		}
+	}
+
+	return ancestors, nil
+}
+
+// removeQuota removes the quota of kind and id, if there is one
+func removeQuota(tx *sql.Tx, kind QuotaKind, id int64) error {
+	_, err := tx.Exec(rebind(tx, "delete from {{quota}} where kind = ? and id = ?"), kind, id)
+	if err != nil {
+		log.Println("Couldn't remove quota rows!")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package sqlutils
+
+import (
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestCheckQuota(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+
+			project, err := backend.CreateDirUnderInode(db, 1, "project", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create dir: %v", err)
+			}
+			if err = SetQuota(db, Quota{Kind: QuotaProject, ID: project, MaxBytes: 100}); err != nil {
+				t.Fatalf("Couldn't set quota: %v", err)
+			}
+			if err = SetQuota(db, Quota{Kind: QuotaUser, ID: 1001, MaxInodes: 1}); err != nil {
+				t.Fatalf("Couldn't set quota: %v", err)
+			}
+
+			inode, err := backend.CreateFileUnderInode(db, project, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+			if err = backend.SetFileContentsForInode(db, inode, make([]byte, 100)); err != nil {
+				t.Fatalf("Couldn't write file under quota: %v", err)
+			}
+			if err = backend.SetFileContentsForInode(db, inode, make([]byte, 101)); err != errQuota {
+				t.Errorf("Expected EDQUOT growing a file over quota, got %v", err)
+			}
+
+			// outside the project
+			outside, err := backend.CreateFileUnderInode(db, 1, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+			if err = backend.SetFileContentsForInode(db, outside, make([]byte, 1000)); err != nil {
+				t.Errorf("Couldn't write file outside the project: %v", err)
+			}
+
+			if _, err = backend.CreateFileUnderInode(db, 1, "first", 1001, 1001); err != nil {
+				t.Fatalf("Couldn't create file under quota: %v", err)
+			}
+			if _, err = backend.CreateFileUnderInode(db, 1, "second", 1001, 1001); err != errQuota {
+				t.Errorf("Expected EDQUOT creating a file over quota, got %v", err)
+			}
+			if _, err = backend.CreateFileUnderInode(db, 1, "second", 1002, 1002); err != nil {
+				t.Errorf("Couldn't create file as another user: %v", err)
+			}
+		})
+	}
+}
+
+func TestInsertEntriesQuota(t *testing.T) {
+	dir := func(inode, parent int64, name string) Entry {
+		return Entry{Metadata: Metadata{Inode: inode, Mode: 0755, Type: int64(fuse.DT_Dir), Name: name}, Parent: parent}
+	}
+	file := func(inode, parent int64, name string, size int) Entry {
+		return Entry{
+			Metadata: Metadata{Inode: inode, Mode: 0644, Type: int64(fuse.DT_File), Name: name, Size: int64(size)},
+			Parent:   parent,
+			Data:     make([]byte, size),
+		}
+	}
+
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+
+			project, err := backend.CreateDirUnderInode(db, 1, "project", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create dir: %v", err)
+			}
+			if err = SetQuota(db, Quota{Kind: QuotaProject, ID: project, MaxBytes: 100, MaxInodes: 4}); err != nil {
+				t.Fatalf("Couldn't set quota: %v", err)
+			}
+
+			_, err = InsertEntries(backend, db, []Entry{
+				dir(-1, project, "dir"), file(-2, -1, "a", 60), file(-3, -1, "b", 60),
+			})
+			if err != errQuota {
+				t.Errorf("Expected EDQUOT inserting entries over the bytes quota, got %v", err)
+			}
+			_, err = InsertEntries(backend, db, []Entry{
+				dir(-1, project, "dir"), file(-2, -1, "a", 10), file(-3, -1, "b", 10), file(-4, -1, "c", 10),
+			})
+			if err != errQuota {
+				t.Errorf("Expected EDQUOT inserting entries over the inodes quota, got %v", err)
+			}
+			if _, err = backend.GetInodeForNameUnderInode(db, project, "dir"); err == nil {
+				t.Errorf("Entries over quota were inserted")
+			}
+
+			_, err = InsertEntries(backend, db, []Entry{
+				dir(-1, project, "dir"), file(-2, -1, "a", 60), file(-3, 1, "b", 60),
+			})
+			if err != nil {
+				t.Errorf("Couldn't insert entries under quota: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetMetadataQuota(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+
+			project, err := backend.CreateDirUnderInode(db, 1, "project", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create dir: %v", err)
+			}
+			for _, quota := range []Quota{
+				{Kind: QuotaProject, ID: project, MaxBytes: 100},
+				{Kind: QuotaUser, ID: 1001, MaxBytes: 10},
+				{Kind: QuotaGroup, ID: 1001, MaxInodes: 1},
+			} {
+				if err = SetQuota(db, quota); err != nil {
+					t.Fatalf("Couldn't set quota: %v", err)
+				}
+			}
+
+			// setattr changes the metadata of inode, as Setattr does
+			setattr := func(inode int64, change func(*Metadata)) error {
+				t.Helper()
+
+				metadata, err := backend.GetMetadataForInode(db, inode)
+				if err != nil {
+					t.Fatalf("Couldn't get metadata: %v", err)
+				}
+				change(&metadata)
+				return backend.SetMetadataForInode(db, inode, metadata)
+			}
+
+			inodes := map[string]int64{}
+			for _, file := range []struct {
+				parent int64
+				name   string
+			}{{project, "file"}, {1, "other"}} {
+				inode, err := backend.CreateFileUnderInode(db, file.parent, file.name, 0, 0)
+				if err != nil {
+					t.Fatalf("Couldn't create file: %v", err)
+				}
+				inodes[file.name] = inode
+			}
+
+			// truncating to a larger size
+			if err = setattr(inodes["file"], func(m *Metadata) { m.Size = 100 }); err != nil {
+				t.Fatalf("Couldn't grow file under quota: %v", err)
+			}
+			if err = setattr(inodes["file"], func(m *Metadata) { m.Size = 101 }); err != errQuota {
+				t.Errorf("Expected EDQUOT growing a file over quota, got %v", err)
+			}
+			if err = setattr(inodes["file"], func(m *Metadata) { m.Size = 20 }); err != nil {
+				t.Fatalf("Couldn't shrink file: %v", err)
+			}
+
+			if err = setattr(inodes["file"], func(m *Metadata) { m.Uid = 1001 }); err != errQuota {
+				t.Errorf("Expected EDQUOT giving a file to a user over quota, got %v", err)
+			}
+			if err = setattr(inodes["file"], func(m *Metadata) { m.Gid = 1001 }); err != nil {
+				t.Fatalf("Couldn't give a file to a group under quota: %v", err)
+			}
+			if err = setattr(inodes["other"], func(m *Metadata) { m.Gid = 1001 }); err != errQuota {
+				t.Errorf("Expected EDQUOT giving a file to a group over quota, got %v", err)
+			}
+
+			if usage, err := GetQuota(db, QuotaUser, 1001); err != nil {
+				t.Fatalf("Couldn't get quota: %v", err)
+			} else if usage.Bytes != 0 || usage.Inodes != 0 {
+				t.Errorf("Changes over quota were kept, the user has %+v", usage)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package sqlutils
+
+import (
+	"sort"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// backends maps URI schemes to the backend handling them
+var backends = map[string]SQLBackend{}
+
+// Register makes backend available under name, which is used as the scheme in
+// sqlfs URIs (name://dsn). Packages adding backends should call it from init.
+//
+// Register panics if name is already taken, or if another dialect was
+// registered for the same driver.
+func Register(name string, backend SQLBackend) {
+	if backend == nil {
+		panic("sqlutils: Register backend is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("sqlutils: Register called twice for backend " + name)
+	}
+
+	d := backend.Dialect()
+	if registered, ok := dialects[d.Driver]; ok && registered != d {
+		panic("sqlutils: Register called with a different dialect for driver " + d.Driver)
+	}
+
+	sql.BindDriver(d.Driver, d.BindType)
+	dialects[d.Driver] = d
+	backends[name] = backend
+}
+
+// Backends returns the sorted names of all registered backends
+func Backends() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetBackend returns the backend registered as name
+func GetBackend(name string) (SQLBackend, bool) {
+	backend, ok := backends[name]
+	return backend, ok
+}
+
+// dialectBackend is a backend made only of a dialect and the shared queries
+type dialectBackend struct {
+	defaultBackend
+	dialect Dialect
+}
+
+// NewBackend returns a backend for databases speaking dialect d. It opens
+// d.Driver with the dsn as is and runs the shared queries for everything else.
+func NewBackend(d Dialect) SQLBackend {
+	return dialectBackend{dialect: d}
+}
+
+// OpenDB connects to dsn
+func (b dialectBackend) OpenDB(dsn string) (*sql.DB, error) {
+	return sql.Open(b.dialect.Driver, dsn)
+}
+
+// Dialect returns the dialect the backend was created with
+func (b dialectBackend) Dialect() Dialect {
+	return b.dialect
+}
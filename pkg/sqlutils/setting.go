@@ -0,0 +1,42 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"log"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// GetSetting returns the value of the fs-wide setting name, or "" if it isn't
+// set
+func GetSetting(db queryer, name string) (string, error) {
+	var value string
+
+	err := db.QueryRow(rebind(db, "select value from {{setting}} where name = ?"), name).Scan(&value)
+	if err != nil && err != dbsql.ErrNoRows {
+		log.Println("Couldn't get setting!")
+		return "", err
+	}
+
+	return value, nil
+}
+
+// SetSetting sets the fs-wide setting name to value. An empty value removes
+// the setting
+func SetSetting(db *sql.DB, name, value string) error {
+	return runInTx(db, "setting update", func(tx *sql.Tx) error {
+		var err error
+		if value == "" {
+			_, err = tx.Exec(rebind(tx, "delete from {{setting}} where name = ?"), name)
+		} else {
+			_, err = tx.Exec(rebind(tx, upsert(dialectOf(tx), "{{setting}}", []string{"name"}, []string{"name", "value"})),
+				name, value)
+		}
+		if err != nil {
+			log.Println("Couldn't update setting row!")
+			return err
+		}
+
+		return nil
+	})
+}
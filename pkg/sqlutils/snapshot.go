@@ -0,0 +1,200 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// Snapshots copy metadata and parent into snapshot_metadata and
+// snapshot_parent, but not file contents. A file in a snapshot with a null
+// data_id shares the contents of the live file with the same inode. Before
+// the live contents are changed or removed, preserveSnapshotData moves them
+// into snapshot_data, which counts the snapshots referring to each row in refs
+
+// Snapshot is a read-only copy of the whole fs, taken at Ctime
+type Snapshot struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Ctime int64  `db:"ctime"`
+
+	// Inodes and Bytes are the number of inodes and total size of files in
+	// the snapshot
+	Inodes int64 `db:"inodes"`
+	Bytes  int64 `db:"bytes"`
+}
+
+// ErrSnapshotNotFound is returned for snapshots which don't exist
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// snapshotID selects the id of the snapshot named by the next argument
+const snapshotID = "(select id from {{snapshot}} where name = ?)"
+
+// CreateSnapshot captures the current state of the fs as snapshot name. Only
+// metadata is copied, file contents are shared until they change. The trash
+// isn't part of snapshots
+func CreateSnapshot(db *sql.DB, name string) error {
+	if name == "" {
+		return errors.New("snapshot name can't be empty")
+	}
+
+	// both copies have to see the same state of the fs
+	opts := &dbsql.TxOptions{Isolation: dbsql.LevelRepeatableRead}
+
+	return runInTxWithOptions(db, "snapshot", opts, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRow(rebind(tx, "select id from {{snapshot}} where name = ?"), name).Scan(&id)
+		if err == nil {
+			return fmt.Errorf("snapshot `%s` already exists", name)
+		}
+		if err != dbsql.ErrNoRows {
+			log.Println("Couldn't look for snapshot!")
+			return err
+		}
+
+		err = tx.QueryRow(expandTables("select coalesce(max(id), 0) + 1 from {{snapshot}}")).Scan(&id)
+		if err != nil {
+			log.Println("Couldn't allocate snapshot id!")
+			return err
+		}
+
+		_, err = tx.Exec(rebind(tx, "insert into {{snapshot}}(id, name, ctime) values (?, ?, ?)"),
+			id, name, time.Now().UnixNano())
+		if err != nil {
+			log.Println("Couldn't insert snapshot row!")
+			return err
+		}
+
+		_, err = tx.Exec(rebind(tx,
+			`insert into
+            {{snapshot_metadata}}(snapshot,inode,uid,gid,mode,type,ctime,atime,mtime,name,size)
+            select ?, inode,uid,gid,mode,type,ctime,atime,mtime,name,size from {{metadata}}
+            where inode not in (select inode from {{trash}})`), id)
+		if err != nil {
+			log.Println("Couldn't copy metadata rows!")
+			return err
+		}
+
+		_, err = tx.Exec(rebind(tx,
+			"insert into {{snapshot_parent}}(snapshot,pinode,inode) select ?, pinode, inode from {{parent}}"), id)
+		if err != nil {
+			log.Println("Couldn't copy parent rows!")
+			return err
+		}
+
+		return nil
+	})
+}
+
+// GetSnapshots returns all snapshots, oldest first
+func GetSnapshots(db *sql.DB) ([]Snapshot, error) {
+	var snapshots []Snapshot
+
+	err := db.Select(&snapshots, expandTables(
+		`select snapshot.id, snapshot.name, snapshot.ctime,
+            count(metadata.inode) as inodes, coalesce(sum(metadata.size), 0) as bytes
+        from {{snapshot}} snapshot
+        left join {{snapshot_metadata}} metadata on metadata.snapshot = snapshot.id
+        group by snapshot.id, snapshot.name, snapshot.ctime
+        order by snapshot.ctime`))
+	if err != nil {
+		log.Println("Couldn't get snapshots!")
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// DeleteSnapshot removes snapshot name, along with the file contents only it
+// was still using
+func DeleteSnapshot(db *sql.DB, name string) error {
+	return runInTx(db, "snapshot removal", func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRow(rebind(tx, "select id from {{snapshot}} where name = ?"), name).Scan(&id)
+		if err == dbsql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		if err != nil {
+			log.Println("Couldn't look for snapshot!")
+			return err
+		}
+
+		// a snapshot refers to each row at most once, since rows are only
+		// shared between copies of the same inode
+		_, err = tx.Exec(rebind(tx,
+			`update {{snapshot_data}} set refs = refs - 1
+            where id in (select data_id from {{snapshot_metadata}} where snapshot = ? and data_id is not null)`), id)
+		if err != nil {
+			log.Println("Couldn't update snapshot data refs!")
+			return err
+		}
+
+		_, err = tx.Exec(expandTables("delete from {{snapshot_data}} where refs <= 0"))
+		if err != nil {
+			log.Println("Couldn't remove snapshot data rows!")
+			return err
+		}
+		uncacheSnapshotData(db)
+
+		for _, query := range []string{
+			"delete from {{snapshot_parent}} where snapshot = ?",
+			"delete from {{snapshot_metadata}} where snapshot = ?",
+			"delete from {{snapshot}} where id = ?",
+		} {
+			if _, err := tx.Exec(rebind(tx, query), id); err != nil {
+				log.Println("Couldn't remove snapshot rows!")
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// preserveSnapshotData moves the contents of file inode to snapshot_data if
+// snapshots still share them. Call it before the contents are changed or
+// removed, in the same transaction
+func preserveSnapshotData(tx *sql.Tx, inode int64) error {
+	var refs int64
+	err := tx.QueryRow(rebind(tx,
+		"select count(*) from {{snapshot_metadata}} where inode = ? and type = ? and data_id is null"),
+		inode, fuse.DT_File).Scan(&refs)
+	if err != nil {
+		log.Println("Couldn't count snapshots sharing file contents!")
+		return err
+	}
+	if refs == 0 {
+		return nil
+	}
+
+	var id int64
+	err = tx.QueryRow(expandTables("select coalesce(max(id), 0) + 1 from {{snapshot_data}}")).Scan(&id)
+	if err != nil {
+		log.Println("Couldn't allocate snapshot data id!")
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx,
+		"insert into {{snapshot_data}}(id, refs, data, compression) select ?, ?, "+fileData+", "+fileCompression+
+			fileDataFrom+" where filedata.inode = ?"),
+		id, refs, inode)
+	if err != nil {
+		log.Println("Couldn't copy file contents for snapshots!")
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx,
+		"update {{snapshot_metadata}} set data_id = ? where inode = ? and type = ? and data_id is null"),
+		id, inode, fuse.DT_File)
+	if err != nil {
+		log.Println("Couldn't update snapshot metadata rows!")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"fmt"
+	"log"
+	"syscall"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// errReadOnly is returned by SnapshotBackend for every change
+var errReadOnly = fuse.Errno(syscall.EROFS)
+
+// SnapshotBackend serves snapshot Name, read-only, from the db of SQLBackend.
+// Reads come from the snapshot tables and changes fail with EROFS
+type SnapshotBackend struct {
+	// SQLBackend is the backend of the db the snapshot is in. Everything
+	// which doesn't depend on the snapshot, like opening the db, is left to it
+	SQLBackend
+	Name string
+}
+
+// NewSnapshotBackend returns a backend serving snapshot name from the db of
+// backend
+func NewSnapshotBackend(backend SQLBackend, name string) SnapshotBackend {
+	return SnapshotBackend{backend, name}
+}
+
+// OpenDBReadOnly connects to dsn using the underlying backend, without
+// changing anything in the db
+func (s SnapshotBackend) OpenDBReadOnly(dsn string) (*sql.DB, error) {
+	return OpenDBReadOnly(s.SQLBackend, dsn)
+}
+
+// VerifyDB verifies the db using the underlying backend, and checks that the
+// snapshot exists
+func (s SnapshotBackend) VerifyDB(db *sql.DB) error {
+	if err := s.SQLBackend.VerifyDB(db); err != nil {
+		return err
+	}
+
+	var id int64
+	err := db.QueryRow(rebind(db, "select id from {{snapshot}} where name = ?"), s.Name).Scan(&id)
+	if err == dbsql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, s.Name)
+	}
+
+	return err
+}
+
+// GetMetadataForInode retrieves metadata for inode as it was in the snapshot
+func (s SnapshotBackend) GetMetadataForInode(db *sql.DB, inode int64) (Metadata, error) {
+	var metadata Metadata
+
+	err := db.QueryRowx(rebind(db,
+		`select
+            inode,uid,gid,mode,type,ctime,atime,mtime,name,size
+            from {{snapshot_metadata}} where snapshot = `+snapshotID+` and inode = ?`), s.Name, inode,
+	).StructScan(&metadata)
+	if err != nil {
+		log.Println("Couldn't get snapshot metadata!")
+		return Metadata{}, err
+	}
+
+	return metadata, nil
+}
+
+// GetDirectoryContentsForInode returns the children inode had in the snapshot
+func (s SnapshotBackend) GetDirectoryContentsForInode(db *sql.DB, inode int64) ([]int64, error) {
+	var childInodes []int64
+
+	err := db.Select(&childInodes, rebind(db,
+		"select inode from {{snapshot_parent}} where snapshot = "+snapshotID+" and pinode = ?"), s.Name, inode)
+	if err != nil {
+		log.Println("Couldn't query snapshot parent table!")
+		return nil, err
+	}
+
+	return childInodes, nil
+}
+
+// GetInodeForNameUnderInode returns the inode named name in directory inode
+// in the snapshot, or sql.ErrNoRows
+func (s SnapshotBackend) GetInodeForNameUnderInode(db *sql.DB, inode int64, name string) (int64, error) {
+	var childInode int64
+
+	err := db.QueryRow(rebind(db,
+		`select parent.inode
+            from {{snapshot_parent}} parent
+            join {{snapshot_metadata}} metadata
+                on parent.snapshot = metadata.snapshot and parent.inode = metadata.inode
+            where parent.snapshot = `+snapshotID+` and parent.pinode = ? and metadata.name = ?`),
+		s.Name, inode, name).Scan(&childInode)
+	if err != nil {
+		if err != dbsql.ErrNoRows {
+			log.Println("Couldn't retrieve inode from name!")
+		}
+		return 0, err
+	}
+
+	return childInode, nil
+}
+
+// snapshotDataFrom joins a file in a snapshot, with the next two arguments as
+// the snapshot name and the inode, to its contents. They're either in
+// snapshot_data or still shared with the live file, which may be in a chunk
+const snapshotDataFrom = `
+    from {{snapshot_metadata}} metadata
+    left join {{snapshot_data}} data on data.id = metadata.data_id
+    left join {{filedata}} filedata on metadata.data_id is null and filedata.inode = metadata.inode
+    left join {{chunk}} chunk on chunk.hash = filedata.hash
+    where metadata.snapshot = ` + snapshotID + ` and metadata.inode = ?`
+
+// snapshotData and snapshotCompression select the contents of a file in a
+// snapshot and their compression, joined by snapshotDataFrom
+const snapshotData = "coalesce(data.data, chunk.data, filedata.data)"
+const snapshotCompression = "coalesce(data.compression, chunk.compression, filedata.compression)"
+
+// snapshotFileKey returns the key the decompressed contents of file inode in
+// a snapshot are cached under, given its snapshot_data row, the hash of the
+// chunk it shares with the live file and its mtime. Contents still shared
+// with the live file are cached as those of the live file at that mtime
+func snapshotFileKey(db *sql.DB, inode int64, dataID dbsql.NullInt64, hash dbsql.NullString, mtime int64) cacheKey {
+	if dataID.Valid {
+		return snapshotDataKey(db, dataID.Int64)
+	}
+
+	return fileDataKey(db, inode, hash, mtime)
+}
+
+// readData returns the contents inode had in the snapshot, decompressed
+func (s SnapshotBackend) readData(db *sql.DB, inode int64) ([]byte, error) {
+	var data []byte
+	var c, hash dbsql.NullString
+	var dataID dbsql.NullInt64
+	var mtime int64
+
+	err := db.QueryRow(rebind(db, "select "+snapshotData+", "+snapshotCompression+
+		", metadata.data_id, chunk.hash, metadata.mtime"+snapshotDataFrom),
+		s.Name, inode).Scan(&data, &c, &dataID, &hash, &mtime)
+	if err != nil {
+		log.Println("Couldn't get snapshot filedata!")
+		return nil, err
+	}
+
+	return decompressData(Compression(c.String), snapshotFileKey(db, inode, dataID, hash, mtime), data)
+}
+
+// GetFileContentsForInode reads the contents inode had in the snapshot
+func (s SnapshotBackend) GetFileContentsForInode(db *sql.DB, inode int64) ([]byte, error) {
+	metadata, err := s.GetMetadataForInode(db, inode)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.readData(db, inode)
+	if err != nil {
+		return nil, err
+	}
+
+	filecontents := make([]byte, metadata.Size)
+	copy(filecontents, data)
+
+	return filecontents, nil
+}
+
+// GetFileRangeForInode reads size bytes of the contents inode had in the
+// snapshot, starting at offset. Like live files, compressed contents are
+// decompressed whole, or taken from contentsCache
+func (s SnapshotBackend) GetFileRangeForInode(db *sql.DB, inode int64, offset, size int64) ([]byte, error) {
+	var data []byte
+	var c, hash dbsql.NullString
+	var dataID dbsql.NullInt64
+	var mtime int64
+
+	// substr counts from 1
+	err := db.QueryRow(rebind(db, "select "+snapshotCompression+", metadata.data_id, chunk.hash, metadata.mtime, "+
+		"case when "+snapshotCompression+" is null then substr("+snapshotData+", ?, ?) end"+snapshotDataFrom),
+		offset+1, size, s.Name, inode).Scan(&c, &dataID, &hash, &mtime, &data)
+	if err != nil {
+		log.Println("Couldn't get snapshot filedata!")
+		return nil, err
+	}
+	if !c.Valid {
+		return data, nil
+	}
+
+	contents, ok := getCachedContents(snapshotFileKey(db, inode, dataID, hash, mtime))
+	if !ok {
+		if contents, err = s.readData(db, inode); err != nil {
+			return nil, err
+		}
+	}
+
+	return sliceRange(contents, offset, size), nil
+}
+
+// CreateDBTables fails, snapshots are read-only
+func (s SnapshotBackend) CreateDBTables(db *sql.DB) error {
+	return errReadOnly
+}
+
+// InitializeDBRows fails, snapshots are read-only
+func (s SnapshotBackend) InitializeDBRows(db *sql.DB) error {
+	return errReadOnly
+}
+
+// SetMetadataForInode fails, snapshots are read-only
+func (s SnapshotBackend) SetMetadataForInode(db *sql.DB, inode int64, metadata Metadata) error {
+	return errReadOnly
+}
+
+// SetFileContentsForInode fails, snapshots are read-only
+func (s SnapshotBackend) SetFileContentsForInode(db *sql.DB, inode int64, data []byte) error {
+	return errReadOnly
+}
+
+// CreateDirUnderInode fails, snapshots are read-only
+func (s SnapshotBackend) CreateDirUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error) {
+	return 0, errReadOnly
+}
+
+// CreateFileUnderInode fails, snapshots are read-only
+func (s SnapshotBackend) CreateFileUnderInode(db *sql.DB, inode int64, name string, uid, gid int64) (int64, error) {
+	return 0, errReadOnly
+}
+
+// RemoveDirUnderInode fails, snapshots are read-only
+func (s SnapshotBackend) RemoveDirUnderInode(db *sql.DB, inode int64, name string) error {
+	return errReadOnly
+}
+
+// RemoveFileUnderInode fails, snapshots are read-only
+func (s SnapshotBackend) RemoveFileUnderInode(db *sql.DB, inode int64, name string) error {
+	return errReadOnly
+}
+
+// RenameUnderInode fails, snapshots are read-only
+func (s SnapshotBackend) RenameUnderInode(db *sql.DB, inode int64, name string, newInode int64, newName string) error {
+	return errReadOnly
+}
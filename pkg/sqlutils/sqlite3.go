@@ -2,12 +2,13 @@ package sqlutils
 
 import (
 	_ "embed"
-	"log"
 
 	sql "github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// SQLiteBackend stores the fs in a sqlite database file. It uses
+// mattn/go-sqlite3 when built with cgo, and the pure go driver otherwise or
+// with the purego build tag
 type SQLiteBackend struct{ defaultBackend }
 
 var _ SQLBackend = (*SQLiteBackend)(nil)
@@ -15,18 +16,38 @@ var _ SQLBackend = (*SQLiteBackend)(nil)
 //go:embed init-sqlite3.sql
 var createTableSqlite3 string
 
-// OpenDB connects to dsn
-func (s SQLiteBackend) OpenDB(dsn string) (*sql.DB, error) {
-	return sql.Open("sqlite3", dsn)
+// newSqliteDialect returns the sqlite dialect for driver
+func newSqliteDialect(driver string) Dialect {
+	return Dialect{
+		Driver:   driver,
+		BindType: sql.QUESTION,
+		BlobType: "blob",
+		Upsert:   UpsertOnConflict,
+		Inodes:   InodeFromMax,
+		Tables:   createTableSqlite3,
+		// || makes text out of blobs
+		BlobConcat: "cast(%s || %s as blob)",
+		// the whole file, sqlite doesn't reliably report per table sizes
+		SizeQuery: "select page_count * page_size from pragma_page_count(), pragma_page_size()",
+	}
 }
 
-// CreateDBTables creates db tables using sql file
-func (s SQLiteBackend) CreateDBTables(db *sql.DB) error {
-	_, err := db.Exec(createTableSqlite3)
-	if err != nil {
-		log.Println("Couldn't write initial tables!")
-		return err
-	}
+func init() {
+	Register("sqlite", SQLiteBackend{})
+}
+
+// Dialect returns the sqlite dialect
+func (s SQLiteBackend) Dialect() Dialect {
+	return newSqliteDialect(sqliteDriver)
+}
+
+// OpenDB connects to dsn. See sqliteOptions for the options it takes
+func (s SQLiteBackend) OpenDB(dsn string) (*sql.DB, error) {
+	return openSqlite(sqliteDriver, dsn, false)
+}
 
-	return nil
+// OpenDBReadOnly connects to dsn without changing anything in the db, for
+// read-only mounts
+func (s SQLiteBackend) OpenDBReadOnly(dsn string) (*sql.DB, error) {
+	return openSqlite(sqliteDriver, dsn, true)
 }
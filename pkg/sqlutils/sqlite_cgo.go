@@ -0,0 +1,8 @@
+//go:build cgo && !purego
+
+package sqlutils
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the driver used by SQLiteBackend
+const sqliteDriver = "sqlite3"
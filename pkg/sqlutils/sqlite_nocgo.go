@@ -0,0 +1,7 @@
+//go:build !cgo || purego
+
+package sqlutils
+
+// sqliteDriver is the driver used by SQLiteBackend. mattn/go-sqlite3 needs
+// cgo, so fall back to the pure go driver registered by sqlite_purego.go
+const sqliteDriver = pureGoSqliteDriver
@@ -0,0 +1,186 @@
+package sqlutils
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// sqliteOption is a pragma which can be set using a query parameter of the
+// same name in sqlite DSNs, like fs.sql?journal_mode=delete&busy_timeout=1000
+type sqliteOption struct {
+	name string
+	// value used if the DSN doesn't set one. Empty leaves sqlite's default
+	value string
+	// validate reports whether value is acceptable
+	validate func(value string) bool
+}
+
+func oneOf(values ...string) func(string) bool {
+	return func(value string) bool {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func isInt(value string) bool {
+	_, err := strconv.ParseInt(value, 10, 64)
+	return err == nil
+}
+
+// sqlitePragmas are run on every connection before the sqlite options. They
+// can't be changed from the DSN
+var sqlitePragmas = []string{
+	// the schema relies on on delete cascade
+	"pragma foreign_keys = on",
+}
+
+// sqliteOptions are applied, in order, on every connection
+var sqliteOptions = []sqliteOption{
+	// don't fail right away if another connection or process holds a lock
+	{"busy_timeout", "5000", isInt},
+	// let readers (e.g. sqlfs verify) work while the fs is mounted
+	{"journal_mode", "wal", oneOf("delete", "truncate", "persist", "memory", "wal", "off")},
+	// normal is durable enough with wal, and much faster than full
+	{"synchronous", "normal", oneOf("off", "normal", "full", "extra", "0", "1", "2", "3")},
+	{"cache_size", "", isInt},
+	{"mmap_size", "", isInt},
+}
+
+// isTrue reports whether a boolean DSN parameter is set, the way the drivers
+// parse them
+var isTrue = oneOf("1", "true", "yes", "on")
+
+// readOnlyDefaults are the sqlite options whose default is left out when
+// the db is opened read-only. Changing the journal mode writes to the file,
+// and wal needs to create files next to it
+var readOnlyDefaults = map[string]bool{"journal_mode": true}
+
+// parseSqliteDSN splits the sqlfs options off dsn. It returns the DSN to
+// give to the driver and the pragmas to run on each connection. With
+// readOnly, or if the DSN opens the db read-only with mode=ro or
+// _query_only, options which would write to it are only set if the DSN asks
+// for them
+func parseSqliteDSN(dsn string, readOnly bool) (string, []string, error) {
+	path, rawQuery := dsn, ""
+	if i := strings.LastIndex(dsn, "?"); i >= 0 {
+		path, rawQuery = dsn[:i], dsn[i+1:]
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if query.Has("foreign_keys") {
+		return "", nil, fmt.Errorf("sqlite option foreign_keys can't be changed, it's always on")
+	}
+
+	readOnly = readOnly || query.Get("mode") == "ro" || isTrue(query.Get("_query_only"))
+
+	pragmas := append([]string{}, sqlitePragmas...)
+	for _, option := range sqliteOptions {
+		value := option.value
+		if readOnly && readOnlyDefaults[option.name] {
+			value = ""
+		}
+		if query.Has(option.name) {
+			value = query.Get(option.name)
+			query.Del(option.name)
+		}
+		if value == "" {
+			continue
+		}
+
+		if !option.validate(value) {
+			return "", nil, fmt.Errorf("invalid value `%s` for sqlite option %s", value, option.name)
+		}
+		pragmas = append(pragmas, fmt.Sprintf("pragma %s = %s", option.name, value))
+	}
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	return path, pragmas, nil
+}
+
+// openSqlite opens dsn using driverName, running the pragmas set by sqlite
+// options on every new connection in the pool. readOnly is passed on to
+// parseSqliteDSN
+func openSqlite(driverName, dsn string, readOnly bool) (*sql.DB, error) {
+	dsn, pragmas, err := parseSqliteDSN(dsn, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	// only to get hold of the driver
+	db, err := dbsql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	connector := &pragmaConnector{driver: drv, dsn: dsn, pragmas: pragmas}
+	return sql.NewDb(dbsql.OpenDB(connector), driverName), nil
+}
+
+// pragmaConnector opens connections to dsn and runs pragmas on each of them
+type pragmaConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+var _ driver.Connector = (*pragmaConnector)(nil)
+
+// Connect opens a connection and sets it up
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pragma := range c.pragmas {
+		if err := execOnConn(ctx, conn, pragma); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", pragma, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// Driver returns the underlying driver
+func (c *pragmaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execOnConn runs query without arguments on a raw driver connection
+func execOnConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nil)
+	return err
+}
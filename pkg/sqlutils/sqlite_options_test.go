@@ -0,0 +1,87 @@
+package sqlutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSqliteDSN(t *testing.T) {
+	defaults := []string{
+		"pragma foreign_keys = on",
+		"pragma busy_timeout = 5000",
+		"pragma journal_mode = wal",
+		"pragma synchronous = normal",
+	}
+	readOnly := []string{
+		"pragma foreign_keys = on",
+		"pragma busy_timeout = 5000",
+		"pragma synchronous = normal",
+	}
+
+	tests := []struct {
+		name     string
+		dsn      string
+		readOnly bool
+		path     string
+		pragmas  []string
+		invalid  bool
+	}{
+		{name: "defaults", dsn: "fs.sql", path: "fs.sql", pragmas: defaults},
+		{
+			name: "overrides",
+			dsn:  "fs.sql?journal_mode=delete&busy_timeout=1000&cache_size=-2000",
+			path: "fs.sql",
+			pragmas: []string{
+				"pragma foreign_keys = on",
+				"pragma busy_timeout = 1000",
+				"pragma journal_mode = delete",
+				"pragma synchronous = normal",
+				"pragma cache_size = -2000",
+			},
+		},
+		{name: "driver options kept", dsn: "file:fs.sql?cache=shared", path: "file:fs.sql?cache=shared", pragmas: defaults},
+		{name: "read-only", dsn: "fs.sql", readOnly: true, path: "fs.sql", pragmas: readOnly},
+		{name: "mode=ro", dsn: "file:fs.sql?mode=ro", path: "file:fs.sql?mode=ro", pragmas: readOnly},
+		{name: "_query_only", dsn: "fs.sql?_query_only=true", path: "fs.sql?_query_only=true", pragmas: readOnly},
+		{name: "_query_only off", dsn: "fs.sql?_query_only=0", path: "fs.sql?_query_only=0", pragmas: defaults},
+		{
+			name:     "read-only journal_mode set",
+			dsn:      "fs.sql?journal_mode=delete",
+			readOnly: true,
+			path:     "fs.sql",
+			pragmas: []string{
+				"pragma foreign_keys = on",
+				"pragma busy_timeout = 5000",
+				"pragma journal_mode = delete",
+				"pragma synchronous = normal",
+			},
+		},
+		{name: "invalid journal_mode", dsn: "fs.sql?journal_mode=fast", invalid: true},
+		{name: "invalid busy_timeout", dsn: "fs.sql?busy_timeout=5s", invalid: true},
+		{name: "invalid synchronous", dsn: "fs.sql?synchronous=always", invalid: true},
+		{name: "foreign_keys", dsn: "fs.sql?foreign_keys=off", invalid: true},
+		{name: "invalid query", dsn: "fs.sql?busy_timeout=%zz", invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, pragmas, err := parseSqliteDSN(test.dsn, test.readOnly)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("parseSqliteDSN(%q) didn't fail", test.dsn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Couldn't parse %q: %v", test.dsn, err)
+			}
+
+			if path != test.path {
+				t.Errorf("parseSqliteDSN(%q) returned DSN %q, expected %q", test.dsn, path, test.path)
+			}
+			if !reflect.DeepEqual(pragmas, test.pragmas) {
+				t.Errorf("parseSqliteDSN(%q) returned pragmas %q, expected %q", test.dsn, pragmas, test.pragmas)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package sqlutils
+
+import (
+	sql "github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// pureGoSqliteDriver is the name modernc.org/sqlite registers itself as
+const pureGoSqliteDriver = "sqlite"
+
+// PureGoSQLiteBackend is SQLiteBackend on modernc.org/sqlite, which doesn't
+// need cgo. Databases are interchangeable between the two.
+type PureGoSQLiteBackend struct{ defaultBackend }
+
+var _ SQLBackend = (*PureGoSQLiteBackend)(nil)
+
+func init() {
+	Register("sqlite-purego", PureGoSQLiteBackend{})
+}
+
+// Dialect returns the sqlite dialect
+func (s PureGoSQLiteBackend) Dialect() Dialect {
+	return newSqliteDialect(pureGoSqliteDriver)
+}
+
+// OpenDB connects to dsn. See sqliteOptions for the options it takes
+func (s PureGoSQLiteBackend) OpenDB(dsn string) (*sql.DB, error) {
+	return openSqlite(pureGoSqliteDriver, dsn, false)
+}
+
+// OpenDBReadOnly connects to dsn without changing anything in the db, for
+// read-only mounts
+func (s PureGoSQLiteBackend) OpenDBReadOnly(dsn string) (*sql.DB, error) {
+	return openSqlite(pureGoSqliteDriver, dsn, true)
+}
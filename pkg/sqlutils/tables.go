@@ -0,0 +1,105 @@
+package sqlutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// validIdentifier matches the table prefixes and schema names we accept. They
+// are spliced into queries unquoted, so keep them to plain sql identifiers
+var validIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tablePrefix is prepended to every table name
+var tablePrefix string
+
+// tableSchema qualifies every table name, if set
+var tableSchema string
+
+// tableNames expands the {{table}} placeholders used in queries and init scripts
+var tableNames = newTableReplacer()
+
+// SetTablePrefix makes all backends prepend prefix to the names of the tables
+// they create and query, e.g. prefix "fs_" gives "fs_metadata"
+func SetTablePrefix(prefix string) error {
+	if prefix != "" && !validIdentifier.MatchString(prefix) {
+		return fmt.Errorf("invalid table prefix `%s`", prefix)
+	}
+
+	tablePrefix = prefix
+	tableNames = newTableReplacer()
+
+	return nil
+}
+
+// SetSchema makes all backends qualify their tables with schema. Only
+// backends which support schemas should be used with a non-empty schema
+func SetSchema(schema string) error {
+	if schema != "" && !validIdentifier.MatchString(schema) {
+		return fmt.Errorf("invalid schema name `%s`", schema)
+	}
+
+	tableSchema = schema
+	tableNames = newTableReplacer()
+
+	return nil
+}
+
+// Schema returns the schema set using SetSchema
+func Schema() string {
+	return tableSchema
+}
+
+// TableName returns the actual name of table after applying prefix and schema
+func TableName(table string) string {
+	name := tablePrefix + table
+	if tableSchema != "" {
+		name = tableSchema + "." + name
+	}
+
+	return name
+}
+
+// tables are the names of all tables, without prefix and schema
+var tables = []string{
+	"metadata", "filedata", "parent", "quota",
+	"snapshot", "snapshot_metadata", "snapshot_parent", "snapshot_data",
+	"version", "setting", "trash", "chunk",
+}
+
+// addedColumns lists the columns added to tables after they were first
+// released, which init adds to tables of existing dbs
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"filedata", "hash", "varchar(64) default null"},
+	{"filedata", "compression", "varchar(8) default null"},
+	{"chunk", "compression", "varchar(8) default null"},
+	{"snapshot_data", "compression", "varchar(8) default null"},
+	{"version", "compression", "varchar(8) default null"},
+}
+
+func newTableReplacer() *strings.Replacer {
+	var oldnew []string
+	for _, table := range tables {
+		oldnew = append(oldnew, "{{"+table+"}}", TableName(table))
+	}
+
+	return strings.NewReplacer(oldnew...)
+}
+
+// expandTables replaces table placeholders like {{metadata}} in query with
+// the actual table names
+func expandTables(query string) string {
+	return tableNames.Replace(query)
+}
+
+// binder is implemented by both sql.DB and sql.Tx
+type binder interface {
+	Rebind(query string) string
+}
+
+// rebind expands table names in query and rebinds it for db's placeholder style
+func rebind(db binder, query string) string {
+	return db.Rebind(expandTables(query))
+}
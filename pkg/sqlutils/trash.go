@@ -0,0 +1,384 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// Removing a file or directory with the trash enabled only takes it out of
+// parent, and records the directory it was in and when in trash. Its metadata,
+// contents and versions stay until it's purged, by hand or once it's been in
+// the trash longer than the retention
+
+// settings holding the trash options
+const (
+	trashSetting          = "trash.enabled"
+	trashRetentionSetting = "trash.retention"
+)
+
+// TrashOptions is whether removed files and directories are moved to the
+// trash, and for how long they're kept there
+type TrashOptions struct {
+	Enabled bool
+	// Retention is how long removed files are kept before they're purged, 0
+	// to keep them until purged by hand. What's expired is purged by
+	// PurgeExpiredTrash, and whenever something else is moved to the trash
+	Retention time.Duration
+}
+
+// TrashEntry is a file or directory in the trash, removed at Dtime from the
+// directory Pinode
+type TrashEntry struct {
+	Inode  int64  `db:"inode"`
+	Pinode int64  `db:"pinode"`
+	Dtime  int64  `db:"dtime"`
+	Type   int64  `db:"type"`
+	Name   string `db:"name"`
+	Size   int64  `db:"size"`
+
+	// Path is where it was removed from
+	Path string `db:"-"`
+}
+
+// ErrNotInTrash is returned for inodes which aren't in the trash
+var ErrNotInTrash = errors.New("not in trash")
+
+// GetTrashOptions returns the trash options of the fs
+func GetTrashOptions(db queryer) (TrashOptions, error) {
+	var opts TrashOptions
+
+	enabled, err := GetSetting(db, trashSetting)
+	if err != nil {
+		return opts, err
+	}
+	if enabled != "" {
+		if opts.Enabled, err = strconv.ParseBool(enabled); err != nil {
+			return opts, fmt.Errorf("invalid %s setting: %w", trashSetting, err)
+		}
+	}
+
+	retention, err := GetSetting(db, trashRetentionSetting)
+	if err != nil {
+		return opts, err
+	}
+	if retention != "" {
+		if opts.Retention, err = time.ParseDuration(retention); err != nil {
+			return opts, fmt.Errorf("invalid %s setting: %w", trashRetentionSetting, err)
+		}
+	}
+
+	return opts, nil
+}
+
+// SetTrashOptions sets the trash options of the fs. Disabling the trash
+// leaves what's already in it until it's purged
+func SetTrashOptions(db *sql.DB, opts TrashOptions) error {
+	if opts.Retention < 0 {
+		return errors.New("trash retention can't be negative")
+	}
+
+	enabled, retention := "", ""
+	if opts.Enabled {
+		enabled = strconv.FormatBool(opts.Enabled)
+	}
+	if opts.Retention > 0 {
+		retention = opts.Retention.String()
+	}
+
+	if err := SetSetting(db, trashSetting, enabled); err != nil {
+		return err
+	}
+
+	return SetSetting(db, trashRetentionSetting, retention)
+}
+
+// GetTrash returns everything in the trash, most recently removed first
+func GetTrash(db *sql.DB) ([]TrashEntry, error) {
+	var entries []TrashEntry
+
+	err := db.Select(&entries, expandTables(
+		`select trash.inode, trash.pinode, trash.dtime, metadata.type, metadata.name, metadata.size
+        from {{trash}} trash
+        join {{metadata}} metadata on metadata.inode = trash.inode
+        order by trash.dtime desc, trash.inode desc`))
+	if err != nil {
+		log.Println("Couldn't get trash!")
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].Path, err = getOriginalPath(db, entries[i].Inode); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// getOriginalPath returns the path of inode, as it was before it or the
+// directories it was in were moved to the trash. If one of those directories
+// was purged since, the path starts with ?/ instead
+func getOriginalPath(db queryer, inode int64) (string, error) {
+	var names []string
+
+	for inode != 1 {
+		var pinode dbsql.NullInt64
+		var name string
+		err := db.QueryRow(rebind(db,
+			`select coalesce(trash.pinode, parent.pinode), metadata.name
+            from {{metadata}} metadata
+            left join {{trash}} trash on trash.inode = metadata.inode
+            left join {{parent}} parent on parent.inode = metadata.inode
+            where metadata.inode = ?`), inode).Scan(&pinode, &name)
+		if err == dbsql.ErrNoRows || (err == nil && !pinode.Valid) {
+			return strings.Join(append([]string{"?"}, names...), "/"), nil
+		}
+		if err != nil {
+			log.Println("Couldn't retrieve parent inode!")
+			return "", err
+		}
+
+		names = append([]string{name}, names...)
+		inode = pinode.Int64
+	}
+
+	return "/" + strings.Join(names, "/"), nil
+}
+
+// getTrashParent returns the directory inode was removed from, or
+// sql.ErrNoRows if it isn't in the trash
+func getTrashParent(db queryer, inode int64) (int64, error) {
+	var pinode int64
+
+	err := db.QueryRow(rebind(db, "select pinode from {{trash}} where inode = ?"), inode).Scan(&pinode)
+	if err != nil && err != dbsql.ErrNoRows {
+		log.Println("Couldn't look for inode in trash!")
+	}
+
+	return pinode, err
+}
+
+// getTrashChildren returns what was removed from directory inode and is
+// still in the trash
+func getTrashChildren(tx *sql.Tx, inode int64) ([]int64, error) {
+	var children []int64
+
+	err := tx.Select(&children, rebind(tx, "select inode from {{trash}} where pinode = ?"), inode)
+	if err != nil {
+		log.Println("Couldn't get trash children!")
+		return nil, err
+	}
+
+	return children, nil
+}
+
+// RestoreFromTrash puts inode back where it was removed from, along with
+// everything removed from under it. The directories it was in are restored
+// first, if they're in the trash too
+func RestoreFromTrash(db *sql.DB, inode int64) error {
+	return runInTx(db, "trash restore", func(tx *sql.Tx) error {
+		pinode, err := getTrashParent(tx, inode)
+		if err == dbsql.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrNotInTrash, inode)
+		}
+		if err != nil {
+			return err
+		}
+
+		var ancestors []int64
+		for dir := pinode; ; {
+			next, err := getTrashParent(tx, dir)
+			if err == dbsql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			ancestors = append([]int64{dir}, ancestors...)
+			dir = next
+		}
+		for _, ancestor := range ancestors {
+			if err := restoreTrashEntry(tx, ancestor); err != nil {
+				return err
+			}
+		}
+
+		// the directories are restored before what was under them
+		for pending := []int64{inode}; len(pending) > 0; {
+			inode, pending = pending[0], pending[1:]
+
+			if err := restoreTrashEntry(tx, inode); err != nil {
+				return err
+			}
+
+			children, err := getTrashChildren(tx, inode)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, children...)
+		}
+
+		return nil
+	})
+}
+
+// restoreTrashEntry puts inode back in the directory it was removed from,
+// which has to exist and not have anything else with its name
+func restoreTrashEntry(tx *sql.Tx, inode int64) error {
+	path, err := getOriginalPath(tx, inode)
+	if err != nil {
+		return err
+	}
+
+	var pinode, pinodeType int64
+	var name string
+	err = tx.QueryRow(rebind(tx,
+		`select trash.pinode, coalesce(parent.type, 0), metadata.name
+        from {{trash}} trash
+        join {{metadata}} metadata on metadata.inode = trash.inode
+        left join {{metadata}} parent on parent.inode = trash.pinode
+        where trash.inode = ?`), inode).Scan(&pinode, &pinodeType, &name)
+	if err != nil {
+		log.Println("Couldn't get trash entry!")
+		return err
+	}
+
+	if pinodeType != int64(fuse.DT_Dir) {
+		return fmt.Errorf("%s: the directory it was removed from doesn't exist anymore", path)
+	}
+	if _, err := getInodeFromNameUnderDir(tx, pinode, name); err == nil {
+		return fmt.Errorf("%s: a file with the same name exists, move it away first", path)
+	} else if err != dbsql.ErrNoRows {
+		return err
+	}
+
+	if err := insertIntoParent(tx, pinode, inode); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, "delete from {{trash}} where inode = ?"), inode)
+	if err != nil {
+		log.Println("Couldn't remove trash rows!")
+		return err
+	}
+
+	return nil
+}
+
+// PurgeTrash removes inode, and everything removed from under it, from the
+// trash for good
+func PurgeTrash(db *sql.DB, inode int64) error {
+	return runInTx(db, "trash purge", func(tx *sql.Tx) error {
+		if _, err := getTrashParent(tx, inode); err == dbsql.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrNotInTrash, inode)
+		} else if err != nil {
+			return err
+		}
+
+		return purgeTrashEntry(tx, inode)
+	})
+}
+
+// PurgeTrashBefore removes everything moved to the trash before t for good
+func PurgeTrashBefore(db *sql.DB, t time.Time) error {
+	return runInTx(db, "trash purge", func(tx *sql.Tx) error {
+		return purgeTrashBefore(tx, t)
+	})
+}
+
+// PurgeExpiredTrash removes what's been in the trash longer than the
+// retention for good. It's run when the fs is mounted and the trash listed,
+// so that what's expired goes even if nothing else is removed
+func PurgeExpiredTrash(db *sql.DB) error {
+	return runInTx(db, "trash purge", func(tx *sql.Tx) error {
+		opts, err := GetTrashOptions(tx)
+		if err != nil {
+			return err
+		}
+
+		return purgeExpiredTrash(tx, opts, time.Now())
+	})
+}
+
+// purgeExpiredTrash removes what was moved to the trash longer than the
+// retention of opts before now, if there's one
+func purgeExpiredTrash(tx *sql.Tx, opts TrashOptions, now time.Time) error {
+	if opts.Retention <= 0 {
+		return nil
+	}
+
+	return purgeTrashBefore(tx, now.Add(-opts.Retention))
+}
+
+// purgeTrashBefore removes everything moved to the trash before t for good
+func purgeTrashBefore(tx *sql.Tx, t time.Time) error {
+	var inodes []int64
+
+	err := tx.Select(&inodes, rebind(tx, "select inode from {{trash}} where dtime < ?"), t.UnixNano())
+	if err != nil {
+		log.Println("Couldn't get trash!")
+		return err
+	}
+
+	for _, inode := range inodes {
+		if err := purgeTrashEntry(tx, inode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeTrashEntry removes inode and everything removed from under it for
+// good. Purging an entry which was already purged along with its directory
+// does nothing
+func purgeTrashEntry(tx *sql.Tx, inode int64) error {
+	children, err := getTrashChildren(tx, inode)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err := purgeTrashEntry(tx, child); err != nil {
+			return err
+		}
+	}
+
+	return deleteInode(tx, inode)
+}
+
+// moveToTrash moves inode, in directory pinode, to the trash if it's enabled,
+// purging what's been there longer than the retention. It reports whether
+// inode was moved, otherwise it's up to the caller to remove it
+func moveToTrash(tx *sql.Tx, pinode, inode int64) (bool, error) {
+	opts, err := GetTrashOptions(tx)
+	if err != nil || !opts.Enabled {
+		return false, err
+	}
+
+	if err := removeFromParent(tx, pinode, inode); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(rebind(tx, "insert into {{trash}}(inode, pinode, dtime) values (?, ?, ?)"),
+		inode, pinode, now.UnixNano())
+	if err != nil {
+		log.Println("Couldn't insert trash row!")
+		return false, err
+	}
+
+	if err := purgeExpiredTrash(tx, opts, now); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
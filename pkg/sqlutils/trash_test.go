@@ -0,0 +1,102 @@
+package sqlutils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRenameToTrash(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetTrashOptions(db, TrashOptions{Enabled: true}); err != nil {
+				t.Fatalf("Couldn't enable the trash: %v", err)
+			}
+
+			inodes := map[string]int64{}
+			for _, name := range []string{"source", "target"} {
+				inode, err := backend.CreateFileUnderInode(db, 1, name, 0, 0)
+				if err != nil {
+					t.Fatalf("Couldn't create file: %v", err)
+				}
+				if err = backend.SetFileContentsForInode(db, inode, []byte(name)); err != nil {
+					t.Fatalf("Couldn't write file: %v", err)
+				}
+				inodes[name] = inode
+			}
+
+			if err := backend.RenameUnderInode(db, 1, "source", 1, "target"); err != nil {
+				t.Fatalf("Couldn't rename: %v", err)
+			}
+
+			trash, err := GetTrash(db)
+			if err != nil {
+				t.Fatalf("Couldn't list the trash: %v", err)
+			}
+			if len(trash) != 1 || trash[0].Inode != inodes["target"] {
+				t.Fatalf("GetTrash returned %+v, expected the replaced file", trash)
+			}
+
+			// its name is taken by the renamed file
+			if err = RestoreFromTrash(db, inodes["target"]); err == nil {
+				t.Errorf("restoring over the renamed file didn't fail")
+			}
+			if err = backend.RenameUnderInode(db, 1, "target", 1, "renamed"); err != nil {
+				t.Fatalf("Couldn't rename: %v", err)
+			}
+			if err = RestoreFromTrash(db, inodes["target"]); err != nil {
+				t.Fatalf("Couldn't restore from the trash: %v", err)
+			}
+
+			data, err := backend.GetFileContentsForInode(db, inodes["target"])
+			if err != nil {
+				t.Fatalf("Couldn't read file: %v", err)
+			}
+			if !bytes.Equal(data, []byte("target")) {
+				t.Errorf("restored file has %q, expected %q", data, "target")
+			}
+		})
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetTrashOptions(db, TrashOptions{Enabled: true, Retention: time.Hour}); err != nil {
+				t.Fatalf("Couldn't enable the trash: %v", err)
+			}
+
+			inodes := map[string]int64{}
+			for _, name := range []string{"expired", "kept"} {
+				inode, err := backend.CreateFileUnderInode(db, 1, name, 0, 0)
+				if err != nil {
+					t.Fatalf("Couldn't create file: %v", err)
+				}
+				if err = backend.RemoveFileUnderInode(db, 1, name); err != nil {
+					t.Fatalf("Couldn't remove file: %v", err)
+				}
+				inodes[name] = inode
+			}
+
+			_, err := db.Exec(rebind(db, "update {{trash}} set dtime = ? where inode = ?"),
+				time.Now().Add(-2*time.Hour).UnixNano(), inodes["expired"])
+			if err != nil {
+				t.Fatalf("Couldn't set dtime: %v", err)
+			}
+
+			if err = PurgeExpiredTrash(db); err != nil {
+				t.Fatalf("Couldn't purge expired trash: %v", err)
+			}
+
+			trash, err := GetTrash(db)
+			if err != nil {
+				t.Fatalf("Couldn't list the trash: %v", err)
+			}
+			if len(trash) != 1 || trash[0].Inode != inodes["kept"] {
+				t.Errorf("GetTrash returned %+v, expected only the file removed within the retention", trash)
+			}
+		})
+	}
+}
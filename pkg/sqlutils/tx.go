@@ -0,0 +1,83 @@
+package sqlutils
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"log"
+
+	sql "github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// maxTxRetries is the number of times a transaction is retried after a
+// serialization failure
+const maxTxRetries = 10
+
+// runInTx runs fn inside a transaction on db and commits it. The transaction
+// is rolled back if fn fails. If db's dialect asks for it, the whole
+// transaction is retried when it fails with a serialization failure, and
+// errors with a matching errno are mapped to it (see Limits).
+//
+// what describes the transaction in log messages
+func runInTx(db *sql.DB, what string, fn func(tx *sql.Tx) error) error {
+	return runInTxWithOptions(db, what, nil, fn)
+}
+
+// runInTxWithOptions is runInTx with opts for the transaction, like its
+// isolation level. Drivers which don't support opts ignore them
+func runInTxWithOptions(db *sql.DB, what string, opts *dbsql.TxOptions, fn func(tx *sql.Tx) error) error {
+	d := dialectOf(db)
+
+	var err error
+	for attempt := 0; attempt <= maxTxRetries; attempt++ {
+		err = runInTxOnce(db, what, opts, fn)
+		if err == nil || !d.RetryTx || !isSerializationFailure(err) {
+			break
+		}
+
+		log.Printf("Retrying tx for %s after serialization failure\n", what)
+	}
+
+	if err != nil && d.Limits != nil {
+		return d.Limits.Errno(err)
+	}
+
+	return err
+}
+
+func runInTxOnce(db *sql.DB, what string, opts *dbsql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTxx(context.Background(), opts)
+	if err != nil {
+		log.Printf("Couldn't prepare tx for %s!\n", what)
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Printf("Couldn't commit tx for %s!\n", what)
+		return err
+	}
+
+	return nil
+}
+
+// isSerializationFailure reports whether err is SQLSTATE 40001, which asks
+// the client to retry the transaction
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001"
+	}
+
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState() == "40001"
+	}
+
+	return false
+}
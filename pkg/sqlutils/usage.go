@@ -0,0 +1,40 @@
+package sqlutils
+
+import (
+	"log"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// Usage is how much of the database the fs takes up
+type Usage struct {
+	// Inodes is the number of files and directories
+	Inodes int64
+	// Bytes is the total size of file contents
+	Bytes int64
+	// DBSize is the space the fs tables take up in the database, including
+	// indexes and other overhead. 0 if the dialect can't tell
+	DBSize int64
+}
+
+// GetUsage counts the inodes and stored bytes in db, and measures the size of
+// the tables using the dialect's SizeQuery
+func (d defaultBackend) GetUsage(db *sql.DB) (Usage, error) {
+	var usage Usage
+
+	err := db.QueryRow(expandTables("select count(*), coalesce(sum(size), 0) from {{metadata}}")).
+		Scan(&usage.Inodes, &usage.Bytes)
+	if err != nil {
+		log.Println("Couldn't count inodes!")
+		return usage, err
+	}
+
+	if query := dialectOf(db).SizeQuery; query != "" {
+		if err := db.QueryRow(expandTables(query)).Scan(&usage.DBSize); err != nil {
+			log.Println("Couldn't get database size!")
+			return usage, err
+		}
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,312 @@
+package sqlutils
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	sql "github.com/jmoiron/sqlx"
+)
+
+// settings holding the version retention
+const (
+	versionsKeepSetting   = "versions.keep"
+	versionsMaxAgeSetting = "versions.max_age"
+)
+
+// versionInterval is how long contents have to stay unchanged before changing
+// them saves a version. Files are written in many small writes, which should
+// only save the contents from before the first one
+const versionInterval = time.Minute
+
+// VersionTimeFormat is the format versions are named by, in UTC
+const VersionTimeFormat = "2006-01-02T15:04:05Z"
+
+// VersionOptions is how many versions of files are kept, and for how long.
+// Versions are only kept if either is set
+type VersionOptions struct {
+	// Keep is the most versions kept per file, 0 for no limit
+	Keep int64
+	// MaxAge is how long versions are kept after being replaced, 0 for no
+	// limit
+	MaxAge time.Duration
+}
+
+// Enabled reports whether versions are kept at all
+func (o VersionOptions) Enabled() bool {
+	return o.Keep > 0 || o.MaxAge > 0
+}
+
+// Version is the contents a file had until Ctime, written at Mtime
+type Version struct {
+	Inode int64 `db:"inode"`
+	Mtime int64 `db:"mtime"`
+	Ctime int64 `db:"ctime"`
+	Size  int64 `db:"size"`
+}
+
+// Name returns the name v is shown by, its mtime formatted with
+// VersionTimeFormat
+func (v Version) Name() string {
+	return time.Unix(0, v.Mtime).UTC().Format(VersionTimeFormat)
+}
+
+// ErrVersionNotFound is returned for versions which don't exist
+var ErrVersionNotFound = errors.New("version not found")
+
+// GetVersionOptions returns the version retention of the fs
+func GetVersionOptions(db queryer) (VersionOptions, error) {
+	var opts VersionOptions
+
+	keep, err := GetSetting(db, versionsKeepSetting)
+	if err != nil {
+		return opts, err
+	}
+	if keep != "" {
+		if opts.Keep, err = strconv.ParseInt(keep, 10, 64); err != nil {
+			return opts, fmt.Errorf("invalid %s setting: %w", versionsKeepSetting, err)
+		}
+	}
+
+	maxAge, err := GetSetting(db, versionsMaxAgeSetting)
+	if err != nil {
+		return opts, err
+	}
+	if maxAge != "" {
+		if opts.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+			return opts, fmt.Errorf("invalid %s setting: %w", versionsMaxAgeSetting, err)
+		}
+	}
+
+	return opts, nil
+}
+
+// SetVersionOptions sets the version retention of the fs. Versions which are
+// already kept are pruned the next time a version is saved
+func SetVersionOptions(db *sql.DB, opts VersionOptions) error {
+	if opts.Keep < 0 || opts.MaxAge < 0 {
+		return errors.New("version retention can't be negative")
+	}
+
+	keep, maxAge := "", ""
+	if opts.Keep > 0 {
+		keep = strconv.FormatInt(opts.Keep, 10)
+	}
+	if opts.MaxAge > 0 {
+		maxAge = opts.MaxAge.String()
+	}
+
+	if err := SetSetting(db, versionsKeepSetting, keep); err != nil {
+		return err
+	}
+
+	return SetSetting(db, versionsMaxAgeSetting, maxAge)
+}
+
+// GetVersions returns the versions kept of file inode, newest first
+func GetVersions(db *sql.DB, inode int64) ([]Version, error) {
+	var versions []Version
+
+	err := db.Select(&versions, rebind(db,
+		"select inode, mtime, ctime, size from {{version}} where inode = ? order by mtime desc"), inode)
+	if err != nil {
+		log.Println("Couldn't get versions!")
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetVersionByName returns the newest version of file inode with the given
+// name (see Version.Name), or ErrVersionNotFound
+func GetVersionByName(db *sql.DB, inode int64, name string) (Version, error) {
+	t, err := time.Parse(VersionTimeFormat, name)
+	if err != nil {
+		return Version{}, fmt.Errorf("%w: %s", ErrVersionNotFound, name)
+	}
+
+	var version Version
+	err = db.QueryRowx(rebind(db,
+		`select inode, mtime, ctime, size from {{version}}
+        where inode = ? and mtime >= ? and mtime < ?
+        order by mtime desc`),
+		inode, t.UnixNano(), t.Add(time.Second).UnixNano()).StructScan(&version)
+	if err == dbsql.ErrNoRows {
+		return Version{}, fmt.Errorf("%w: %s", ErrVersionNotFound, name)
+	}
+	if err != nil {
+		log.Println("Couldn't get version!")
+		return Version{}, err
+	}
+
+	return version, nil
+}
+
+// GetVersionContents returns the contents of version
+func GetVersionContents(db queryer, version Version) ([]byte, error) {
+	var data []byte
+	var c dbsql.NullString
+
+	err := db.QueryRow(rebind(db, "select data, compression from {{version}} where inode = ? and mtime = ?"),
+		version.Inode, version.Mtime).Scan(&data, &c)
+	if err != nil {
+		log.Println("Couldn't get version data!")
+		return nil, err
+	}
+
+	if data, err = decompress(Compression(c.String), data); err != nil {
+		return nil, err
+	}
+
+	contents := make([]byte, version.Size)
+	copy(contents, data)
+
+	return contents, nil
+}
+
+// GetVersionedInodesUnderInode returns the children of directory inode which
+// have versions
+func GetVersionedInodesUnderInode(db *sql.DB, inode int64) ([]int64, error) {
+	var inodes []int64
+
+	err := db.Select(&inodes, rebind(db,
+		`select distinct parent.inode
+        from {{parent}} parent
+        join {{version}} version on version.inode = parent.inode
+        where parent.pinode = ?`), inode)
+	if err != nil {
+		log.Println("Couldn't get versioned files!")
+		return nil, err
+	}
+
+	return inodes, nil
+}
+
+// RestoreVersion makes version the contents of its file again, in a single
+// transaction. The contents being replaced are kept as a version, however
+// recently they were written. Like SetFileContentsForInode, contents too large
+// for the database fail with EFBIG
+func RestoreVersion(db *sql.DB, version Version) error {
+	if err := checkWriteSize(db, version.Size); err != nil {
+		return err
+	}
+
+	return runInTx(db, "version restore", func(tx *sql.Tx) error {
+		data, err := GetVersionContents(tx, version)
+		if err != nil {
+			return err
+		}
+
+		return setFileContents(tx, version.Inode, data, true)
+	})
+}
+
+// saveVersion keeps the current contents of file inode as a version, if
+// versions are enabled and they were written more than versionInterval ago
+// (or force is set), and prunes versions past the retention. Call it before the contents
+// change, in the same transaction
+func saveVersion(tx *sql.Tx, inode int64, force bool) error {
+	opts, err := GetVersionOptions(tx)
+	if err != nil || !opts.Enabled() {
+		return err
+	}
+
+	var mtime, size int64
+	err = tx.QueryRow(rebind(tx, "select mtime, size from {{metadata}} where inode = ?"), inode).Scan(&mtime, &size)
+	if err != nil {
+		log.Println("Couldn't get metadata!")
+		return err
+	}
+
+	// there's nothing to keep of empty files, which is also what files are
+	// before their first write
+	now := time.Now()
+	if size == 0 || (!force && now.Sub(time.Unix(0, mtime)) < versionInterval) {
+		return nil
+	}
+
+	var exists int64
+	err = tx.QueryRow(rebind(tx, "select count(*) from {{version}} where inode = ? and mtime = ?"),
+		inode, mtime).Scan(&exists)
+	if err != nil {
+		log.Println("Couldn't look for version!")
+		return err
+	}
+
+	if exists == 0 {
+		_, err = tx.Exec(rebind(tx,
+			`insert into {{version}}(inode, mtime, ctime, size, data, compression)
+            select filedata.inode, ?, ?, ?, `+fileData+`, `+fileCompression+fileDataFrom+` where filedata.inode = ?`),
+			mtime, now.UnixNano(), size, inode)
+		if err != nil {
+			log.Println("Couldn't insert version row!")
+			return err
+		}
+	}
+
+	return pruneVersions(tx, inode, opts)
+}
+
+// pruneVersions removes the versions of inode past opts.Keep, and versions of
+// all files replaced longer than opts.MaxAge ago
+func pruneVersions(tx *sql.Tx, inode int64, opts VersionOptions) error {
+	if opts.MaxAge > 0 {
+		_, err := tx.Exec(rebind(tx, "delete from {{version}} where ctime < ?"),
+			time.Now().Add(-opts.MaxAge).UnixNano())
+		if err != nil {
+			log.Println("Couldn't remove old versions!")
+			return err
+		}
+	}
+
+	if opts.Keep > 0 {
+		var mtimes []int64
+		err := tx.Select(&mtimes, rebind(tx, "select mtime from {{version}} where inode = ? order by mtime desc"), inode)
+		if err != nil {
+			log.Println("Couldn't get versions!")
+			return err
+		}
+
+		if int64(len(mtimes)) > opts.Keep {
+			_, err = tx.Exec(rebind(tx, "delete from {{version}} where inode = ? and mtime < ?"),
+				inode, mtimes[opts.Keep-1])
+			if err != nil {
+				log.Println("Couldn't remove versions!")
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveVersions gives the versions of file target to file inode, which
+// replaces it in a rename. The current contents of target are kept as a
+// version too, if versions are enabled. Versions of target written at the
+// same time as one of inode are dropped, inode keeps its own
+func moveVersions(tx *sql.Tx, target, inode int64) error {
+	if err := saveVersion(tx, target, true); err != nil {
+		return err
+	}
+
+	// mysql can't select from the table it deletes from, but from a copy
+	_, err := tx.Exec(rebind(tx,
+		`delete from {{version}} where inode = ? and mtime in (
+            select mtime from (select mtime from {{version}} where inode = ?) versions
+        )`), target, inode)
+	if err != nil {
+		log.Println("Couldn't remove versions!")
+		return err
+	}
+
+	_, err = tx.Exec(rebind(tx, "update {{version}} set inode = ? where inode = ?"), inode, target)
+	if err != nil {
+		log.Println("Couldn't move versions!")
+		return err
+	}
+
+	return nil
+}
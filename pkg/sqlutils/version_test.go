@@ -0,0 +1,193 @@
+package sqlutils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	sql "github.com/jmoiron/sqlx"
+)
+
+// newVersionedFile creates file name with contents, keeping them as a version
+func newVersionedFile(t *testing.T, backend SQLBackend, db *sql.DB, name string, contents []byte) int64 {
+	t.Helper()
+
+	inode, err := backend.CreateFileUnderInode(db, 1, name, 0, 0)
+	if err != nil {
+		t.Fatalf("Couldn't create file: %v", err)
+	}
+	if err = backend.SetFileContentsForInode(db, inode, contents); err != nil {
+		t.Fatalf("Couldn't write file: %v", err)
+	}
+
+	err = runInTx(db, "version save", func(tx *sql.Tx) error {
+		return saveVersion(tx, inode, true)
+	})
+	if err != nil {
+		t.Fatalf("Couldn't save version: %v", err)
+	}
+
+	return inode
+}
+
+func TestRestoreVersion(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetVersionOptions(db, VersionOptions{Keep: 10}); err != nil {
+				t.Fatalf("Couldn't enable versions: %v", err)
+			}
+
+			inode := newVersionedFile(t, backend, db, "file", []byte("first"))
+			// written too soon after the first to save a version
+			if err := backend.SetFileContentsForInode(db, inode, []byte("second")); err != nil {
+				t.Fatalf("Couldn't write file: %v", err)
+			}
+
+			versions, err := GetVersions(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't get versions: %v", err)
+			}
+			if len(versions) != 1 {
+				t.Fatalf("GetVersions returned %d versions, expected 1", len(versions))
+			}
+
+			if err = RestoreVersion(db, versions[0]); err != nil {
+				t.Fatalf("Couldn't restore version: %v", err)
+			}
+
+			data, err := backend.GetFileContentsForInode(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't read file: %v", err)
+			}
+			if !bytes.Equal(data, []byte("first")) {
+				t.Errorf("file has %q after restoring, expected %q", data, "first")
+			}
+
+			versions, err = GetVersions(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't get versions: %v", err)
+			}
+			if len(versions) != 2 {
+				t.Fatalf("GetVersions returned %d versions after restoring, expected 2", len(versions))
+			}
+			replaced, err := GetVersionContents(db, versions[0])
+			if err != nil {
+				t.Fatalf("Couldn't get version contents: %v", err)
+			}
+			if !bytes.Equal(replaced, []byte("second")) {
+				t.Errorf("newest version has %q, expected the replaced %q", replaced, "second")
+			}
+		})
+	}
+}
+
+func TestRenameVersionCollision(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetVersionOptions(db, VersionOptions{Keep: 10}); err != nil {
+				t.Fatalf("Couldn't enable versions: %v", err)
+			}
+
+			source := newVersionedFile(t, backend, db, "source", []byte("source"))
+			target := newVersionedFile(t, backend, db, "target", []byte("target"))
+
+			// both files written at the same time
+			var mtime int64
+			err := db.QueryRow(rebind(db, "select mtime from {{metadata}} where inode = ?"), source).Scan(&mtime)
+			if err != nil {
+				t.Fatalf("Couldn't get mtime: %v", err)
+			}
+			_, err = db.Exec(rebind(db, "update {{metadata}} set mtime = ? where inode = ?"), mtime, target)
+			if err != nil {
+				t.Fatalf("Couldn't set mtime: %v", err)
+			}
+			_, err = db.Exec(rebind(db, "update {{version}} set mtime = ? where inode = ?"), mtime, target)
+			if err != nil {
+				t.Fatalf("Couldn't set version mtime: %v", err)
+			}
+
+			if err = backend.RenameUnderInode(db, 1, "source", 1, "target"); err != nil {
+				t.Fatalf("Couldn't rename over a file with a version at the same time: %v", err)
+			}
+
+			versions, err := GetVersions(db, source)
+			if err != nil {
+				t.Fatalf("Couldn't get versions: %v", err)
+			}
+			if len(versions) != 1 {
+				t.Fatalf("GetVersions returned %d versions, expected 1", len(versions))
+			}
+			data, err := GetVersionContents(db, versions[0])
+			if err != nil {
+				t.Fatalf("Couldn't get version contents: %v", err)
+			}
+			if !bytes.Equal(data, []byte("source")) {
+				t.Errorf("version has %q, expected the renamed file's own %q", data, "source")
+			}
+		})
+	}
+}
+
+func TestAppendFileContentsVersion(t *testing.T) {
+	for name, backend := range sqliteBackends {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t, backend)
+			if err := SetVersionOptions(db, VersionOptions{Keep: 10}); err != nil {
+				t.Fatalf("Couldn't enable versions: %v", err)
+			}
+
+			inode, err := backend.CreateFileUnderInode(db, 1, "file", 0, 0)
+			if err != nil {
+				t.Fatalf("Couldn't create file: %v", err)
+			}
+			if err = backend.SetFileContentsForInode(db, inode, []byte("first")); err != nil {
+				t.Fatalf("Couldn't write file: %v", err)
+			}
+			// written long enough ago to save a version
+			_, err = db.Exec(rebind(db, "update {{metadata}} set mtime = ? where inode = ?"),
+				time.Now().Add(-time.Hour).UnixNano(), inode)
+			if err != nil {
+				t.Fatalf("Couldn't set mtime: %v", err)
+			}
+
+			if err = AppendFileContents(db, inode, 0, []byte("second")); err != nil {
+				t.Fatalf("Couldn't replace contents: %v", err)
+			}
+
+			versions, err := GetVersions(db, inode)
+			if err != nil {
+				t.Fatalf("Couldn't get versions: %v", err)
+			}
+			if len(versions) != 1 {
+				t.Fatalf("GetVersions returned %d versions, expected 1", len(versions))
+			}
+			data, err := GetVersionContents(db, versions[0])
+			if err != nil {
+				t.Fatalf("Couldn't get version contents: %v", err)
+			}
+			if !bytes.Equal(data, []byte("first")) {
+				t.Errorf("version has %q, expected the replaced %q", data, "first")
+			}
+
+			// inserted empty, to be written in parts
+			inserted, err := InsertEntries(backend, db, []Entry{{
+				Metadata: Metadata{Inode: -1, Mode: 0644, Type: int64(fuse.DT_File), Name: "inserted", Size: 6},
+				Parent:   1,
+			}})
+			if err != nil {
+				t.Fatalf("Couldn't insert file: %v", err)
+			}
+			if err = AppendFileContents(db, inserted[-1], 0, []byte("second")); err != nil {
+				t.Fatalf("Couldn't write contents: %v", err)
+			}
+			if versions, err = GetVersions(db, inserted[-1]); err != nil {
+				t.Fatalf("Couldn't get versions: %v", err)
+			} else if len(versions) != 0 {
+				t.Errorf("GetVersions returned %d versions of a file being written, expected none", len(versions))
+			}
+		})
+	}
+}